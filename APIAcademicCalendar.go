@@ -0,0 +1,153 @@
+/*
+ * This file is part of VianuEdu.
+ *
+ *  VianuEdu is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ *  VianuEdu is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with VianuEdu.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * Developed by Matei Gardus <matei@gardus.eu>
+ */
+
+package vianueduserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"io/ioutil"
+	"net/http"
+)
+
+// listAcademicYears sends back every academic year of the academic calendar, oldest first, as a JSON array of
+// AcademicYear objects.
+//
+// It will send back a Resource Not Found (404) response code if the academic calendar is empty.
+func listAcademicYears(w http.ResponseWriter, r *http.Request) {
+	responseCode := http.StatusOK
+
+	years := getAcademicYears()
+
+	if len(years) == 0 {
+		responseCode = http.StatusNotFound
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "404 academic calendar is empty!")
+	} else {
+		result, _ := json.Marshal(years)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, string(result))
+	}
+
+	APILogger.WithFields(logrus.Fields{
+		"host":         r.RemoteAddr,
+		"userAgent":    r.UserAgent(),
+		"responseCode": responseCode,
+	}).Info("listAcademicYears hit")
+}
+
+// getAcademicYear sends back an academic year of the academic calendar, or the current one if the year asked for is
+// "current" (see currentAcademicYear).
+//
+// It will send back a Resource Not Found (404) response code if the academic year doesn't exist.
+func getAcademicYear(w http.ResponseWriter, r *http.Request) {
+	requestVars := mux.Vars(r)
+	responseCode := http.StatusOK
+
+	year, ok := findAcademicYear(requestVars["year"])
+
+	if !ok {
+		responseCode = http.StatusNotFound
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "404 academic year not found!")
+	} else {
+		result, _ := json.Marshal(year)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, string(result))
+	}
+
+	APILogger.WithFields(logrus.Fields{
+		"host":         r.RemoteAddr,
+		"userAgent":    r.UserAgent(),
+		"year":         requestVars["year"],
+		"responseCode": responseCode,
+	}).Info("getAcademicYear hit")
+}
+
+// setAcademicYear adds an academic year to the academic calendar, or replaces it if it already exists, provided it is
+// given the admin credentials and a valid AcademicYear object (see validateAcademicYear) named after the year in the
+// request URL. Academic years can't overlap.
+//
+// Tests, grades and lessons already scoped to the academic year keep the semester they were scoped to.
+func setAcademicYear(w http.ResponseWriter, r *http.Request) {
+	requestVars := mux.Vars(r)
+	responseCode := http.StatusOK
+
+	username, password, authOK := r.BasicAuth()
+
+	user, pass := GetAdminCreds()
+
+	if !authOK || (username != user || password != pass) {
+		responseCode = http.StatusUnauthorized
+		w.Header().Set("WWW-Authenticate", `Basic realm="Access to the admin section"`)
+		http.Error(w, "Invalid authentication scheme!", responseCode)
+		return
+	}
+
+	body, _ := ioutil.ReadAll(r.Body)
+
+	if problem := validateAcademicYear(body); problem != "" {
+		responseCode = http.StatusBadRequest
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, problem)
+		return
+	}
+
+	var year AcademicYear
+	json.Unmarshal(body, &year)
+
+	if year.Year != requestVars["year"] {
+		responseCode = http.StatusBadRequest
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid academic year! Its name must be the same as the one in the request URL!")
+		return
+	}
+
+	whole := year.wholeYear()
+	for _, other := range getAcademicYears() {
+		if other.Year == year.Year {
+			continue
+		}
+
+		otherWhole := other.wholeYear()
+		if !whole.Start.After(otherWhole.End) && !otherWhole.Start.After(whole.End) {
+			responseCode = http.StatusConflict
+			w.WriteHeader(responseCode)
+			fmt.Fprint(w, "Invalid academic year! It overlaps the academic year "+other.Year+"!")
+			return
+		}
+	}
+
+	if year.Holidays == nil {
+		year.Holidays = []CalendarPeriod{}
+	}
+	document, _ := json.Marshal(year)
+
+	SetAcademicYear(year.Year, string(document))
+	fmt.Fprint(w, "Academic year set!")
+
+	APILogger.WithFields(logrus.Fields{
+		"host":         r.RemoteAddr,
+		"userAgent":    r.UserAgent(),
+		"year":         year.Year,
+		"responseCode": responseCode,
+	}).Info("setAcademicYear hit")
+}
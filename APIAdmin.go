@@ -156,6 +156,34 @@ func updateServer(w http.ResponseWriter, r *http.Request) {
 	HTTPLogger.Warn("[WARN] Server has been updated through updateServer HTTP Handler! Restart!")
 }
 
+// migrateTestTimes converts the start and end times of all tests and test overrides that are still written in the
+// legacy "Jan 2, 2006 3:04:05 PM" layout into dates, provided the credentials match with the ones saved inside of the
+// HTTPServer.json configuration file.
+//
+// Legacy times are read in the timezone of the school. The handler sends back a report of the migration, which lists
+// every document that couldn't be migrated.
+func migrateTestTimes(w http.ResponseWriter, r *http.Request) {
+
+	username, password, authOK := r.BasicAuth()
+	responseCode := http.StatusOK
+
+	user, pass := GetAdminCreds()
+
+	if !authOK || (username != user || password != pass) {
+		responseCode = http.StatusUnauthorized
+		w.Header().Set("WWW-Authenticate", `Basic realm="Access to the admin section"`)
+		http.Error(w, "Invalid authentication scheme!", responseCode)
+		return
+	}
+
+	report := MigrateTestTimes()
+
+	fmt.Fprint(w, report)
+	HTTPLogger.WithFields(logrus.Fields{
+		"report": report,
+	}).Warn("[WARN] Test times have been migrated through migrateTestTimes HTTP Handler!")
+}
+
 // ZipFiles creates a ZIP archive by receiving the filepath to each of the respective files.
 // The first parameter determines the filepath of the ZIP archive, while the second parameter determines the files to be inserted into the archive.
 func ZipFiles(filename string, files []string) error {
@@ -20,6 +20,7 @@
 package vianueduserver
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/buger/jsonparser"
 	"github.com/gorilla/mux"
@@ -29,6 +30,8 @@ import (
 	"net/http"
 	"os"
 	"regexp"
+	"strconv"
+	"time"
 )
 
 // getAnswerSheet gets an AnswerSheet object from the database and send it to the client.
@@ -37,6 +40,9 @@ import (
 // It will fail if the test ID is invalid, if the student ID is invalid and send back a Bad Request (400) response code.
 // It will also respond with a Resource Not Found response code (404) if there is no answer sheet attached to the
 // student ID and test ID combination.
+//
+// On tests that allow several attempts, the latest answer sheet still waiting to be graded is sent back, unless a
+// specific attempt is requested with "?attempt=2".
 func getAnswerSheet(w http.ResponseWriter, r *http.Request) {
 	requestVars := mux.Vars(r)
 
@@ -60,7 +66,19 @@ func getAnswerSheet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	answerSheet := GetAnswerSheet(student, requestVars["testID"])
+	attempt := 0
+	if r.URL.Query().Get("attempt") != "" {
+		var err error
+		attempt, err = strconv.Atoi(r.URL.Query().Get("attempt"))
+		if err != nil || attempt < 1 {
+			responseCode = http.StatusBadRequest
+			w.WriteHeader(responseCode)
+			fmt.Fprint(w, "Invalid attempt! Must be a positive number!")
+			return
+		}
+	}
+
+	answerSheet := GetAnswerSheet(student, requestVars["testID"], attempt)
 
 	w.Header().Set("Content-Type", "application/json")
 
@@ -90,6 +108,14 @@ func getAnswerSheet(w http.ResponseWriter, r *http.Request) {
 // It will also fail if the submitted answer sheet has an invalid JSON schema and send back Bad Request (400)
 // response code.
 // Any invalid combination of student ID - test ID will be responded with a Bad Request (400) response code.
+//
+// The timing of the test is enforced by the server: answer sheets submitted before the test starts, or after the
+// student's time has run out (see checkSubmissionTime), are responded with a Forbidden (403) response code, unless the
+// server is configured to accept late answer sheets and flag them as such. Tests whose start or end time can't be read
+// accept no answer sheets, and are responded with an Internal Server Error (500) response code.
+//
+// Students can submit as many answer sheets as the test allows attempts ("attempts" in the Test object, 1 by default),
+// each stored as its own record. Any submission past that is responded with an Already Reported (208) response code.
 func submitAnswerSheet(w http.ResponseWriter, r *http.Request) {
 	requestVars := mux.Vars(r)
 
@@ -158,17 +184,74 @@ func submitAnswerSheet(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 
-			student, _, _, _ := jsonparser.Get(body, "student")
+			test := GetTest(testID)
+			if test == "notFound" {
+				responseCode = http.StatusNotFound
+				w.WriteHeader(responseCode)
+				fmt.Fprint(w, "404 test not found!")
+				return
+			}
 
-			if GetAnswerSheet(string(student), testID) != "notFound" {
+			attemptLimit, _ := getAttemptPolicy([]byte(test))
+			if CountAttempts(testID, user) >= attemptLimit {
 				responseCode = http.StatusAlreadyReported
 				w.WriteHeader(responseCode)
-				fmt.Fprint(w, "Cannot submit an answer sheet after it has already been submitted!")
+				fmt.Fprint(w, attemptLimitMessage(attemptLimit))
+				return
+			}
+
+			if status := GetTestStatus(testID); status != testActive {
+				responseCode = http.StatusGone
+				w.WriteHeader(responseCode)
+				fmt.Fprint(w, "This test has been "+status+"! It no longer accepts answer sheets.")
 				return
 			}
 
-			AddAnswerSheet(string(body))
-			fmt.Fprint(w, "Answer sheet added! You can no longer add anything to this test!")
+			attempt := 0
+
+			switch submissionTime := checkSubmissionTime([]byte(test), testID, studentID, time.Now()); submissionTime {
+			case submissionTooEarly:
+				responseCode = http.StatusForbidden
+				w.WriteHeader(responseCode)
+				fmt.Fprint(w, "Cannot submit an answer sheet before the test has started!")
+			case submissionNotOpened:
+				responseCode = http.StatusForbidden
+				w.WriteHeader(responseCode)
+				fmt.Fprint(w, "Cannot submit an answer sheet for a timed test that you have never opened!")
+			case submissionTooLate:
+				responseCode = http.StatusForbidden
+				w.WriteHeader(responseCode)
+				fmt.Fprint(w, "Cannot submit an answer sheet after your time for this test has run out!")
+			case submissionInvalidTiming:
+				responseCode = http.StatusInternalServerError
+				w.WriteHeader(responseCode)
+				fmt.Fprint(w, "This test has an invalid start or end time! Answer sheets can't be submitted until"+
+					" it is fixed.")
+			default:
+				var added bool
+				attempt, added = AddAnswerSheet(string(body), submissionTime == submissionLate, attemptLimit)
+				switch {
+				case !added:
+					responseCode = http.StatusInternalServerError
+					w.WriteHeader(responseCode)
+					fmt.Fprint(w, "Oops! We messed up somewhere! Sorry! Try again")
+				case attempt == 0:
+					responseCode = http.StatusAlreadyReported
+					w.WriteHeader(responseCode)
+					fmt.Fprint(w, attemptLimitMessage(attemptLimit))
+				case submissionTime == submissionLate:
+					fmt.Fprint(w, "Answer sheet added, but it has been flagged as late! "+
+						attemptsLeftMessage(attempt, attemptLimit))
+				default:
+					fmt.Fprint(w, "Answer sheet added! "+attemptsLeftMessage(attempt, attemptLimit))
+				}
+			}
+
+			// the answer sheet has been submitted in one shot, so any draft left behind is of no use anymore
+			if responseCode == http.StatusOK {
+				RemoveDraftAnswerSheet(testID, studentID)
+				closeAttempt(testID, studentID, attempt, attemptLimit)
+			}
 		}
 	}
 
@@ -209,3 +292,505 @@ func getAnswerSheetsForTest(w http.ResponseWriter, r *http.Request) {
 	}).Info("getAnswerSheetsForTest hit")
 
 }
+
+// saveDraftAnswerSheet saves the in-progress answers of a student on a test, so that they are not lost should the
+// client crash mid-exam. Drafts can be saved as often as the client wants, only the latest one is kept.
+//
+// Every validation conducted within this HTTP handler function is equivalent to the ones in submitAnswerSheet. On top
+// of that, drafts can't be saved once the student has used up their attempts, or once the student's time has run out.
+func saveDraftAnswerSheet(w http.ResponseWriter, r *http.Request) {
+	requestVars := mux.Vars(r)
+
+	//first we strip out the authentication from the header
+	username, password, authOK := r.BasicAuth()
+
+	responseCode := http.StatusOK
+
+	studentID := FindStudentID(username, password)
+
+	templateFile, _ := os.Open("templates/AnswerSheetTemplate.json")
+
+	//then we check to see if authOK
+	if !authOK {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid authentication scheme!")
+		return
+	}
+
+	//see if student exists
+	if studentID == "notFound" {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid username and password combination!")
+		return
+	}
+
+	//validate JSON!
+	// we pretty much only care for the final error, since the rest of the stuff here is unlikely to ever fail randomly.
+	templateString, _ := ioutil.ReadAll(templateFile)
+
+	answerSheetTemplate := gojsonschema.NewStringLoader(string(templateString))
+
+	body, _ := ioutil.ReadAll(r.Body)
+
+	answerSheetResponse := gojsonschema.NewStringLoader(string(body))
+
+	validation, err := gojsonschema.Validate(answerSheetTemplate, answerSheetResponse)
+	if err != nil || !validation.Valid() {
+		APILogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Warn("Could not validate JSON schema and document for saving draft answer sheet!")
+		responseCode = http.StatusBadRequest
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid AnswerSheet object!")
+		return
+	}
+
+	//don't need errors here because I've already validated the JSON and know that it will work
+	user, _ := jsonparser.GetString(body, "student", "account", "userName")
+	pass, _ := jsonparser.GetString(body, "student", "account", "password")
+
+	if FindStudentID(user, pass) != studentID {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Malformed answer sheet! (can't save answer sheet on someone else's behalf")
+		return
+	}
+
+	testID, _ := jsonparser.GetString(body, "testID")
+	if testID != requestVars["testID"] {
+		responseCode = http.StatusBadRequest
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Cannot save answer sheet from another test to this one!")
+		return
+	}
+
+	test := GetTest(testID)
+	if test == "notFound" {
+		responseCode = http.StatusNotFound
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "404 test not found!")
+		return
+	}
+
+	if attemptLimit, _ := getAttemptPolicy([]byte(test)); CountAttempts(testID, user) >= attemptLimit {
+		responseCode = http.StatusAlreadyReported
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Cannot save a draft after the answer sheet has already been submitted!")
+		return
+	}
+
+	if status := GetTestStatus(testID); status != testActive {
+		responseCode = http.StatusGone
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "This test has been "+status+"! It no longer accepts answer sheets.")
+		return
+	}
+
+	submissionTime := checkSubmissionTime([]byte(test), testID, studentID, time.Now())
+	if submissionTime != submissionOnTime && submissionTime != submissionLate {
+		responseCode = http.StatusForbidden
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Cannot save a draft outside of your time for this test!")
+		return
+	}
+
+	SaveDraftAnswerSheet(studentID, string(body))
+	fmt.Fprint(w, "Draft saved!")
+
+	APILogger.WithFields(logrus.Fields{
+		"host":         r.RemoteAddr,
+		"userAgent":    r.UserAgent(),
+		"studentID":    studentID,
+		"testID":       testID,
+		"responseCode": responseCode,
+	}).Info("saveDraftAnswerSheet hit")
+}
+
+// getDraftAnswerSheet sends back the latest draft answer sheet a student saved on a test, so that the student can
+// resume the test on another device.
+//
+// It will send back a Resource Not Found (404) response code if there is no draft saved.
+func getDraftAnswerSheet(w http.ResponseWriter, r *http.Request) {
+	requestVars := mux.Vars(r)
+
+	//first we strip out the authentication from the header
+	username, password, authOK := r.BasicAuth()
+
+	responseCode := http.StatusOK
+
+	studentID := FindStudentID(username, password)
+
+	//then we check to see if authOK
+	if !authOK {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid authentication scheme!")
+		return
+	}
+
+	//see if student exists
+	if studentID == "notFound" {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid username and password combination!")
+		return
+	}
+
+	draft := GetDraftAnswerSheet(requestVars["testID"], studentID)
+
+	if draft == "notFound" {
+		responseCode = http.StatusNotFound
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "404 draft not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, draft)
+
+	APILogger.WithFields(logrus.Fields{
+		"host":         r.RemoteAddr,
+		"userAgent":    r.UserAgent(),
+		"studentID":    studentID,
+		"testID":       requestVars["testID"],
+		"responseCode": responseCode,
+	}).Info("getDraftAnswerSheet hit")
+}
+
+// finalizeDraftAnswerSheet submits the latest draft answer sheet a student saved on a test as their answer sheet for
+// the current attempt. After the last attempt, nothing can be added to the test anymore.
+//
+// The timing of the test and its attempt limit are enforced exactly like in submitAnswerSheet. It will send back a
+// Resource Not Found (404) response code if there is no draft saved.
+func finalizeDraftAnswerSheet(w http.ResponseWriter, r *http.Request) {
+	requestVars := mux.Vars(r)
+
+	//first we strip out the authentication from the header
+	username, password, authOK := r.BasicAuth()
+
+	responseCode := http.StatusOK
+
+	studentID := FindStudentID(username, password)
+
+	//then we check to see if authOK
+	if !authOK {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid authentication scheme!")
+		return
+	}
+
+	//see if student exists
+	if studentID == "notFound" {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid username and password combination!")
+		return
+	}
+
+	if GetDraftAnswerSheet(requestVars["testID"], studentID) == "notFound" {
+		responseCode = http.StatusNotFound
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "404 draft not found")
+		return
+	}
+
+	test := GetTest(requestVars["testID"])
+	if test == "notFound" {
+		responseCode = http.StatusNotFound
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "404 test not found!")
+		return
+	}
+
+	if status := GetTestStatus(requestVars["testID"]); status != testActive {
+		responseCode = http.StatusGone
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "This test has been "+status+"! It no longer accepts answer sheets.")
+		return
+	}
+
+	attemptLimit, _ := getAttemptPolicy([]byte(test))
+	if CountAttempts(requestVars["testID"], username) >= attemptLimit {
+		responseCode = http.StatusAlreadyReported
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, attemptLimitMessage(attemptLimit))
+		return
+	}
+
+	switch checkSubmissionTime([]byte(test), requestVars["testID"], studentID, time.Now()) {
+	case submissionTooEarly, submissionNotOpened:
+		responseCode = http.StatusForbidden
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Cannot submit an answer sheet outside of your time for this test!")
+	case submissionTooLate:
+		responseCode = http.StatusForbidden
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Cannot submit an answer sheet after your time for this test has run out!")
+	case submissionInvalidTiming:
+		responseCode = http.StatusInternalServerError
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "This test has an invalid start or end time! Answer sheets can't be submitted until"+
+			" it is fixed.")
+	case submissionLate:
+		if message, submitted := submitDraftAnswerSheet(requestVars["testID"], studentID, true, false); submitted {
+			fmt.Fprint(w, "Answer sheet added, but it has been flagged as late! "+message)
+		} else if CountAttempts(requestVars["testID"], username) < attemptLimit {
+			responseCode = http.StatusInternalServerError
+			w.WriteHeader(responseCode)
+			fmt.Fprint(w, "Oops! We messed up somewhere! Sorry! Try again")
+		} else {
+			responseCode = http.StatusAlreadyReported
+			w.WriteHeader(responseCode)
+			fmt.Fprint(w, attemptLimitMessage(attemptLimit))
+		}
+	default:
+		if message, submitted := submitDraftAnswerSheet(requestVars["testID"], studentID, false, false); submitted {
+			fmt.Fprint(w, "Answer sheet added! "+message)
+		} else if CountAttempts(requestVars["testID"], username) < attemptLimit {
+			responseCode = http.StatusInternalServerError
+			w.WriteHeader(responseCode)
+			fmt.Fprint(w, "Oops! We messed up somewhere! Sorry! Try again")
+		} else {
+			responseCode = http.StatusAlreadyReported
+			w.WriteHeader(responseCode)
+			fmt.Fprint(w, attemptLimitMessage(attemptLimit))
+		}
+	}
+
+	APILogger.WithFields(logrus.Fields{
+		"host":         r.RemoteAddr,
+		"userAgent":    r.UserAgent(),
+		"studentID":    studentID,
+		"testID":       requestVars["testID"],
+		"responseCode": responseCode,
+	}).Info("finalizeDraftAnswerSheet hit")
+}
+
+// submitDraftAnswerSheet turns the draft answer sheet of a student on a test into their submitted answer sheet for the
+// next attempt and removes the draft. It returns what is left for the student to do on the test, and whether the draft
+// was submitted at all.
+//
+// Should the student already have used up their attempts on the test, the draft is simply discarded. Should the answer
+// sheet not be added, the draft is kept for the student to submit again.
+// The answer sheet is marked with whether it was submitted by the server once the student's time ran out.
+func submitDraftAnswerSheet(testID, studentID string, late, autoSubmitted bool) (string, bool) {
+	draft := GetDraftAnswerSheet(testID, studentID)
+	if draft == "notFound" {
+		return "", false
+	}
+
+	var document map[string]interface{}
+
+	err := json.Unmarshal([]byte(draft), &document)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Warn("Could not unmarshal draft answer sheet into document!")
+		return "", false
+	}
+
+	delete(document, "_id")
+	delete(document, "studentID")
+	delete(document, "updatedAt")
+	document["autoSubmitted"] = autoSubmitted
+
+	answerSheet, _ := json.Marshal(document)
+
+	attemptLimit, _ := getAttemptPolicy([]byte(GetTest(testID)))
+
+	attempt, added := AddAnswerSheet(string(answerSheet), late, attemptLimit)
+	if !added {
+		return "", false
+	}
+
+	if attempt != 0 {
+		closeAttempt(testID, studentID, attempt, attemptLimit)
+	}
+
+	RemoveDraftAnswerSheet(testID, studentID)
+
+	return attemptsLeftMessage(attempt, attemptLimit), attempt != 0
+}
+
+// closeAttempt ends the attempt a student just submitted on a test. If the student has attempts left, their test
+// session is closed, so that their time limit starts running again once they open the test for the next attempt.
+func closeAttempt(testID, studentID string, attempt, attemptLimit int) {
+	if attempt < attemptLimit {
+		CloseTestSession(testID, studentID)
+	}
+}
+
+// getSimilarAnswers compares the free-text answers of every student who submitted an answer sheet for a test and sends
+// back a SimilarityReport of the pairs of students with suspiciously similar answers, provided it is given the
+// credentials of a teacher of the course of the test.
+//
+// Answers are flagged once their similarity reaches the threshold in TestSettings.json, unless another threshold,
+// between 0 and 1, is requested with "?threshold=0.5". The report only points the grading teacher to answers worth a
+// closer look, it doesn't prove anything by itself.
+func getSimilarAnswers(w http.ResponseWriter, r *http.Request) {
+	requestVars := mux.Vars(r)
+	responseCode := http.StatusOK
+
+	username, password, authOK := r.BasicAuth()
+
+	teacherID := FindTeacherID(username, password)
+
+	if !authOK {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid authentication scheme!")
+		return
+	}
+
+	//see if teacher exists
+	if teacherID == "notFound" {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid username and password combination!")
+		return
+	}
+
+	if GetTest(requestVars["testID"]) == "notFound" {
+		responseCode = http.StatusNotFound
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "404 test not found!")
+		return
+	}
+
+	if !teachesTest(teacherID, requestVars["testID"]) {
+		responseCode = http.StatusForbidden
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Only teachers of the course of this test can compare its answer sheets!")
+		return
+	}
+
+	threshold := similarityThreshold
+	if requestedThreshold := r.URL.Query().Get("threshold"); requestedThreshold != "" {
+		parsedThreshold, err := strconv.ParseFloat(requestedThreshold, 64)
+		if err != nil || parsedThreshold < 0 || parsedThreshold > 1 {
+			responseCode = http.StatusBadRequest
+			w.WriteHeader(responseCode)
+			fmt.Fprint(w, "Invalid threshold! Threshold must be a number between 0 and 1!")
+			return
+		}
+		threshold = parsedThreshold
+	}
+
+	report, _ := json.Marshal(findSimilarAnswers(requestVars["testID"], threshold))
+
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, string(report))
+
+	APILogger.WithFields(logrus.Fields{
+		"host":         r.RemoteAddr,
+		"userAgent":    r.UserAgent(),
+		"teacherID":    teacherID,
+		"testID":       requestVars["testID"],
+		"threshold":    threshold,
+		"responseCode": responseCode,
+	}).Info("getSimilarAnswers hit")
+}
+
+// checkAnswerSheet checks the answer sheet a student submitted on a test against the answer key of the test and
+// sends back an AnswerCheck, provided it is given the credentials of a teacher of the course of the test.
+//
+// Multiple-choice answers are right if they picked the right choice, and expression answers are right if they are
+// equivalent to the answer key, i.e. "2(x+1)" is as right as "2x+2". Programs answering programming questions are
+// compiled and run against the test cases of their question. Every other question is left for the teacher.
+//
+// The latest answer sheet still waiting to be graded is checked, unless a specific attempt is requested with
+// "?attempt=2". It will send back a Resource Not Found (404) response code if there is no such answer sheet.
+func checkAnswerSheet(w http.ResponseWriter, r *http.Request) {
+	requestVars := mux.Vars(r)
+	responseCode := http.StatusOK
+
+	username, password, authOK := r.BasicAuth()
+
+	teacherID := FindTeacherID(username, password)
+
+	if !authOK {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid authentication scheme!")
+		return
+	}
+
+	//see if teacher exists
+	if teacherID == "notFound" {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid username and password combination!")
+		return
+	}
+
+	test := GetTest(requestVars["testID"])
+
+	if test == "notFound" {
+		responseCode = http.StatusNotFound
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "404 test not found!")
+		return
+	}
+
+	student := GetStudentObjectByID(requestVars["studentID"])
+
+	if student == "notFound" {
+		responseCode = http.StatusNotFound
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "404 student not found!")
+		return
+	}
+
+	if !teachesTest(teacherID, requestVars["testID"]) {
+		responseCode = http.StatusForbidden
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Only teachers of the course of this test can check its answer sheets!")
+		return
+	}
+
+	attempt := 0
+	if r.URL.Query().Get("attempt") != "" {
+		var err error
+		attempt, err = strconv.Atoi(r.URL.Query().Get("attempt"))
+		if err != nil || attempt < 1 {
+			responseCode = http.StatusBadRequest
+			w.WriteHeader(responseCode)
+			fmt.Fprint(w, "Invalid attempt! Must be a positive number!")
+			return
+		}
+	}
+
+	answerSheet := GetAnswerSheet(student, requestVars["testID"], attempt)
+
+	if answerSheet == "notFound" {
+		responseCode = http.StatusNotFound
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "404 answer sheet not found")
+		return
+	}
+
+	if draw := GetTestDraw(requestVars["testID"], requestVars["studentID"]); draw != "notFound" {
+		test = mergeTestDraw(test, draw)
+	}
+
+	check := checkAnswers([]byte(answerSheet), []byte(test))
+	check.TestID = requestVars["testID"]
+	check.StudentID = requestVars["studentID"]
+	check.Mark = getTestGradeScale(test).convertToMark(check.Score, check.MaximumGrade)
+
+	result, _ := json.Marshal(check)
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, string(result))
+
+	APILogger.WithFields(logrus.Fields{
+		"host":         r.RemoteAddr,
+		"userAgent":    r.UserAgent(),
+		"teacherID":    teacherID,
+		"studentID":    requestVars["studentID"],
+		"testID":       requestVars["testID"],
+		"responseCode": responseCode,
+	}).Info("checkAnswerSheet hit")
+}
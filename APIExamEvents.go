@@ -0,0 +1,395 @@
+/*
+ * This file is part of VianuEdu.
+ *
+ *  VianuEdu is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ *  VianuEdu is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with VianuEdu.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * Developed by Matei Gardus <matei@gardus.eu>
+ */
+
+package vianueduserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/buger/jsonparser"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/xeipuuv/gojsonschema"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// examEventTypes lists the events an exam client can report: the exam window losing or regaining focus, the student
+// copying or pasting text, the client reconnecting to the server and the student's IP address changing.
+var examEventTypes = []string{"focusLost", "focusRegained", "copy", "paste", "reconnect", "ipChange"}
+
+// flaggedExamEventTypes lists the events that flag an attempt for the grading teacher to look into.
+var flaggedExamEventTypes = []string{"focusLost", "copy", "paste", "ipChange"}
+
+// maxExamEventDetails is the longest description of an event that is kept, in bytes. Longer descriptions are cut on
+// the last character that fits.
+const maxExamEventDetails = 500
+
+// An ExamEvent is something the exam client of a student saw during an attempt on a test. The moment it occurred is
+// the one reported by the client, while the moment it was received, the IP address and the user agent are recorded by
+// the server.
+type ExamEvent struct {
+	Attempt    int       `json:"attempt" bson:"attempt"`
+	EventType  string    `json:"eventType" bson:"eventType"`
+	Details    string    `json:"details,omitempty" bson:"details"`
+	OccurredAt time.Time `json:"occurredAt" bson:"occurredAt"`
+	ReceivedAt time.Time `json:"receivedAt" bson:"receivedAt"`
+	IP         string    `json:"ip" bson:"ip"`
+	UserAgent  string    `json:"userAgent" bson:"userAgent"`
+}
+
+// An ExamTimeline lists the events reported during a single attempt of a student on a test, in the order they occurred,
+// along with how many events of each type were reported. The attempt is flagged if any of them is one of
+// flaggedExamEventTypes.
+type ExamTimeline struct {
+	TestID    string         `json:"testID"`
+	StudentID string         `json:"studentID"`
+	Attempt   int            `json:"attempt"`
+	Flagged   bool           `json:"flagged"`
+	Counts    map[string]int `json:"counts"`
+	Events    []ExamEvent    `json:"events"`
+}
+
+// reportExamEvent records an event reported by the exam client of a student during their current attempt on a test,
+// i.e. the exam window losing focus or the student pasting text. The current attempt is the one the student opened the
+// test for (see OpenTestSession).
+//
+// The event is a JSON object with its "eventType", one of examEventTypes, and optionally the moment it "occurredAt", as
+// an RFC 3339 timestamp, and its "details". Should the student's IP address differ from the one of their previous
+// event on the same attempt, an "ipChange" event is recorded by the server on top of it.
+//
+// It will send back a Resource Not Found (404) response code if the test doesn't exist, a Forbidden (403) response code
+// if the student hasn't opened the test, and a Bad Request (400) response code if the event isn't valid.
+func reportExamEvent(w http.ResponseWriter, r *http.Request) {
+	requestVars := mux.Vars(r)
+
+	//first we strip out the authentication from the header
+	username, password, authOK := r.BasicAuth()
+
+	responseCode := http.StatusOK
+
+	studentID := FindStudentID(username, password)
+
+	templateFile, _ := os.Open("templates/ExamEventTemplate.json")
+
+	//then we check to see if authOK
+	if !authOK {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid authentication scheme!")
+		return
+	}
+
+	//see if student exists
+	if studentID == "notFound" {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid username and password combination!")
+		return
+	}
+
+	test := GetTest(requestVars["testID"])
+
+	if test == "notFound" {
+		responseCode = http.StatusNotFound
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "404 test not found!")
+		return
+	}
+
+	if GetTestSessionStart(requestVars["testID"], studentID).IsZero() {
+		responseCode = http.StatusForbidden
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "You haven't opened this test! Events can only be reported while taking it.")
+		return
+	}
+
+	//validate JSON!
+	// we pretty much only care for the final error, since the rest of the stuff here is unlikely to ever fail randomly.
+	templateString, _ := ioutil.ReadAll(templateFile)
+
+	eventTemplate := gojsonschema.NewStringLoader(string(templateString))
+
+	body, _ := ioutil.ReadAll(r.Body)
+
+	eventResponse := gojsonschema.NewStringLoader(string(body))
+
+	validation, err := gojsonschema.Validate(eventTemplate, eventResponse)
+	if err != nil || !validation.Valid() {
+		APILogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Warn("Could not validate JSON schema and document for reporting exam event!")
+		responseCode = http.StatusBadRequest
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid ExamEvent object!")
+		return
+	}
+
+	event := ExamEvent{ReceivedAt: time.Now(), IP: requestIP(r), UserAgent: r.UserAgent()}
+
+	event.EventType, _ = jsonparser.GetString(body, "eventType")
+	if !isExamEventType(event.EventType) {
+		responseCode = http.StatusBadRequest
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid event type! Must be one of "+strings.Join(examEventTypes, ", ")+"!")
+		return
+	}
+
+	event.OccurredAt = event.ReceivedAt
+	if occurredAt, err := jsonparser.GetString(body, "occurredAt"); err == nil {
+		event.OccurredAt, err = parseTestTime(occurredAt)
+		if err != nil {
+			responseCode = http.StatusBadRequest
+			w.WriteHeader(responseCode)
+			fmt.Fprint(w, "Invalid event time! Event times must be RFC 3339 timestamps, i.e. 2049-02-21T10:42:13+02:00")
+			return
+		}
+	}
+
+	event.Details, _ = jsonparser.GetString(body, "details")
+	if len(event.Details) > maxExamEventDetails {
+		// cut on a rune boundary, so that the details stay valid UTF-8
+		cut := maxExamEventDetails
+		for cut > 0 && !utf8.RuneStart(event.Details[cut]) {
+			cut--
+		}
+		event.Details = event.Details[:cut]
+	}
+
+	// events belong to the attempt the test was opened for, and those reported after the last attempt was submitted
+	// still belong to it
+	attemptLimit, _ := getAttemptPolicy([]byte(test))
+	event.Attempt = GetTestSessionAttempt(requestVars["testID"], studentID)
+	if event.Attempt == 0 {
+		event.Attempt = CountAttempts(requestVars["testID"], username) + 1
+	}
+	if event.Attempt > attemptLimit {
+		event.Attempt = attemptLimit
+	}
+
+	if lastIP := GetLastExamEventIP(requestVars["testID"], studentID, event.Attempt); lastIP != "" && lastIP != event.IP &&
+		event.EventType != "ipChange" {
+		AddExamEvent(requestVars["testID"], studentID, event.Attempt, ExamEvent{
+			EventType:  "ipChange",
+			Details:    "IP address changed from " + lastIP + " to " + event.IP + ".",
+			OccurredAt: event.ReceivedAt,
+			ReceivedAt: event.ReceivedAt,
+			IP:         event.IP,
+			UserAgent:  event.UserAgent,
+		})
+	}
+
+	AddExamEvent(requestVars["testID"], studentID, event.Attempt, event)
+
+	fmt.Fprint(w, "Event recorded!")
+
+	APILogger.WithFields(logrus.Fields{
+		"host":         r.RemoteAddr,
+		"userAgent":    r.UserAgent(),
+		"studentID":    studentID,
+		"testID":       requestVars["testID"],
+		"eventType":    event.EventType,
+		"responseCode": responseCode,
+	}).Info("reportExamEvent hit")
+}
+
+// getExamTimeline sends back the ExamTimeline of every attempt of a student on a test, so that the grading teacher can
+// read it next to the student's answer sheet, provided it is given the credentials of a teacher of the course of the
+// test. A single attempt can be requested with "?attempt=2".
+//
+// It will send back a Resource Not Found (404) response code if either the test or the student doesn't exist.
+func getExamTimeline(w http.ResponseWriter, r *http.Request) {
+	requestVars := mux.Vars(r)
+	responseCode := http.StatusOK
+
+	username, password, authOK := r.BasicAuth()
+
+	teacherID := FindTeacherID(username, password)
+
+	if !authOK {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid authentication scheme!")
+		return
+	}
+
+	//see if teacher exists
+	if teacherID == "notFound" {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid username and password combination!")
+		return
+	}
+
+	if GetTest(requestVars["testID"]) == "notFound" || GetStudentObjectByID(requestVars["studentID"]) == "notFound" {
+		responseCode = http.StatusNotFound
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "404 test or student not found!")
+		return
+	}
+
+	if !teachesTest(teacherID, requestVars["testID"]) {
+		responseCode = http.StatusForbidden
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Only teachers of the course of this test can see its exam events!")
+		return
+	}
+
+	attempt := 0
+	if r.URL.Query().Get("attempt") != "" {
+		var err error
+		attempt, err = strconv.Atoi(r.URL.Query().Get("attempt"))
+		if err != nil || attempt < 1 {
+			responseCode = http.StatusBadRequest
+			w.WriteHeader(responseCode)
+			fmt.Fprint(w, "Invalid attempt! Must be a positive number!")
+			return
+		}
+	}
+
+	timelines := buildExamTimelines(requestVars["testID"], requestVars["studentID"], attempt)
+
+	result, _ := json.Marshal(timelines)
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, string(result))
+
+	APILogger.WithFields(logrus.Fields{
+		"host":         r.RemoteAddr,
+		"userAgent":    r.UserAgent(),
+		"teacherID":    teacherID,
+		"studentID":    requestVars["studentID"],
+		"testID":       requestVars["testID"],
+		"responseCode": responseCode,
+	}).Info("getExamTimeline hit")
+}
+
+// buildExamTimelines gathers the events of a student on a test into one ExamTimeline per attempt, or only for the
+// provided attempt if it isn't 0. Event times are written in the timezone of the school.
+func buildExamTimelines(testID, studentID string, attempt int) []ExamTimeline {
+	timelines := []ExamTimeline{}
+	byAttempt := map[int]int{}
+
+	for _, event := range ListExamEvents(testID, studentID) {
+		if attempt != 0 && event.Attempt != attempt {
+			continue
+		}
+
+		index, ok := byAttempt[event.Attempt]
+		if !ok {
+			index = len(timelines)
+			byAttempt[event.Attempt] = index
+			timelines = append(timelines, ExamTimeline{
+				TestID:    testID,
+				StudentID: studentID,
+				Attempt:   event.Attempt,
+				Counts:    map[string]int{},
+				Events:    []ExamEvent{},
+			})
+		}
+
+		event.OccurredAt = event.OccurredAt.In(schoolTimezone)
+		event.ReceivedAt = event.ReceivedAt.In(schoolTimezone)
+
+		timeline := &timelines[index]
+		timeline.Events = append(timeline.Events, event)
+		timeline.Counts[event.EventType]++
+		if isFlaggedExamEventType(event.EventType) {
+			timeline.Flagged = true
+		}
+	}
+
+	for _, timeline := range timelines {
+		events := timeline.Events
+		sort.SliceStable(events, func(i, j int) bool {
+			return events[i].OccurredAt.Before(events[j].OccurredAt)
+		})
+	}
+
+	sort.Slice(timelines, func(i, j int) bool {
+		return timelines[i].Attempt < timelines[j].Attempt
+	})
+
+	return timelines
+}
+
+// countFlaggedAnswerSheets counts the answer sheets of a test, still waiting to be graded, whose attempt was flagged by
+// the events reported during it.
+func countFlaggedAnswerSheets(testID string) int {
+	answerSheets := ListAnswerSheetsForTest(testID)
+	if answerSheets == "notFound" {
+		return 0
+	}
+
+	flaggedAttempts := ListFlaggedExamAttempts(testID, flaggedExamEventTypes)
+	if len(flaggedAttempts) == 0 {
+		return 0
+	}
+
+	flagged := 0
+
+	jsonparser.ArrayEach([]byte(answerSheets), func(value []byte, dataType jsonparser.ValueType, offset int, err error) {
+		studentUser, _ := jsonparser.GetString(value, "student", "account", "userName")
+		studentPass, _ := jsonparser.GetString(value, "student", "account", "password")
+
+		if flaggedAttempts[FindStudentID(studentUser, studentPass)][getAttemptNumber(value)] {
+			flagged++
+		}
+	})
+
+	return flagged
+}
+
+// requestIP returns the IP address a request was sent from, without its port.
+func requestIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// isExamEventType checks whether an event type is one of examEventTypes.
+func isExamEventType(eventType string) bool {
+	for _, examEventType := range examEventTypes {
+		if eventType == examEventType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isFlaggedExamEventType checks whether an event type is one of flaggedExamEventTypes.
+func isFlaggedExamEventType(eventType string) bool {
+	for _, flaggedEventType := range flaggedExamEventTypes {
+		if eventType == flaggedEventType {
+			return true
+		}
+	}
+
+	return false
+}
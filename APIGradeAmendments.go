@@ -0,0 +1,277 @@
+/*
+ * This file is part of VianuEdu.
+ *
+ *  VianuEdu is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ *  VianuEdu is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with VianuEdu.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * Developed by Matei Gardus <matei@gardus.eu>
+ */
+
+package vianueduserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/buger/jsonparser"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// amendGrade changes the score of a grade already given, provided it is given the credentials of the teacher who gave
+// the grade or the admin credentials, along with the new score and the reason for the change, in a JSON body such as
+// {"currentGrade": 85, "reason": "..."}. The mark of the new score is converted by the server.
+//
+// On tests that allow several attempts, the grade of the latest graded attempt is amended, unless a specific attempt
+// is requested with "?attempt=2". The version of the grade being replaced is kept in its history (see
+// getGradeHistory).
+//
+// It will send back a Resource Not Found (404) response code if either the test, the student or the grade doesn't
+// exist, a Conflict (409) response code if the grade was changed while being amended, and a Gone (410) response code
+// if the test has been cancelled.
+func amendGrade(w http.ResponseWriter, r *http.Request) {
+	requestVars := mux.Vars(r)
+	responseCode := http.StatusOK
+
+	username, password, authOK := r.BasicAuth()
+
+	if !authOK {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid authentication scheme!")
+		return
+	}
+
+	adminUser, adminPass := GetAdminCreds()
+	isAdmin := username == adminUser && password == adminPass
+
+	author := adminAuthor
+	if !isAdmin {
+		author = FindTeacherID(username, password)
+	}
+
+	//see if teacher exists
+	if author == "notFound" {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid username and password combination!")
+		return
+	}
+
+	attempt := 0
+	if r.URL.Query().Get("attempt") != "" {
+		var err error
+		attempt, err = strconv.Atoi(r.URL.Query().Get("attempt"))
+		if err != nil || attempt < 1 {
+			responseCode = http.StatusBadRequest
+			w.WriteHeader(responseCode)
+			fmt.Fprint(w, "Invalid attempt! Must be a positive number!")
+			return
+		}
+	}
+
+	test := GetTest(requestVars["testID"])
+
+	if test == "notFound" {
+		responseCode = http.StatusNotFound
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "404 test not found!")
+		return
+	}
+
+	if status := GetTestStatus(requestVars["testID"]); status == testCancelled {
+		responseCode = http.StatusGone
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "This test has been cancelled! Its grades can no longer be amended.")
+		return
+	}
+
+	student := GetStudentObjectByID(requestVars["studentID"])
+
+	if student == "notFound" {
+		responseCode = http.StatusNotFound
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "404 student not found!")
+		return
+	}
+
+	studentUser, _ := jsonparser.GetString([]byte(student), "account", "userName")
+
+	grade := GetGrade(studentUser, requestVars["testID"], attempt)
+
+	if grade == "notFound" {
+		responseCode = http.StatusNotFound
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "404 grade not found")
+		return
+	}
+
+	gradingTeacher, _ := jsonparser.GetString([]byte(grade), "teacher", "account", "userName")
+	if !isAdmin && gradingTeacher != username {
+		responseCode = http.StatusForbidden
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Only the teacher who gave this grade, or an admin, can amend it!")
+		return
+	}
+
+	body, _ := ioutil.ReadAll(r.Body)
+
+	reason, _ := jsonparser.GetString(body, "reason")
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		responseCode = http.StatusBadRequest
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "A reason must be given for amending a grade!")
+		return
+	}
+
+	currentGrade, err := jsonparser.GetFloat(body, "currentGrade")
+	maximumGrade, _ := jsonparser.GetFloat([]byte(grade), "MAXIMUM_GRADE")
+	if err != nil || currentGrade < 0 || currentGrade > maximumGrade {
+		responseCode = http.StatusBadRequest
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid grade! Must be a number between 0 and "+strconv.FormatFloat(maximumGrade, 'f', -1, 64)+"!")
+		return
+	}
+
+	previousGrade, _ := jsonparser.GetFloat([]byte(grade), "currentGrade")
+	if previousGrade == currentGrade {
+		responseCode = http.StatusBadRequest
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "The grade already has this score!")
+		return
+	}
+
+	switch amendGradeScore(test, requestVars["testID"], requestVars["studentID"], []byte(grade), currentGrade, author,
+		reason) {
+	case gradeConflict:
+		responseCode = http.StatusConflict
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "The grade was changed in the meantime! Check its new score and try again.")
+		return
+	case gradeNotReplaced:
+		responseCode = http.StatusInternalServerError
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "The grade could not be amended!")
+		return
+	}
+
+	fmt.Fprint(w, "Grade amended!")
+
+	APILogger.WithFields(logrus.Fields{
+		"host":         r.RemoteAddr,
+		"userAgent":    r.UserAgent(),
+		"author":       author,
+		"studentID":    requestVars["studentID"],
+		"testID":       requestVars["testID"],
+		"responseCode": responseCode,
+	}).Info("amendGrade hit")
+}
+
+// getGradeHistory sends back the GradeHistory of a grade, i.e. its current score and mark along with every previous
+// version of it, whether amended or regraded, provided it is given the credentials of the student the grade was given
+// to or of a teacher of the course of the test.
+//
+// On tests that allow several attempts, the history of the grade of the latest graded attempt is sent back, unless a
+// specific attempt is requested with "?attempt=2".
+//
+// It will send back a Resource Not Found (404) response code if either the test, the student or the grade doesn't
+// exist.
+func getGradeHistory(w http.ResponseWriter, r *http.Request) {
+	requestVars := mux.Vars(r)
+	responseCode := http.StatusOK
+
+	username, password, authOK := r.BasicAuth()
+
+	if !authOK {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid authentication scheme!")
+		return
+	}
+
+	studentID := FindStudentID(username, password)
+	teacherID := FindTeacherID(username, password)
+
+	if studentID == "notFound" && teacherID == "notFound" {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid username and password combination!")
+		return
+	}
+
+	attempt := 0
+	if r.URL.Query().Get("attempt") != "" {
+		var err error
+		attempt, err = strconv.Atoi(r.URL.Query().Get("attempt"))
+		if err != nil || attempt < 1 {
+			responseCode = http.StatusBadRequest
+			w.WriteHeader(responseCode)
+			fmt.Fprint(w, "Invalid attempt! Must be a positive number!")
+			return
+		}
+	}
+
+	test := GetTest(requestVars["testID"])
+
+	if test == "notFound" {
+		responseCode = http.StatusNotFound
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "404 test not found!")
+		return
+	}
+
+	if studentID != requestVars["studentID"] && (teacherID == "notFound" || !teachesTest(teacherID, requestVars["testID"])) {
+		responseCode = http.StatusForbidden
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Only the student and the teachers of the course of this test can see the history of a grade!")
+		return
+	}
+
+	student := GetStudentObjectByID(requestVars["studentID"])
+
+	if student == "notFound" {
+		responseCode = http.StatusNotFound
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "404 student not found!")
+		return
+	}
+
+	studentUser, _ := jsonparser.GetString([]byte(student), "account", "userName")
+
+	grade := GetGrade(studentUser, requestVars["testID"], attempt)
+
+	if grade == "notFound" {
+		responseCode = http.StatusNotFound
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "404 grade not found")
+		return
+	}
+
+	history := buildGradeHistory(requestVars["testID"], requestVars["studentID"], []byte(grade), getTestGradeScale(test))
+
+	result, _ := json.Marshal(history)
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, string(result))
+
+	APILogger.WithFields(logrus.Fields{
+		"host":         r.RemoteAddr,
+		"userAgent":    r.UserAgent(),
+		"studentID":    requestVars["studentID"],
+		"testID":       requestVars["testID"],
+		"responseCode": responseCode,
+	}).Info("getGradeHistory hit")
+}
@@ -0,0 +1,467 @@
+/*
+ * This file is part of VianuEdu.
+ *
+ *  VianuEdu is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ *  VianuEdu is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with VianuEdu.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * Developed by Matei Gardus <matei@gardus.eu>
+ */
+
+package vianueduserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/buger/jsonparser"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// openGradeAppeal lets a student contest the score they got on a question of a graded test, provided it is given the
+// credentials of the student, along with the question and a message for the teacher who gave the grade, in a JSON body
+// such as {"question": "2", "message": "..."}. The ID of the new appeal is sent back.
+//
+// On tests that allow several attempts, the grade of the latest graded attempt is appealed, unless a specific attempt
+// is requested with "?attempt=2". A question can only have one open appeal at a time.
+//
+// It will send back a Resource Not Found (404) response code if either the test or the grade doesn't exist, and a Gone
+// (410) response code if the test or the grade has been cancelled.
+func openGradeAppeal(w http.ResponseWriter, r *http.Request) {
+	requestVars := mux.Vars(r)
+	responseCode := http.StatusOK
+
+	username, password, authOK := r.BasicAuth()
+
+	if !authOK {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid authentication scheme!")
+		return
+	}
+
+	studentID := FindStudentID(username, password)
+
+	//see if student exists
+	if studentID == "notFound" {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid username and password combination!")
+		return
+	}
+
+	attempt := 0
+	if r.URL.Query().Get("attempt") != "" {
+		var err error
+		attempt, err = strconv.Atoi(r.URL.Query().Get("attempt"))
+		if err != nil || attempt < 1 {
+			responseCode = http.StatusBadRequest
+			w.WriteHeader(responseCode)
+			fmt.Fprint(w, "Invalid attempt! Must be a positive number!")
+			return
+		}
+	}
+
+	if GetTest(requestVars["testID"]) == "notFound" {
+		responseCode = http.StatusNotFound
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "404 test not found!")
+		return
+	}
+
+	if status := GetTestStatus(requestVars["testID"]); status == testCancelled {
+		responseCode = http.StatusGone
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "This test has been cancelled! Its grades can no longer be appealed.")
+		return
+	}
+
+	grade := GetGrade(username, requestVars["testID"], attempt)
+
+	if grade == "notFound" {
+		responseCode = http.StatusNotFound
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "404 grade not found")
+		return
+	}
+
+	if cancelled, _ := jsonparser.GetBoolean([]byte(grade), "cancelled"); cancelled {
+		responseCode = http.StatusGone
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "This grade has been cancelled! It can no longer be appealed.")
+		return
+	}
+
+	body, _ := ioutil.ReadAll(r.Body)
+
+	// questions are numbered, so the number may be sent either as a string or as a number
+	question, _, _, err := jsonparser.Get(body, "question")
+	if err != nil || !gradeHasQuestion([]byte(grade), string(question)) {
+		responseCode = http.StatusBadRequest
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid question! Must be one of the questions of the test!")
+		return
+	}
+
+	message, _ := jsonparser.GetString(body, "message")
+	message = strings.TrimSpace(message)
+	if message == "" || utf8.RuneCountInString(message) > maxAppealMessage {
+		responseCode = http.StatusBadRequest
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid message! Must be between 1 and "+strconv.Itoa(maxAppealMessage)+" characters long!")
+		return
+	}
+
+	gradeID, _ := jsonparser.GetString([]byte(grade), "_id", "$oid")
+
+	if CountOpenGradeAppeals(gradeID, string(question)) > 0 {
+		responseCode = http.StatusConflict
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "This question already has an open appeal!")
+		return
+	}
+
+	teacherUser, _ := jsonparser.GetString([]byte(grade), "teacher", "account", "userName")
+
+	appealID, alreadyOpen := AddGradeAppeal(GradeAppeal{
+		GradeID:   gradeID,
+		TestID:    requestVars["testID"],
+		Course:    GetTestType(requestVars["testID"]),
+		StudentID: studentID,
+		Attempt:   getAttemptNumber([]byte(grade), "studentAnswerSheet"),
+		Question:  string(question),
+		Message:   message,
+		Teacher:   teacherUser,
+		Status:    appealOpen,
+		OpenedAt:  time.Now(),
+	})
+
+	if alreadyOpen {
+		responseCode = http.StatusConflict
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "This question already has an open appeal!")
+		return
+	}
+
+	if appealID == "" {
+		responseCode = http.StatusInternalServerError
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "The appeal could not be opened!")
+		return
+	}
+
+	fmt.Fprint(w, appealID)
+
+	APILogger.WithFields(logrus.Fields{
+		"host":         r.RemoteAddr,
+		"userAgent":    r.UserAgent(),
+		"studentID":    studentID,
+		"testID":       requestVars["testID"],
+		"appealID":     appealID,
+		"responseCode": responseCode,
+	}).Info("openGradeAppeal hit")
+}
+
+// listGradeAppeals sends back every appeal a student opened, oldest first, as a JSON array of GradeAppeal objects,
+// provided it is given the credentials of the student. The status of every appeal, along with the response of the
+// teacher once it is resolved, is part of it. The appeals of a single test are asked for with "?testID=T-000001".
+//
+// It will send back a Resource Not Found (404) response code if the student hasn't opened any appeal.
+func listGradeAppeals(w http.ResponseWriter, r *http.Request) {
+	responseCode := http.StatusOK
+
+	username, password, authOK := r.BasicAuth()
+
+	if !authOK {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid authentication scheme!")
+		return
+	}
+
+	studentID := FindStudentID(username, password)
+
+	//see if student exists
+	if studentID == "notFound" {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid username and password combination!")
+		return
+	}
+
+	appeals := ListStudentGradeAppeals(studentID, r.URL.Query().Get("testID"))
+
+	if len(appeals) == 0 {
+		responseCode = http.StatusNotFound
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "404 appeals not found!")
+	} else {
+		result, _ := json.Marshal(inSchoolTimezone(appeals))
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, string(result))
+	}
+
+	APILogger.WithFields(logrus.Fields{
+		"host":         r.RemoteAddr,
+		"userAgent":    r.UserAgent(),
+		"studentID":    studentID,
+		"responseCode": responseCode,
+	}).Info("listGradeAppeals hit")
+}
+
+// getOpenAppeals sends back the queue of a teacher, i.e. every appeal still open on the grades they gave on the tests
+// of a subject, oldest first, as a JSON array of GradeAppeal objects, provided it is given valid teacher credentials.
+// Appeals on tests that have since been cancelled are left out.
+//
+// It will send back a Resource Not Found (404) response code if there are no open appeals.
+func getOpenAppeals(w http.ResponseWriter, r *http.Request) {
+	requestVars := mux.Vars(r)
+	responseCode := http.StatusOK
+
+	username, password, authOK := r.BasicAuth()
+
+	if !authOK {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid authentication scheme!")
+		return
+	}
+
+	teacherID := FindTeacherID(username, password)
+
+	//see if teacher exists
+	if teacherID == "notFound" {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid username and password combination!")
+		return
+	}
+
+	if !strings.Contains("GeoPhiInfoMath", requestVars["subject"]) {
+		responseCode = http.StatusNotFound
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "404 course not found")
+		return
+	}
+
+	var appeals []GradeAppeal
+	for _, appeal := range ListOpenGradeAppeals(requestVars["subject"], username) {
+		if GetTestStatus(appeal.TestID) != testCancelled {
+			appeals = append(appeals, appeal)
+		}
+	}
+
+	if len(appeals) == 0 {
+		responseCode = http.StatusNotFound
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "404 appeals not found!")
+	} else {
+		result, _ := json.Marshal(inSchoolTimezone(appeals))
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, string(result))
+	}
+
+	APILogger.WithFields(logrus.Fields{
+		"host":         r.RemoteAddr,
+		"userAgent":    r.UserAgent(),
+		"teacherID":    teacherID,
+		"subject":      requestVars["subject"],
+		"responseCode": responseCode,
+	}).Info("getOpenAppeals hit")
+}
+
+// resolveGradeAppeal closes an open appeal, provided it is given the credentials of the teacher who gave the appealed
+// grade, along with the resolution and a response for the student, in a JSON body such as
+// {"resolution": "kept", "response": "..."}.
+//
+// Resolving an appeal with "amended" changes the score of the grade to the one sent along, as in
+// {"resolution": "amended", "response": "...", "currentGrade": 85}. The grade is amended as with amendGrade, the
+// response being the reason of the amendment.
+//
+// It will send back a Resource Not Found (404) response code if either the appeal or the appealed grade doesn't exist,
+// a Conflict (409) response code if the appeal has already been resolved, or is being resolved, and a Gone (410)
+// response code if its test has been cancelled. The appeal is claimed before the grade is amended, so that it is only
+// ever resolved once, and opened again if the grade couldn't be amended. Once the grade has been amended, the appeal
+// stays claimed even if its resolution can't be recorded.
+func resolveGradeAppeal(w http.ResponseWriter, r *http.Request) {
+	requestVars := mux.Vars(r)
+	responseCode := http.StatusOK
+
+	username, password, authOK := r.BasicAuth()
+
+	if !authOK {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid authentication scheme!")
+		return
+	}
+
+	teacherID := FindTeacherID(username, password)
+
+	//see if teacher exists
+	if teacherID == "notFound" {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid username and password combination!")
+		return
+	}
+
+	appeal, ok := GetGradeAppeal(requestVars["appealID"])
+
+	if !ok {
+		responseCode = http.StatusNotFound
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "404 appeal not found!")
+		return
+	}
+
+	if appeal.Teacher != username {
+		responseCode = http.StatusForbidden
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Only the teacher who gave the appealed grade can resolve this appeal!")
+		return
+	}
+
+	if appeal.Status != appealOpen {
+		responseCode = http.StatusConflict
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "This appeal has already been resolved!")
+		return
+	}
+
+	if status := GetTestStatus(appeal.TestID); status == testCancelled {
+		responseCode = http.StatusGone
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "This test has been cancelled! Its appeals can no longer be resolved.")
+		return
+	}
+
+	body, _ := ioutil.ReadAll(r.Body)
+
+	resolution, _ := jsonparser.GetString(body, "resolution")
+	if resolution != appealKept && resolution != appealAmended {
+		responseCode = http.StatusBadRequest
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid resolution! Must be either \""+appealKept+"\" or \""+appealAmended+"\"!")
+		return
+	}
+
+	response, _ := jsonparser.GetString(body, "response")
+	response = strings.TrimSpace(response)
+	if response == "" || utf8.RuneCountInString(response) > maxAppealMessage {
+		responseCode = http.StatusBadRequest
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid response! Must be between 1 and "+strconv.Itoa(maxAppealMessage)+" characters long!")
+		return
+	}
+
+	var (
+		amendedGrade *float64
+		test, grade  string
+	)
+
+	if resolution == appealAmended {
+		test = GetTest(appeal.TestID)
+		studentUser, _ := jsonparser.GetString([]byte(GetStudentObjectByID(appeal.StudentID)), "account", "userName")
+		grade = GetGrade(studentUser, appeal.TestID, appeal.Attempt)
+
+		if test == "notFound" || grade == "notFound" {
+			responseCode = http.StatusNotFound
+			w.WriteHeader(responseCode)
+			fmt.Fprint(w, "404 grade not found")
+			return
+		}
+
+		currentGrade, err := jsonparser.GetFloat(body, "currentGrade")
+		maximumGrade, _ := jsonparser.GetFloat([]byte(grade), "MAXIMUM_GRADE")
+		if err != nil || currentGrade < 0 || currentGrade > maximumGrade {
+			responseCode = http.StatusBadRequest
+			w.WriteHeader(responseCode)
+			fmt.Fprint(w, "Invalid grade! Must be a number between 0 and "+strconv.FormatFloat(maximumGrade, 'f', -1, 64)+"!")
+			return
+		}
+
+		if previousGrade, _ := jsonparser.GetFloat([]byte(grade), "currentGrade"); previousGrade == currentGrade {
+			responseCode = http.StatusBadRequest
+			w.WriteHeader(responseCode)
+			fmt.Fprint(w, "The grade already has this score! Resolve the appeal as \""+appealKept+"\" instead.")
+			return
+		}
+
+		amendedGrade = &currentGrade
+	}
+
+	if !ClaimGradeAppeal(appeal.ID) {
+		responseCode = http.StatusConflict
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "This appeal has already been resolved!")
+		return
+	}
+
+	if amendedGrade != nil {
+		reason := "Appeal on question " + appeal.Question + ": " + response
+		switch amendGradeScore(test, appeal.TestID, appeal.StudentID, []byte(grade), *amendedGrade, teacherID, reason) {
+		case gradeConflict:
+			ReleaseGradeAppeal(appeal.ID)
+			responseCode = http.StatusConflict
+			w.WriteHeader(responseCode)
+			fmt.Fprint(w, "The grade was changed in the meantime! Check its new score and try again.")
+			return
+		case gradeNotReplaced:
+			ReleaseGradeAppeal(appeal.ID)
+			responseCode = http.StatusInternalServerError
+			w.WriteHeader(responseCode)
+			fmt.Fprint(w, "The grade could not be amended!")
+			return
+		}
+	}
+
+	resolvedAt := time.Now()
+	resolved := ResolveGradeAppeal(appeal.ID, resolution, response, amendedGrade, resolvedAt)
+
+	// once the grade has been amended, opening the appeal again would let it be amended twice, so it is left claimed
+	for attempt := 1; !resolved && amendedGrade != nil && attempt < maxResolveAttempts; attempt++ {
+		resolved = ResolveGradeAppeal(appeal.ID, resolution, response, amendedGrade, resolvedAt)
+	}
+
+	if !resolved && amendedGrade != nil {
+		responseCode = http.StatusInternalServerError
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "The grade was amended, but the appeal could not be marked as resolved!")
+		return
+	}
+
+	if !resolved {
+		ReleaseGradeAppeal(appeal.ID)
+		responseCode = http.StatusInternalServerError
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "The appeal could not be resolved! Try again")
+		return
+	}
+
+	fmt.Fprint(w, "Appeal resolved!")
+
+	APILogger.WithFields(logrus.Fields{
+		"host":         r.RemoteAddr,
+		"userAgent":    r.UserAgent(),
+		"teacherID":    teacherID,
+		"appealID":     appeal.ID,
+		"resolution":   resolution,
+		"responseCode": responseCode,
+	}).Info("resolveGradeAppeal hit")
+}
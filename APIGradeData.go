@@ -20,6 +20,7 @@
 package vianueduserver
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/buger/jsonparser"
 	"github.com/gorilla/mux"
@@ -28,10 +29,19 @@ import (
 	"io/ioutil"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // getGrade obtains a grade from the database by querying for student ID and test ID.
 //
+// On tests that allow several attempts, the grade of the latest graded attempt is sent back, unless a specific attempt
+// is requested with "?attempt=2". The score that counts for the student is found through listAttempts.
+//
+// Every grade comes with its mark on the national scale ("mark"), next to its score. Grades given before marks were
+// stored get theirs converted with the grade scale of the test (see getTestGradeScale).
+//
 // It will send back a Resource Not Found (404) response code if there is no grade found.
 func getGrade(w http.ResponseWriter, r *http.Request) {
 	requestVars := mux.Vars(r)
@@ -40,10 +50,22 @@ func getGrade(w http.ResponseWriter, r *http.Request) {
 
 	user, _ := jsonparser.GetString([]byte(student), "account", "userName")
 
-	grade := GetGrade(user, requestVars["testID"])
-
 	responseCode := http.StatusOK
 
+	attempt := 0
+	if r.URL.Query().Get("attempt") != "" {
+		var err error
+		attempt, err = strconv.Atoi(r.URL.Query().Get("attempt"))
+		if err != nil || attempt < 1 {
+			responseCode = http.StatusBadRequest
+			w.WriteHeader(responseCode)
+			fmt.Fprint(w, "Invalid attempt! Must be a positive number!")
+			return
+		}
+	}
+
+	grade := GetGrade(user, requestVars["testID"], attempt)
+
 	if grade == "notFound" {
 		responseCode = http.StatusNotFound
 		w.WriteHeader(responseCode)
@@ -51,6 +73,11 @@ func getGrade(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if _, err := jsonparser.GetFloat([]byte(grade), "mark"); err != nil {
+		scale := getTestGradeScale(GetTest(requestVars["testID"]))
+		grade = string(withMark([]byte(grade), scale.gradeMark([]byte(grade))))
+	}
+
 	fmt.Fprint(w, grade)
 
 	APILogger.WithFields(logrus.Fields{
@@ -153,15 +180,32 @@ func submitGrade(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 
-			if GetGrade(studentUser, testID) != "notFound" {
+			if status := GetTestStatus(testID); status != testActive {
+				responseCode = http.StatusGone
+				w.WriteHeader(responseCode)
+				fmt.Fprint(w, "This test has been "+status+"! It no longer accepts grades.")
+				return
+			}
+
+			// every attempt is graded on its own, as found in the "attempt" of the graded answer sheet
+			if GetGrade(studentUser, testID, getAttemptNumber(body, "studentAnswerSheet")) != "notFound" {
 				responseCode = http.StatusAlreadyReported
 				w.WriteHeader(responseCode)
-				fmt.Fprint(w, "Cannot submit a grade after it has already been submitted!")
+				fmt.Fprint(w, "Cannot submit a grade after it has already been submitted! Use amendGrade to change it.")
 				return
 			}
 
+			// the mark is converted by the server, whatever the teacher sent
+			currentGrade, _ := jsonparser.GetFloat(body, "currentGrade")
+			maximumGrade, _ := jsonparser.GetFloat(body, "MAXIMUM_GRADE")
+			test := GetTest(testID)
+			body = withMark(body, getTestGradeScale(test).convertToMark(currentGrade, maximumGrade))
+
+			// grades belong to the term of their test, whenever they are given
+			body = withAcademicTerm(body, testTerm([]byte(test)))
+
 			AddGrade(string(body), testID)
-			fmt.Fprint(w, "Grade added! You can no longer add anything to this test!")
+			fmt.Fprint(w, "Grade added! You can no longer add anything to this attempt!")
 		}
 	}
 
@@ -174,11 +218,11 @@ func submitGrade(w http.ResponseWriter, r *http.Request) {
 	}).Info("submitGrade hit")
 }
 
-// getCurrentGrades obtains the grades that a student might have that have been added to the database for the last 150
-// days.
+// getCurrentGrades obtains the grades that a student got in the current academic year, or in another term of the
+// academic calendar asked for with "?year=2025-2026&semester=1" (see requestedTerm).
 //
-// The handler returns a Resource Not Found (404) status code if there are no grades to be found in the past 150 days.
-// Otherwise, the method returns the list of test IDs that the grades are attached to for later retrieval.
+// The handler returns a Resource Not Found (404) status code if the academic year doesn't exist. Otherwise, the method
+// returns the list of test IDs that the grades are attached to for later retrieval.
 func getCurrentGrades(w http.ResponseWriter, r *http.Request) {
 	requestVars := mux.Vars(r)
 
@@ -205,9 +249,17 @@ func getCurrentGrades(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	term, termCode, problem := requestedTerm(r)
+	if termCode != http.StatusOK {
+		responseCode = termCode
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, problem)
+		return
+	}
+
 	//let's go!
 	if responseCode == http.StatusOK {
-		grades := GetGradesForTest(username, password, requestVars["subject"])
+		grades := GetGradesForTest(username, password, requestVars["subject"], term)
 		fmt.Fprint(w, grades)
 	}
 
@@ -218,3 +270,805 @@ func getCurrentGrades(w http.ResponseWriter, r *http.Request) {
 		"responseCode": responseCode,
 	}).Info("getCurrentGrades hit")
 }
+
+// getTestResults sums up the grades given on a test for every class, provided it is given the credentials of a teacher
+// of the course of the test. Tests targeting several classes, student groups or individual students are still reported
+// class by class, each class being that of the graded students.
+//
+// It will send back a Forbidden (403) response code to other teachers, and a Resource Not Found (404) response code if
+// no grades have been given on the test.
+func getTestResults(w http.ResponseWriter, r *http.Request) {
+	requestVars := mux.Vars(r)
+	responseCode := http.StatusOK
+
+	username, password, authOK := r.BasicAuth()
+
+	teacherID := FindTeacherID(username, password)
+
+	if !authOK {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid authentication scheme!")
+		return
+	}
+
+	//see if teacher exists
+	if teacherID == "notFound" {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid username and password combination!")
+		return
+	}
+
+	if GetTestStatus(requestVars["testID"]) == "notFound" {
+		responseCode = http.StatusNotFound
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "404 test not found!")
+		return
+	}
+
+	if !teachesTest(teacherID, requestVars["testID"]) {
+		responseCode = http.StatusForbidden
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Only teachers of the course of this test can see its results!")
+		return
+	}
+
+	results := GetTestResultsByClass(requestVars["testID"])
+
+	if results == "notFound" {
+		responseCode = http.StatusNotFound
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "404 grades not found!")
+		return
+	}
+
+	fmt.Fprint(w, results)
+
+	APILogger.WithFields(logrus.Fields{
+		"host":         r.RemoteAddr,
+		"userAgent":    r.UserAgent(),
+		"teacherID":    teacherID,
+		"testID":       requestVars["testID"],
+		"responseCode": responseCode,
+	}).Info("getTestResults hit")
+}
+
+// regradeTest regrades every grade given on a test against its current answer key, provided it is given the
+// credentials of a teacher of the course of the test and the reason for the regrade, in a JSON body such as
+// {"reason": "..."}. It is meant to be used after correcting a wrong answer with correctTest.
+//
+// Objective questions whose answer changed are recomputed for every grade, while questions graded by hand keep their
+// score. The regrade is recorded in the regrade log, which states which of the changed grades were updated (see
+// ApplyRegrades). The handler sends back a RegradeReport with the score of every changed grade before and after the
+// regrade. With "?dryRun=true", the report is sent back without changing anything.
+func regradeTest(w http.ResponseWriter, r *http.Request) {
+	requestVars := mux.Vars(r)
+	responseCode := http.StatusOK
+
+	username, password, authOK := r.BasicAuth()
+
+	teacherID := FindTeacherID(username, password)
+
+	if !authOK {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid authentication scheme!")
+		return
+	}
+
+	//see if teacher exists
+	if teacherID == "notFound" {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid username and password combination!")
+		return
+	}
+
+	test := GetTest(requestVars["testID"])
+
+	if test == "notFound" {
+		responseCode = http.StatusNotFound
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "404 test not found!")
+		return
+	}
+
+	if !teachesTest(teacherID, requestVars["testID"]) {
+		responseCode = http.StatusForbidden
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Only teachers of the course of this test can regrade it!")
+		return
+	}
+
+	if status := GetTestStatus(requestVars["testID"]); status != testActive {
+		responseCode = http.StatusGone
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "This test has been "+status+"! It can no longer be regraded.")
+		return
+	}
+
+	body, _ := ioutil.ReadAll(r.Body)
+	reason, _ := jsonparser.GetString(body, "reason")
+
+	dryRun := r.URL.Query().Get("dryRun") == "true"
+
+	if !dryRun && strings.TrimSpace(reason) == "" {
+		responseCode = http.StatusBadRequest
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "A test can only be regraded by stating the reason for it!")
+		return
+	}
+
+	regrades, unchanged := computeRegrades(requestVars["testID"], test)
+
+	if !dryRun && !ApplyRegrades(requestVars["testID"], teacherID, reason, regrades) {
+		responseCode = http.StatusInternalServerError
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Oops! Some grades could not be regraded! The regrade log lists which ones were. Try again")
+		return
+	}
+
+	report, _ := json.Marshal(RegradeReport{
+		TestID:    requestVars["testID"],
+		DryRun:    dryRun,
+		Unchanged: unchanged,
+		Changes:   regrades,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, string(report))
+
+	APILogger.WithFields(logrus.Fields{
+		"host":         r.RemoteAddr,
+		"userAgent":    r.UserAgent(),
+		"teacherID":    teacherID,
+		"testID":       requestVars["testID"],
+		"dryRun":       dryRun,
+		"regraded":     len(regrades),
+		"responseCode": responseCode,
+	}).Info("regradeTest hit")
+}
+
+// getItemAnalysis sends back the item analysis of a test, computed from all of its answer sheets and grades, provided
+// it is given the credentials of a teacher of the course of the test. See ItemAnalysis for the statistics it holds.
+//
+// The analysis is sent back as JSON, unless "?format=csv" is requested. The CSV output holds the statistics of every
+// question, or the score distribution of the test with "&table=scores".
+func getItemAnalysis(w http.ResponseWriter, r *http.Request) {
+	requestVars := mux.Vars(r)
+	responseCode := http.StatusOK
+
+	username, password, authOK := r.BasicAuth()
+
+	teacherID := FindTeacherID(username, password)
+
+	if !authOK {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid authentication scheme!")
+		return
+	}
+
+	//see if teacher exists
+	if teacherID == "notFound" {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid username and password combination!")
+		return
+	}
+
+	test := GetTest(requestVars["testID"])
+
+	if test == "notFound" {
+		responseCode = http.StatusNotFound
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "404 test not found!")
+		return
+	}
+
+	if !teachesTest(teacherID, requestVars["testID"]) {
+		responseCode = http.StatusForbidden
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Only teachers of the course of this test can analyze it!")
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	table := r.URL.Query().Get("table")
+
+	if (format != "" && format != "json" && format != "csv") || (table != "" && table != "questions" && table != "scores") {
+		responseCode = http.StatusBadRequest
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid format! Format must be json or csv, and table must be questions or scores!")
+		return
+	}
+
+	analysis := analyzeTest(requestVars["testID"], test)
+
+	var err error
+	switch {
+	case format == "csv" && table == "scores":
+		w.Header().Set("Content-Type", "text/csv")
+		err = writeScoreDistributionCSV(w, analysis)
+	case format == "csv":
+		w.Header().Set("Content-Type", "text/csv")
+		err = writeItemAnalysisCSV(w, analysis)
+	default:
+		result, _ := json.Marshal(analysis)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, string(result))
+	}
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error":  err,
+			"testID": requestVars["testID"],
+		}).Warn("Cannot write item analysis as CSV!")
+	}
+
+	APILogger.WithFields(logrus.Fields{
+		"host":         r.RemoteAddr,
+		"userAgent":    r.UserAgent(),
+		"teacherID":    teacherID,
+		"testID":       requestVars["testID"],
+		"format":       format,
+		"responseCode": responseCode,
+	}).Info("getItemAnalysis hit")
+}
+
+// getMatchingReview sends back a MatchingReview of the free-text questions of a test with matching rules, provided it
+// is given the credentials of a teacher of the course of the test. Every distinct answer is listed once, along with
+// how many students gave it and whether the auto-grader took it as right, so that the teacher can spot its mistakes
+// and fix the matching rules of the question.
+func getMatchingReview(w http.ResponseWriter, r *http.Request) {
+	requestVars := mux.Vars(r)
+	responseCode := http.StatusOK
+
+	username, password, authOK := r.BasicAuth()
+
+	teacherID := FindTeacherID(username, password)
+
+	if !authOK {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid authentication scheme!")
+		return
+	}
+
+	//see if teacher exists
+	if teacherID == "notFound" {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid username and password combination!")
+		return
+	}
+
+	test := GetTest(requestVars["testID"])
+
+	if test == "notFound" {
+		responseCode = http.StatusNotFound
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "404 test not found!")
+		return
+	}
+
+	if !teachesTest(teacherID, requestVars["testID"]) {
+		responseCode = http.StatusForbidden
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Only teachers of the course of this test can review how its answers were matched!")
+		return
+	}
+
+	result, _ := json.Marshal(reviewAnswerMatching(requestVars["testID"], test))
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, string(result))
+
+	APILogger.WithFields(logrus.Fields{
+		"host":         r.RemoteAddr,
+		"userAgent":    r.UserAgent(),
+		"teacherID":    teacherID,
+		"testID":       requestVars["testID"],
+		"responseCode": responseCode,
+	}).Info("getMatchingReview hit")
+}
+
+// exportTestResults sends back the results of a test as CSV, one student per line and one column per question, provided
+// it is given the credentials of a teacher of the course of the test. See writeTestResultsCSV for its columns.
+func exportTestResults(w http.ResponseWriter, r *http.Request) {
+	requestVars := mux.Vars(r)
+	responseCode := http.StatusOK
+
+	username, password, authOK := r.BasicAuth()
+
+	teacherID := FindTeacherID(username, password)
+
+	if !authOK {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid authentication scheme!")
+		return
+	}
+
+	//see if teacher exists
+	if teacherID == "notFound" {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid username and password combination!")
+		return
+	}
+
+	test := GetTest(requestVars["testID"])
+
+	if test == "notFound" {
+		responseCode = http.StatusNotFound
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "404 test not found!")
+		return
+	}
+
+	if !teachesTest(teacherID, requestVars["testID"]) {
+		responseCode = http.StatusForbidden
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Only teachers of the course of this test can export its results!")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+requestVars["testID"]+`-results.csv"`)
+
+	err := writeTestResultsCSV(w, requestVars["testID"], test)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error":  err,
+			"testID": requestVars["testID"],
+		}).Warn("Cannot write test results as CSV!")
+	}
+
+	APILogger.WithFields(logrus.Fields{
+		"host":         r.RemoteAddr,
+		"userAgent":    r.UserAgent(),
+		"teacherID":    teacherID,
+		"testID":       requestVars["testID"],
+		"responseCode": responseCode,
+	}).Info("exportTestResults hit")
+}
+
+// listAttempts sends back an AttemptSummary of every attempt the student whose credentials are provided made on a test,
+// along with the score that counts for them under the scoring policy of the test.
+//
+// It will send back a Resource Not Found (404) response code if the test doesn't exist.
+func listAttempts(w http.ResponseWriter, r *http.Request) {
+	requestVars := mux.Vars(r)
+	responseCode := http.StatusOK
+
+	username, password, authOK := r.BasicAuth()
+
+	studentID := FindStudentID(username, password)
+
+	if !authOK {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid authentication scheme!")
+		return
+	}
+
+	//see if student exists
+	if studentID == "notFound" {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid username and password combination!")
+		return
+	}
+
+	test := GetTest(requestVars["testID"])
+
+	if test == "notFound" {
+		responseCode = http.StatusNotFound
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "404 test not found!")
+		return
+	}
+
+	summary := summarizeAttempts(requestVars["testID"], test, studentID, username)
+
+	result, _ := json.Marshal(summary)
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, string(result))
+
+	APILogger.WithFields(logrus.Fields{
+		"host":         r.RemoteAddr,
+		"userAgent":    r.UserAgent(),
+		"studentID":    studentID,
+		"testID":       requestVars["testID"],
+		"responseCode": responseCode,
+	}).Info("listAttempts hit")
+}
+
+// listStudentAttempts sends back an AttemptSummary of every attempt a student made on a test, provided it is given the
+// credentials of a teacher of the course of the test.
+//
+// It will send back a Resource Not Found (404) response code if either the test or the student doesn't exist.
+func listStudentAttempts(w http.ResponseWriter, r *http.Request) {
+	requestVars := mux.Vars(r)
+	responseCode := http.StatusOK
+
+	username, password, authOK := r.BasicAuth()
+
+	teacherID := FindTeacherID(username, password)
+
+	if !authOK {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid authentication scheme!")
+		return
+	}
+
+	//see if teacher exists
+	if teacherID == "notFound" {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid username and password combination!")
+		return
+	}
+
+	test := GetTest(requestVars["testID"])
+
+	if test == "notFound" {
+		responseCode = http.StatusNotFound
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "404 test not found!")
+		return
+	}
+
+	student := GetStudentObjectByID(requestVars["studentID"])
+
+	if student == "notFound" {
+		responseCode = http.StatusNotFound
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "404 student not found!")
+		return
+	}
+
+	if !teachesTest(teacherID, requestVars["testID"]) {
+		responseCode = http.StatusForbidden
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Only teachers of the course of this test can see the attempts made on it!")
+		return
+	}
+
+	studentUser, _ := jsonparser.GetString([]byte(student), "account", "userName")
+
+	summary := summarizeAttempts(requestVars["testID"], test, requestVars["studentID"], studentUser)
+
+	result, _ := json.Marshal(summary)
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, string(result))
+
+	APILogger.WithFields(logrus.Fields{
+		"host":         r.RemoteAddr,
+		"userAgent":    r.UserAgent(),
+		"teacherID":    teacherID,
+		"studentID":    requestVars["studentID"],
+		"testID":       requestVars["testID"],
+		"responseCode": responseCode,
+	}).Info("listStudentAttempts hit")
+}
+
+// getGradeScale sends back the grade scale the scores of a course are converted to marks with, provided it is given
+// valid teacher credentials. Courses without a grade scale of their own use the default grade scale, which is sent
+// back instead. See GradeScale for how scores are converted.
+func getGradeScale(w http.ResponseWriter, r *http.Request) {
+	requestVars := mux.Vars(r)
+	responseCode := http.StatusOK
+
+	username, password, authOK := r.BasicAuth()
+
+	teacherID := FindTeacherID(username, password)
+
+	if !authOK {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid authentication scheme!")
+		return
+	}
+
+	//see if teacher exists
+	if teacherID == "notFound" {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid username and password combination!")
+		return
+	}
+
+	if !strings.Contains("GeoPhiInfoMath", requestVars["course"]) {
+		responseCode = http.StatusNotFound
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "404 course not found")
+		return
+	}
+
+	scale, _ := json.Marshal(getCourseGradeScale(requestVars["course"]))
+
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, string(scale))
+
+	APILogger.WithFields(logrus.Fields{
+		"host":         r.RemoteAddr,
+		"userAgent":    r.UserAgent(),
+		"teacherID":    teacherID,
+		"course":       requestVars["course"],
+		"responseCode": responseCode,
+	}).Info("getGradeScale hit")
+}
+
+// setGradeScale sets the grade scale the scores of a course are converted to marks with, provided the credentials match
+// with the ones saved inside of the HTTPServer.json configuration file. The grade scale is sent as a JSON GradeScale
+// object, such as {"exOfficio": 1, "rounding": "nearest"}.
+//
+// Tests with a grade scale of their own keep using it, and marks already given are kept as they are.
+func setGradeScale(w http.ResponseWriter, r *http.Request) {
+	requestVars := mux.Vars(r)
+	responseCode := http.StatusOK
+
+	username, password, authOK := r.BasicAuth()
+
+	user, pass := GetAdminCreds()
+
+	if !authOK || (username != user || password != pass) {
+		responseCode = http.StatusUnauthorized
+		w.Header().Set("WWW-Authenticate", `Basic realm="Access to the admin section"`)
+		http.Error(w, "Invalid authentication scheme!", responseCode)
+		return
+	}
+
+	if !strings.Contains("GeoPhiInfoMath", requestVars["course"]) {
+		responseCode = http.StatusNotFound
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "404 course not found")
+		return
+	}
+
+	body, _ := ioutil.ReadAll(r.Body)
+
+	if problem := validateGradeScale(body); problem != "" {
+		responseCode = http.StatusBadRequest
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, problem)
+		return
+	}
+
+	scale, _ := readGradeScale(body)
+	document, _ := json.Marshal(scale)
+
+	SetGradeScale(requestVars["course"], string(document))
+	fmt.Fprint(w, "Grade scale set!")
+
+	APILogger.WithFields(logrus.Fields{
+		"host":         r.RemoteAddr,
+		"userAgent":    r.UserAgent(),
+		"course":       requestVars["course"],
+		"responseCode": responseCode,
+	}).Info("setGradeScale hit")
+}
+
+// getAverages sends back the StudentAverages of a student, i.e. their average in every subject over every semester of
+// the current academic year and their yearly averages, or over a single semester if one is requested with
+// "?semester=2". Another academic year can be asked for with "?year=2025-2026". Averages below 5 are marked as
+// failing. See computeSubjectAverage for how the averages are computed.
+//
+// The averages of a student can be seen by the student themselves, by their parents and by their homeroom teacher,
+// i.e. the teacher of their class.
+//
+// It will send back a Resource Not Found (404) response code if either the student or the academic year doesn't exist.
+func getAverages(w http.ResponseWriter, r *http.Request) {
+	requestVars := mux.Vars(r)
+	responseCode := http.StatusOK
+
+	username, password, authOK := r.BasicAuth()
+
+	if !authOK {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid authentication scheme!")
+		return
+	}
+
+	studentID := FindStudentID(username, password)
+	parentID := FindParentID(username, password)
+	teacherID := FindTeacherID(username, password)
+
+	if studentID == "notFound" && parentID == "notFound" && teacherID == "notFound" {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid username and password combination!")
+		return
+	}
+
+	student := GetStudentObjectByID(requestVars["studentID"])
+
+	if student == "notFound" {
+		responseCode = http.StatusNotFound
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "404 student not found!")
+		return
+	}
+
+	allowed := studentID == requestVars["studentID"] ||
+		(parentID != "notFound" && IsParentOf(parentID, requestVars["studentID"])) ||
+		(teacherID != "notFound" && isHomeroomTeacher(GetTeacherObjectByID(teacherID), student))
+
+	if !allowed {
+		responseCode = http.StatusForbidden
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Only the student, their parents and their homeroom teacher can see their averages!")
+		return
+	}
+
+	yearName := r.URL.Query().Get("year")
+	if yearName == "" {
+		yearName = "current"
+	}
+
+	year, ok := findAcademicYear(yearName)
+	if !ok {
+		responseCode = http.StatusNotFound
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "404 academic year not found!")
+		return
+	}
+
+	terms := year.terms()
+
+	if semester := r.URL.Query().Get("semester"); semester != "" {
+		number, err := strconv.Atoi(semester)
+		if err != nil || number < 1 || number > len(terms) {
+			responseCode = http.StatusBadRequest
+			w.WriteHeader(responseCode)
+			fmt.Fprint(w, "Invalid semester! Must be a number between 1 and "+strconv.Itoa(len(terms))+"!")
+			return
+		}
+		terms = terms[number-1 : number]
+	}
+
+	studentUser, _ := jsonparser.GetString([]byte(student), "account", "userName")
+
+	averages := computeStudentAverages(requestVars["studentID"], studentUser, year, terms)
+
+	result, _ := json.Marshal(averages)
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, string(result))
+
+	APILogger.WithFields(logrus.Fields{
+		"host":         r.RemoteAddr,
+		"userAgent":    r.UserAgent(),
+		"studentID":    requestVars["studentID"],
+		"year":         year.Year,
+		"semester":     r.URL.Query().Get("semester"),
+		"responseCode": responseCode,
+	}).Info("getAverages hit")
+}
+
+// isHomeroomTeacher checks whether a Teacher object is the homeroom teacher of the class of a Student object, i.e.
+// whether they share the same grade and grade letter.
+func isHomeroomTeacher(teacher, student string) bool {
+	if teacher == "notFound" {
+		return false
+	}
+
+	teacherGrade, err1 := jsonparser.GetInt([]byte(teacher), "grade")
+	teacherLetter, err2 := jsonparser.GetString([]byte(teacher), "gradeLetter")
+	studentGrade, _ := jsonparser.GetInt([]byte(student), "grade")
+	studentLetter, _ := jsonparser.GetString([]byte(student), "gradeLetter")
+
+	return err1 == nil && err2 == nil && teacherGrade == studentGrade && teacherLetter == studentLetter
+}
+
+// getGradebook sends back the Gradebook of a class for a course, i.e. the results of every student of the class on
+// every test of the course, along with their averages, provided it is given the credentials of a teacher of the course
+// or of the homeroom teacher of the class.
+//
+// The gradebook covers the current semester, unless another term of the academic calendar is asked for with
+// "?year=2025-2026&semester=1" (see requestedTerm). Asking for "?format=csv" sends it back as CSV instead of JSON (see
+// writeGradebookCSV).
+//
+// It will send back a Resource Not Found (404) response code if either the course or the academic year doesn't exist.
+func getGradebook(w http.ResponseWriter, r *http.Request) {
+	requestVars := mux.Vars(r)
+	responseCode := http.StatusOK
+
+	username, password, authOK := r.BasicAuth()
+
+	teacherID := FindTeacherID(username, password)
+
+	if !authOK {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid authentication scheme!")
+		return
+	}
+
+	//see if teacher exists
+	if teacherID == "notFound" {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid username and password combination!")
+		return
+	}
+
+	if !strings.Contains("GeoPhiInfoMath", requestVars["subject"]) {
+		responseCode = http.StatusNotFound
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "404 course not found")
+		return
+	}
+
+	grade, err := strconv.Atoi(requestVars["grade"])
+	if err != nil || grade < 9 || grade > 12 {
+		responseCode = http.StatusBadRequest
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid grade! Must be between 9-12!")
+		return
+	}
+
+	teacher := GetTeacherObjectByID(teacherID)
+	course, _ := jsonparser.GetString([]byte(teacher), "course")
+	class := `{"grade": ` + strconv.Itoa(grade) + `, "gradeLetter": ` + strconv.Quote(requestVars["gradeLetter"]) + `}`
+
+	if course != requestVars["subject"] && !isHomeroomTeacher(teacher, class) {
+		responseCode = http.StatusForbidden
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Only teachers of the course and the homeroom teacher of the class can see its gradebook!")
+		return
+	}
+
+	term, termCode, problem := requestedTerm(r)
+	if termCode != http.StatusOK {
+		responseCode = termCode
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, problem)
+		return
+	}
+
+	// the gradebook covers a single semester, so that the averages in it are term averages
+	if term.Year != "" && term.Number == 0 {
+		year, _ := findAcademicYear(term.Year)
+		term = year.currentTerm(time.Now())
+	}
+
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "csv" {
+		responseCode = http.StatusBadRequest
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid format! Must be json or csv!")
+		return
+	}
+
+	gradebook := buildGradebook(requestVars["subject"], grade, requestVars["gradeLetter"], term)
+
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+requestVars["subject"]+"-"+
+			requestVars["grade"]+requestVars["gradeLetter"]+`-gradebook.csv"`)
+
+		err := writeGradebookCSV(w, gradebook)
+		if err != nil {
+			APILogger.WithFields(logrus.Fields{
+				"error": err,
+			}).Warn("Cannot write gradebook as CSV!")
+		}
+	} else {
+		result, _ := json.Marshal(gradebook)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, string(result))
+	}
+
+	APILogger.WithFields(logrus.Fields{
+		"host":         r.RemoteAddr,
+		"userAgent":    r.UserAgent(),
+		"teacherID":    teacherID,
+		"class":        requestVars["grade"] + requestVars["gradeLetter"],
+		"course":       requestVars["subject"],
+		"format":       format,
+		"responseCode": responseCode,
+	}).Info("getGradebook hit")
+}
@@ -21,6 +21,7 @@ package vianueduserver
 
 import (
 	"fmt"
+	"github.com/buger/jsonparser"
 	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
 	"github.com/xeipuuv/gojsonschema"
@@ -35,12 +36,24 @@ import (
 //
 // Currently, the grades are only between 9 and 12. This is mostly due to the fact that, as the project stands, it will
 // be highly unlikely that any 1-8th grade will use this educational software.
+//
+// Only the lessons of the current academic year are listed, unless another one is asked for with "?year=2025-2026"
+// (see requestedTerm).
 func listLessons(w http.ResponseWriter, r *http.Request) {
 	requestVars := mux.Vars(r)
 	responseCode := http.StatusOK
 
+	term, termCode, problem := requestedTerm(r)
+
 	grade, err := strconv.Atoi(requestVars["grade"])
-	lessonList := ListLessons(requestVars["subject"], grade)
+	lessonList := ListLessons(requestVars["subject"], grade, term)
+
+	if termCode != http.StatusOK {
+		responseCode = termCode
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, problem)
+		goto log
+	}
 
 	if err != nil || (grade < 9 || grade > 12) {
 		responseCode = http.StatusBadRequest
@@ -99,6 +112,8 @@ func getLesson(w http.ResponseWriter, r *http.Request) {
 //
 // Should the credentials provided be invalid, the HTTP handler responds with a Unauthorized (401) response code.
 // Currently, the function only allows the upload of PNG files.
+//
+// Lessons are scoped to an academic year of the academic calendar (see lessonTerm).
 func uploadLesson(w http.ResponseWriter, r *http.Request) {
 	requestVars := mux.Vars(r)
 
@@ -157,7 +172,7 @@ func uploadLesson(w http.ResponseWriter, r *http.Request) {
 		}
 
 		if validation.Valid() {
-			AddLesson(requestVars["course"], string(body))
+			AddLesson(requestVars["course"], string(withAcademicTerm(body, lessonTerm(body))))
 
 			fmt.Fprint(w, "Lesson uploaded!")
 		}
@@ -170,3 +185,21 @@ func uploadLesson(w http.ResponseWriter, r *http.Request) {
 		"responseCode": responseCode,
 	}).Info("uploadLesson hit")
 }
+
+// lessonTerm returns the academic year a lesson is scoped to, which is the one it names ("academicYear") or else the
+// current one, so that lessons prepared over the summer can be scoped to the coming academic year.
+func lessonTerm(lesson []byte) Term {
+	name, err := jsonparser.GetString(lesson, "academicYear")
+	if err != nil {
+		name = "current"
+	}
+
+	if year, ok := findAcademicYear(name); ok {
+		return year.wholeYear()
+	}
+	if year, ok := findAcademicYear("current"); ok {
+		return year.wholeYear()
+	}
+
+	return Term{}
+}
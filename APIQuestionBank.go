@@ -0,0 +1,587 @@
+/*
+ * This file is part of VianuEdu.
+ *
+ *  VianuEdu is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ *  VianuEdu is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with VianuEdu.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * Developed by Matei Gardus <matei@gardus.eu>
+ */
+
+package vianueduserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/buger/jsonparser"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/xeipuuv/gojsonschema"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// addBankQuestion adds a question to the question bank of the course provided in the request URL, provided it is given
+// valid teacher credentials.
+//
+// Should the credentials provided be invalid, the HTTP handler responds with a Unauthorized (401) response code.
+// If the question isn't valid JSON for a Question object, or if its difficulty isn't one of "easy", "medium" or "hard",
+// the handler responds with a Bad Request (400) response code. Otherwise, it sends back the ID of the new question.
+func addBankQuestion(w http.ResponseWriter, r *http.Request) {
+	requestVars := mux.Vars(r)
+
+	//first we strip out the authentication from the header
+	username, password, authOK := r.BasicAuth()
+
+	responseCode := http.StatusOK
+
+	teacherID := FindTeacherID(username, password)
+
+	templateFile, _ := os.Open("templates/QuestionTemplate.json")
+
+	questionID := ""
+
+	//then we check to see if authOK
+	if !authOK {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid authentication scheme!")
+		return
+	}
+
+	//see if teacher exists
+	if teacherID == "notFound" {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid username and password combination!")
+		return
+	}
+
+	if !strings.Contains("GeoPhiInfoMath", requestVars["course"]) {
+		responseCode = http.StatusNotFound
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "404 course not found")
+		return
+	}
+
+	//validate JSON!
+	// we pretty much only care for the final error, since the rest of the stuff here is unlikely to ever fail randomly.
+	templateString, _ := ioutil.ReadAll(templateFile)
+
+	questionTemplate := gojsonschema.NewStringLoader(string(templateString))
+
+	body, _ := ioutil.ReadAll(r.Body)
+
+	questionResponse := gojsonschema.NewStringLoader(string(body))
+
+	validation, err := gojsonschema.Validate(questionTemplate, questionResponse)
+	if err != nil || !validation.Valid() {
+		APILogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Warn("Could not validate JSON schema and document for adding question!")
+		responseCode = http.StatusBadRequest
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid Question object!")
+		return
+	}
+
+	difficulty, _ := jsonparser.GetString(body, "difficulty")
+	if difficulty != "easy" && difficulty != "medium" && difficulty != "hard" {
+		responseCode = http.StatusBadRequest
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid difficulty! Must be one of easy, medium or hard!")
+		return
+	}
+
+	course, _ := jsonparser.GetString(body, "course")
+	if course != requestVars["course"] {
+		responseCode = http.StatusBadRequest
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Cannot add a question from another course to this question bank!")
+		return
+	}
+
+	questionID = AddBankQuestion(requestVars["course"], string(body), teacherID)
+	if questionID == "" {
+		responseCode = http.StatusInternalServerError
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Oops! We messed up somewhere! Sorry! Try again")
+		return
+	}
+
+	fmt.Fprint(w, questionID)
+
+	APILogger.WithFields(logrus.Fields{
+		"host":         r.RemoteAddr,
+		"userAgent":    r.UserAgent(),
+		"teacherID":    teacherID,
+		"questionID":   questionID,
+		"responseCode": responseCode,
+	}).Info("addBankQuestion hit")
+}
+
+// getBankQuestion sends back a question from the question bank of the provided course. Only teachers can read the
+// question bank, since questions contain their answers.
+//
+// It will send back a Resource Not Found (404) response code if there is no question found.
+func getBankQuestion(w http.ResponseWriter, r *http.Request) {
+	requestVars := mux.Vars(r)
+	responseCode := http.StatusOK
+
+	username, password, authOK := r.BasicAuth()
+
+	teacherID := FindTeacherID(username, password)
+
+	if !authOK {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid authentication scheme!")
+		return
+	}
+
+	//see if teacher exists
+	if teacherID == "notFound" {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid username and password combination!")
+		return
+	}
+
+	if !strings.Contains("GeoPhiInfoMath", requestVars["course"]) {
+		responseCode = http.StatusNotFound
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "404 course not found")
+		return
+	}
+
+	question := GetBankQuestion(requestVars["course"], requestVars["questionID"])
+
+	if question == "notFound" {
+		responseCode = http.StatusNotFound
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "404 question not found!")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, question)
+
+	APILogger.WithFields(logrus.Fields{
+		"host":         r.RemoteAddr,
+		"userAgent":    r.UserAgent(),
+		"teacherID":    teacherID,
+		"questionID":   requestVars["questionID"],
+		"responseCode": responseCode,
+	}).Info("getBankQuestion hit")
+}
+
+// listBankQuestions lists the IDs of the questions in the question bank of the provided course.
+//
+// The list can be filtered through the "tag", "difficulty" and "grade" query parameters, i.e.
+// /api/listBankQuestions/Geo?tag=relief&difficulty=easy
+func listBankQuestions(w http.ResponseWriter, r *http.Request) {
+	requestVars := mux.Vars(r)
+	responseCode := http.StatusOK
+
+	username, password, authOK := r.BasicAuth()
+
+	teacherID := FindTeacherID(username, password)
+
+	if !authOK {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid authentication scheme!")
+		return
+	}
+
+	//see if teacher exists
+	if teacherID == "notFound" {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid username and password combination!")
+		return
+	}
+
+	if !strings.Contains("GeoPhiInfoMath", requestVars["course"]) {
+		responseCode = http.StatusNotFound
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "404 course not found")
+		return
+	}
+
+	filters := r.URL.Query()
+
+	grade := 0
+	if filters.Get("grade") != "" {
+		var err error
+		grade, err = strconv.Atoi(filters.Get("grade"))
+		if err != nil || (grade < 9 || grade > 12) {
+			responseCode = http.StatusBadRequest
+			w.WriteHeader(responseCode)
+			fmt.Fprint(w, "Invalid grade! Must be between 9-12!")
+			return
+		}
+	}
+
+	questions := ListBankQuestions(requestVars["course"], filters.Get("tag"), filters.Get("difficulty"), grade)
+
+	if questions == "notFound" {
+		responseCode = http.StatusNotFound
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "404 questions not found!")
+		return
+	}
+
+	fmt.Fprint(w, questions)
+
+	APILogger.WithFields(logrus.Fields{
+		"host":         r.RemoteAddr,
+		"userAgent":    r.UserAgent(),
+		"teacherID":    teacherID,
+		"course":       requestVars["course"],
+		"responseCode": responseCode,
+	}).Info("listBankQuestions hit")
+}
+
+// importQuestions converts a Moodle XML file, a GIFT file or an IMS QTI 2.1 package, sent as the request body, into
+// questions of the course provided in the request URL, provided it is given valid teacher credentials.
+//
+// The format of the file is given through the "format" query parameter, one of "moodle", "gift" or "qti". By default,
+// the questions are gathered in a Test object, which is sent back for the teacher to complete and create. With
+// "target=bank", they are added to the question bank instead, with the difficulty and grade given through the
+// "difficulty" and "grade" query parameters, i.e. /api/importQuestions/Geo?format=gift&target=bank&difficulty=easy&grade=12
+//
+// Either way, the handler sends back an ImportReport, which lists the questions that couldn't be imported and why.
+// Files larger than maxImportSize are answered with a Request Entity Too Large (413) response code.
+func importQuestions(w http.ResponseWriter, r *http.Request) {
+	requestVars := mux.Vars(r)
+	responseCode := http.StatusOK
+
+	username, password, authOK := r.BasicAuth()
+
+	teacherID := FindTeacherID(username, password)
+
+	if !authOK {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid authentication scheme!")
+		return
+	}
+
+	//see if teacher exists
+	if teacherID == "notFound" {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid username and password combination!")
+		return
+	}
+
+	if !strings.Contains("GeoPhiInfoMath", requestVars["course"]) {
+		responseCode = http.StatusNotFound
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "404 course not found")
+		return
+	}
+
+	options := r.URL.Query()
+
+	format := options.Get("format")
+	if format != "moodle" && format != "gift" && format != "qti" {
+		responseCode = http.StatusBadRequest
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid format! Must be one of moodle, gift or qti!")
+		return
+	}
+
+	target := options.Get("target")
+	if target == "" {
+		target = "test"
+	}
+	if target != "test" && target != "bank" {
+		responseCode = http.StatusBadRequest
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid target! Must be one of test or bank!")
+		return
+	}
+
+	difficulty := options.Get("difficulty")
+	grade := 0
+	if target == "bank" {
+		if difficulty != "easy" && difficulty != "medium" && difficulty != "hard" {
+			responseCode = http.StatusBadRequest
+			w.WriteHeader(responseCode)
+			fmt.Fprint(w, "Invalid difficulty! Must be one of easy, medium or hard!")
+			return
+		}
+
+		var err error
+		grade, err = strconv.Atoi(options.Get("grade"))
+		if err != nil || (grade < 9 || grade > 12) {
+			responseCode = http.StatusBadRequest
+			w.WriteHeader(responseCode)
+			fmt.Fprint(w, "Invalid grade! Must be between 9-12!")
+			return
+		}
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxImportSize))
+	if err != nil {
+		responseCode = http.StatusRequestEntityTooLarge
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "File too large! Questions can only be imported from files of up to "+
+			strconv.Itoa(maxImportSize>>20)+" MB!")
+		return
+	}
+
+	questions, skipped := convertQuestionFile(format, body)
+
+	report := ImportReport{Format: format, Target: target, Skipped: skipped}
+	if report.Skipped == nil {
+		report.Skipped = []SkippedQuestion{}
+	}
+
+	if target == "test" {
+		report.Test = importedTest(requestVars["course"], questions)
+		report.Imported = len(questions)
+	} else {
+		for _, question := range questions {
+			document, _ := json.Marshal(struct {
+				importedQuestion
+				Course     string `json:"course"`
+				Difficulty string `json:"difficulty"`
+				Grade      int    `json:"grade"`
+			}{question, requestVars["course"], difficulty, grade})
+
+			questionID := AddBankQuestion(requestVars["course"], string(document), teacherID)
+			if questionID == "" {
+				report.Skipped = append(report.Skipped, SkippedQuestion{Name: question.Question,
+					QuestionType: question.QuestionType, Reason: "The question couldn't be added to the question bank."})
+				continue
+			}
+
+			report.QuestionIDs = append(report.QuestionIDs, questionID)
+			report.Imported++
+		}
+	}
+
+	if report.Imported == 0 && len(report.Skipped) == 0 {
+		responseCode = http.StatusBadRequest
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "No questions found in the file!")
+		return
+	}
+
+	result, _ := json.Marshal(report)
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, string(result))
+
+	APILogger.WithFields(logrus.Fields{
+		"host":         r.RemoteAddr,
+		"userAgent":    r.UserAgent(),
+		"teacherID":    teacherID,
+		"course":       requestVars["course"],
+		"format":       format,
+		"target":       target,
+		"imported":     report.Imported,
+		"skipped":      len(report.Skipped),
+		"responseCode": responseCode,
+	}).Info("importQuestions hit")
+}
+
+// getTestDraw sends back a test to a student, with the questions drawn for them from the question bank appended to the
+// fixed contents of the test.
+//
+// The first call draws the questions and stores them with the student's attempt, while later calls send back the same
+// draw. Just like getTest, this fails with a Forbidden (403) response code before the test has started, and it starts
+// the student's time limit for the test. The test is sent back in its student view, without its answer key.
+func getTestDraw(w http.ResponseWriter, r *http.Request) {
+	requestVars := mux.Vars(r)
+
+	//first we strip out the authentication from the header
+	username, password, authOK := r.BasicAuth()
+
+	responseCode := http.StatusOK
+
+	studentID := FindStudentID(username, password)
+
+	//then we check to see if authOK
+	if !authOK {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid authentication scheme!")
+		return
+	}
+
+	//see if student exists
+	if studentID == "notFound" {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid username and password combination!")
+		return
+	}
+
+	test := GetTest(requestVars["testID"])
+
+	if test == "notFound" {
+		responseCode = http.StatusNotFound
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "404 test not found!")
+		return
+	}
+
+	if GetTestStatus(requestVars["testID"]) == testCancelled {
+		responseCode = http.StatusGone
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "This test has been cancelled!")
+		return
+	}
+
+	test = string(applyTestOverride([]byte(test), requestVars["testID"], studentID))
+
+	startTime, _ := jsonparser.GetString([]byte(test), "startTime")
+
+	start, err := parseTestTime(startTime)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error":  err,
+			"testID": requestVars["testID"],
+		}).Warn("Cannot parse start time of test! Keeping the test unavailable!")
+
+		responseCode = http.StatusInternalServerError
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "This test has an invalid start time! It can't be opened until its teacher fixes it.")
+		return
+	}
+
+	if time.Now().Before(start) {
+		responseCode = http.StatusForbidden
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "This test isn't available yet!")
+		return
+	}
+
+	OpenTestSession(requestVars["testID"], studentID, CountAttempts(requestVars["testID"], username)+1)
+
+	draw := DrawQuestions(requestVars["testID"], studentID)
+
+	fmt.Fprint(w, redactTest(mergeTestDraw(test, draw)))
+
+	APILogger.WithFields(logrus.Fields{
+		"host":         r.RemoteAddr,
+		"userAgent":    r.UserAgent(),
+		"studentID":    studentID,
+		"testID":       requestVars["testID"],
+		"responseCode": responseCode,
+	}).Info("getTestDraw hit")
+}
+
+// viewTestDraw sends back the questions drawn from the question bank by a student on a test, answers included, so that
+// the teacher can grade the student's answer sheet. Only teachers of the course of the test can see the draw.
+func viewTestDraw(w http.ResponseWriter, r *http.Request) {
+	requestVars := mux.Vars(r)
+	responseCode := http.StatusOK
+
+	username, password, authOK := r.BasicAuth()
+
+	teacherID := FindTeacherID(username, password)
+
+	if !authOK {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid authentication scheme!")
+		return
+	}
+
+	//see if teacher exists
+	if teacherID == "notFound" {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid username and password combination!")
+		return
+	}
+
+	draw := GetTestDraw(requestVars["testID"], requestVars["studentID"])
+
+	if draw == "notFound" {
+		responseCode = http.StatusNotFound
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "404 draw not found!")
+		return
+	}
+
+	if !teachesTest(teacherID, requestVars["testID"]) {
+		responseCode = http.StatusForbidden
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Only teachers of the course of this test can see it in full!")
+		return
+	}
+
+	fmt.Fprint(w, draw)
+
+	APILogger.WithFields(logrus.Fields{
+		"host":         r.RemoteAddr,
+		"userAgent":    r.UserAgent(),
+		"teacherID":    teacherID,
+		"studentID":    requestVars["studentID"],
+		"testID":       requestVars["testID"],
+		"responseCode": responseCode,
+	}).Info("viewTestDraw hit")
+}
+
+// mergeTestDraw appends the contents of a student's draw to the contents of the test the draw was made for.
+//
+// The draw rules themselves are removed from the result, since the student has no use for them.
+func mergeTestDraw(test, draw string) string {
+	var testDocument map[string]interface{}
+	var drawDocument map[string]interface{}
+
+	err := json.Unmarshal([]byte(test), &testDocument)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Warn("Cannot unmarshal test into document!")
+		return test
+	}
+	err = json.Unmarshal([]byte(draw), &drawDocument)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Warn("Cannot unmarshal test draw into document!")
+		return test
+	}
+
+	contents, ok := testDocument["contents"].(map[string]interface{})
+	if !ok {
+		contents = map[string]interface{}{}
+	}
+	drawnContents, _ := drawDocument["contents"].(map[string]interface{})
+	for questionNumber, question := range drawnContents {
+		contents[questionNumber] = question
+	}
+
+	testDocument["contents"] = contents
+	delete(testDocument, "questionDraws")
+
+	result, err := json.Marshal(testDocument)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Warn("Cannot marshal merged test draw!")
+		return test
+	}
+
+	return string(result)
+}
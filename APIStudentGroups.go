@@ -0,0 +1,301 @@
+/*
+ * This file is part of VianuEdu.
+ *
+ *  VianuEdu is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ *  VianuEdu is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with VianuEdu.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * Developed by Matei Gardus <matei@gardus.eu>
+ */
+
+package vianueduserver
+
+import (
+	"fmt"
+	"github.com/buger/jsonparser"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/xeipuuv/gojsonschema"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// createStudentGroup creates a student group, provided it is given valid teacher credentials. Student groups gather
+// students from any class, so that a test can target all of them at once.
+//
+// Should the credentials provided be invalid, the HTTP handler responds with a Unauthorized (401) response code.
+// If the group isn't valid, the handler responds with a Bad Request (400) response code. Otherwise, it sends back the
+// ID of the new group.
+func createStudentGroup(w http.ResponseWriter, r *http.Request) {
+	//first we strip out the authentication from the header
+	username, password, authOK := r.BasicAuth()
+
+	responseCode := http.StatusOK
+
+	teacherID := FindTeacherID(username, password)
+
+	groupID := ""
+
+	//then we check to see if authOK
+	if !authOK {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid authentication scheme!")
+		return
+	}
+
+	//see if teacher exists
+	if teacherID == "notFound" {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid username and password combination!")
+		return
+	}
+
+	body, _ := ioutil.ReadAll(r.Body)
+
+	if problem := validateStudentGroup(body); problem != "" {
+		responseCode = http.StatusBadRequest
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, problem)
+		return
+	}
+
+	groupID = AddStudentGroup(string(body), teacherID)
+	if groupID == "" {
+		responseCode = http.StatusInternalServerError
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Oops! We messed up somewhere! Sorry! Try again")
+		return
+	}
+
+	fmt.Fprint(w, groupID)
+
+	APILogger.WithFields(logrus.Fields{
+		"host":         r.RemoteAddr,
+		"userAgent":    r.UserAgent(),
+		"teacherID":    teacherID,
+		"groupID":      groupID,
+		"responseCode": responseCode,
+	}).Info("createStudentGroup hit")
+}
+
+// updateStudentGroup replaces a student group with the one provided in the body, provided it is given the credentials
+// of the teacher who created the group or the admin credentials. Tests targeting the group are taken by its new
+// students from then on.
+//
+// It will send back a Resource Not Found (404) response code if there is no group found, and a Forbidden (403)
+// response code to other teachers.
+func updateStudentGroup(w http.ResponseWriter, r *http.Request) {
+	requestVars := mux.Vars(r)
+	responseCode := http.StatusOK
+
+	username, password, authOK := r.BasicAuth()
+
+	if !authOK {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid authentication scheme!")
+		return
+	}
+
+	adminUser, adminPass := GetAdminCreds()
+	isAdmin := username == adminUser && password == adminPass
+
+	teacherID := adminAuthor
+	if !isAdmin {
+		teacherID = FindTeacherID(username, password)
+	}
+
+	//see if teacher exists
+	if teacherID == "notFound" {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid username and password combination!")
+		return
+	}
+
+	group := GetStudentGroup(requestVars["groupID"])
+
+	if group == "notFound" {
+		responseCode = http.StatusNotFound
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "404 student group not found!")
+		return
+	}
+
+	if author, _ := jsonparser.GetString([]byte(group), "author"); !isAdmin && author != teacherID {
+		responseCode = http.StatusForbidden
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Only the teacher who created this student group, or an admin, can update it!")
+		return
+	}
+
+	body, _ := ioutil.ReadAll(r.Body)
+
+	if problem := validateStudentGroup(body); problem != "" {
+		responseCode = http.StatusBadRequest
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, problem)
+		return
+	}
+
+	if !EditStudentGroup(requestVars["groupID"], string(body)) {
+		responseCode = http.StatusInternalServerError
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Oops! We messed up somewhere! Sorry! Try again")
+		return
+	}
+
+	fmt.Fprint(w, "Student group updated!")
+
+	APILogger.WithFields(logrus.Fields{
+		"host":         r.RemoteAddr,
+		"userAgent":    r.UserAgent(),
+		"teacherID":    teacherID,
+		"groupID":      requestVars["groupID"],
+		"responseCode": responseCode,
+	}).Info("updateStudentGroup hit")
+}
+
+// getStudentGroup sends back a student group. Only teachers can see student groups.
+//
+// It will send back a Resource Not Found (404) response code if there is no group found.
+func getStudentGroup(w http.ResponseWriter, r *http.Request) {
+	requestVars := mux.Vars(r)
+	responseCode := http.StatusOK
+
+	username, password, authOK := r.BasicAuth()
+
+	teacherID := FindTeacherID(username, password)
+
+	if !authOK {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid authentication scheme!")
+		return
+	}
+
+	//see if teacher exists
+	if teacherID == "notFound" {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid username and password combination!")
+		return
+	}
+
+	group := GetStudentGroup(requestVars["groupID"])
+
+	if group == "notFound" {
+		responseCode = http.StatusNotFound
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "404 student group not found!")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, group)
+
+	APILogger.WithFields(logrus.Fields{
+		"host":         r.RemoteAddr,
+		"userAgent":    r.UserAgent(),
+		"teacherID":    teacherID,
+		"groupID":      requestVars["groupID"],
+		"responseCode": responseCode,
+	}).Info("getStudentGroup hit")
+}
+
+// listStudentGroups lists the ID and name of every student group. Only teachers can see student groups.
+//
+// It will send back a Resource Not Found (404) response code if there are no groups.
+func listStudentGroups(w http.ResponseWriter, r *http.Request) {
+	responseCode := http.StatusOK
+
+	username, password, authOK := r.BasicAuth()
+
+	teacherID := FindTeacherID(username, password)
+
+	if !authOK {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid authentication scheme!")
+		return
+	}
+
+	//see if teacher exists
+	if teacherID == "notFound" {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid username and password combination!")
+		return
+	}
+
+	groups := ListStudentGroups()
+
+	if groups == "notFound" {
+		responseCode = http.StatusNotFound
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "404 student groups not found!")
+		return
+	}
+
+	fmt.Fprint(w, groups)
+
+	APILogger.WithFields(logrus.Fields{
+		"host":         r.RemoteAddr,
+		"userAgent":    r.UserAgent(),
+		"teacherID":    teacherID,
+		"responseCode": responseCode,
+	}).Info("listStudentGroups hit")
+}
+
+// validateStudentGroup checks a StudentGroup object and returns what is wrong with it, or an empty string if it is
+// valid. A student group needs a name, and every one of its students must exist.
+func validateStudentGroup(group []byte) string {
+	templateFile, _ := os.Open("templates/StudentGroupTemplate.json")
+
+	//validate JSON!
+	// we pretty much only care for the final error, since the rest of the stuff here is unlikely to ever fail randomly.
+	templateString, _ := ioutil.ReadAll(templateFile)
+
+	groupTemplate := gojsonschema.NewStringLoader(string(templateString))
+
+	groupResponse := gojsonschema.NewStringLoader(string(group))
+
+	validation, err := gojsonschema.Validate(groupTemplate, groupResponse)
+	if err != nil || !validation.Valid() {
+		APILogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Warn("Could not validate JSON schema and document for student group!")
+		return "Invalid StudentGroup object!"
+	}
+
+	name, _ := jsonparser.GetString(group, "name")
+	if strings.TrimSpace(name) == "" {
+		return "Invalid student group! A student group needs a name!"
+	}
+
+	problem := ""
+
+	_, err = jsonparser.ArrayEach(group, func(value []byte, dataType jsonparser.ValueType, offset int, err1 error) {
+		if GetStudentObjectByID(string(value)) == "notFound" {
+			problem = "Invalid student group! Student " + string(value) + " doesn't exist!"
+		}
+	}, "students")
+	if err != nil {
+		return "Invalid student group! Students must be a list of student IDs!"
+	}
+
+	return problem
+}
@@ -0,0 +1,275 @@
+/*
+ * This file is part of VianuEdu.
+ *
+ *  VianuEdu is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ *  VianuEdu is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with VianuEdu.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * Developed by Matei Gardus <matei@gardus.eu>
+ */
+
+package vianueduserver
+
+import (
+	"fmt"
+	"github.com/buger/jsonparser"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// The possible statuses of a test, as stored in the VianuEdu.TestList collection.
+//
+// Active tests are taken and graded normally. Cancelled tests can no longer be taken or graded, and their grades no
+// longer count. Archived tests are finished tests that can no longer be changed, but whose grades still count.
+const (
+	testActive    = "active"
+	testCancelled = "cancelled"
+	testArchived  = "archived"
+)
+
+// cancelTest cancels a test, provided it is given the credentials of a teacher of the course of the test and the reason
+// for the cancellation, in a JSON body such as {"reason": "..."}.
+//
+// A cancelled test disappears from the test queue and from the planned tests, and it no longer accepts answer sheets,
+// draft answer sheets or grades. The answer sheets still waiting to be graded, the draft answer sheets and the grades
+// already given are kept, but flagged as cancelled: answer sheets are no longer waiting to be graded, and grades no
+// longer show up in the current grades of students.
+//
+// It will send back a Forbidden (403) response code if the teacher doesn't teach the course of the test, and a
+// Conflict (409) response code if the test has already been cancelled or archived.
+func cancelTest(w http.ResponseWriter, r *http.Request) {
+	requestVars := mux.Vars(r)
+	responseCode := http.StatusOK
+
+	username, password, authOK := r.BasicAuth()
+
+	teacherID := FindTeacherID(username, password)
+
+	if !authOK {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid authentication scheme!")
+		return
+	}
+
+	//see if teacher exists
+	if teacherID == "notFound" {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid username and password combination!")
+		return
+	}
+
+	status := GetTestStatus(requestVars["testID"])
+
+	if status == "notFound" {
+		responseCode = http.StatusNotFound
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "404 test not found!")
+		return
+	}
+
+	if !teachesTest(teacherID, requestVars["testID"]) {
+		responseCode = http.StatusForbidden
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Only teachers of the course of this test can cancel it!")
+		return
+	}
+
+	if status != testActive {
+		responseCode = http.StatusConflict
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "This test has already been "+status+"!")
+		return
+	}
+
+	body, _ := ioutil.ReadAll(r.Body)
+
+	reason, _ := jsonparser.GetString(body, "reason")
+	if strings.TrimSpace(reason) == "" {
+		responseCode = http.StatusBadRequest
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "A test can only be cancelled by stating the reason for it!")
+		return
+	}
+
+	answerSheets, grades := CancelTest(requestVars["testID"], teacherID, reason)
+
+	fmt.Fprintf(w, "Test cancelled! %d answer sheets and %d grades were flagged as cancelled.", answerSheets, grades)
+
+	APILogger.WithFields(logrus.Fields{
+		"host":         r.RemoteAddr,
+		"userAgent":    r.UserAgent(),
+		"teacherID":    teacherID,
+		"testID":       requestVars["testID"],
+		"reason":       reason,
+		"responseCode": responseCode,
+	}).Info("cancelTest hit")
+}
+
+// archiveTest archives a finished test, provided it is given the credentials of a teacher of the course of the test.
+//
+// Only tests that every student has finished, overrides and grace period included, can be archived, and only once all
+// their answer sheets have been graded. Otherwise, the handler responds with a Conflict (409) response code. An
+// archived test can no longer be edited, corrected, taken or graded, but its grades are kept and still count.
+func archiveTest(w http.ResponseWriter, r *http.Request) {
+	requestVars := mux.Vars(r)
+	responseCode := http.StatusOK
+
+	username, password, authOK := r.BasicAuth()
+
+	teacherID := FindTeacherID(username, password)
+
+	if !authOK {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid authentication scheme!")
+		return
+	}
+
+	//see if teacher exists
+	if teacherID == "notFound" {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid username and password combination!")
+		return
+	}
+
+	test := GetTest(requestVars["testID"])
+	status := GetTestStatus(requestVars["testID"])
+
+	if test == "notFound" || status == "notFound" {
+		responseCode = http.StatusNotFound
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "404 test not found!")
+		return
+	}
+
+	if !teachesTest(teacherID, requestVars["testID"]) {
+		responseCode = http.StatusForbidden
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Only teachers of the course of this test can archive it!")
+		return
+	}
+
+	if status != testActive {
+		responseCode = http.StatusConflict
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "This test has already been "+status+"!")
+		return
+	}
+
+	_, lastEnd, _ := getTestWindow([]byte(test), requestVars["testID"])
+
+	if !time.Now().After(lastEnd.Add(submissionGracePeriod)) ||
+		CountDraftAnswerSheets(requestVars["testID"]) > 0 {
+		responseCode = http.StatusConflict
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "This test isn't over yet! A test can only be archived once every student has finished it.")
+		return
+	}
+
+	if CountAnswerSheets(requestVars["testID"]) > 0 {
+		responseCode = http.StatusConflict
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "This test still has answer sheets waiting to be graded! Grade them before archiving it.")
+		return
+	}
+
+	body, _ := ioutil.ReadAll(r.Body)
+	reason, _ := jsonparser.GetString(body, "reason")
+
+	SetTestStatus(requestVars["testID"], testArchived, teacherID, reason)
+
+	fmt.Fprint(w, "Test archived!")
+
+	APILogger.WithFields(logrus.Fields{
+		"host":         r.RemoteAddr,
+		"userAgent":    r.UserAgent(),
+		"teacherID":    teacherID,
+		"testID":       requestVars["testID"],
+		"responseCode": responseCode,
+	}).Info("archiveTest hit")
+}
+
+// deleteTest removes a test from the database altogether, provided it is given the credentials of a teacher of the
+// course of the test.
+//
+// Only tests that no student could have taken yet can be deleted, meaning tests that haven't started for anyone,
+// overrides included, and have neither answer sheets nor grades. Otherwise, the handler responds with a Conflict (409)
+// response code, and the test must be cancelled instead.
+func deleteTest(w http.ResponseWriter, r *http.Request) {
+	requestVars := mux.Vars(r)
+	responseCode := http.StatusOK
+
+	username, password, authOK := r.BasicAuth()
+
+	teacherID := FindTeacherID(username, password)
+
+	if !authOK {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid authentication scheme!")
+		return
+	}
+
+	//see if teacher exists
+	if teacherID == "notFound" {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid username and password combination!")
+		return
+	}
+
+	test := GetTest(requestVars["testID"])
+
+	if test == "notFound" {
+		responseCode = http.StatusNotFound
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "404 test not found!")
+		return
+	}
+
+	if !teachesTest(teacherID, requestVars["testID"]) {
+		responseCode = http.StatusForbidden
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Only teachers of the course of this test can delete it!")
+		return
+	}
+
+	firstStart, _, err := getTestWindow([]byte(test), requestVars["testID"])
+
+	if err != nil || !time.Now().Before(firstStart) || CountAnswerSheets(requestVars["testID"]) > 0 ||
+		CountGrades(requestVars["testID"]) > 0 {
+		responseCode = http.StatusConflict
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "This test has already started! Only tests that no student could have taken yet can be"+
+			" deleted. Cancel it instead.")
+		return
+	}
+
+	DeleteTest(requestVars["testID"])
+
+	fmt.Fprint(w, "Test deleted!")
+
+	APILogger.WithFields(logrus.Fields{
+		"host":         r.RemoteAddr,
+		"userAgent":    r.UserAgent(),
+		"teacherID":    teacherID,
+		"testID":       requestVars["testID"],
+		"responseCode": responseCode,
+	}).Info("deleteTest hit")
+}
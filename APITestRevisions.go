@@ -0,0 +1,501 @@
+/*
+ * This file is part of VianuEdu.
+ *
+ *  VianuEdu is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ *  VianuEdu is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with VianuEdu.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * Developed by Matei Gardus <matei@gardus.eu>
+ */
+
+package vianueduserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/buger/jsonparser"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/xeipuuv/gojsonschema"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A TestChange is a single difference between two revisions of a test. The path points to the changed value inside
+// the Test object, i.e. "contents.3.answer".
+type TestChange struct {
+	Path   string      `json:"path"`
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// nonStructuralTestFields lists the fields of a Test object that can still be edited after the test has started.
+var nonStructuralTestFields = []string{"testName", "endTime", "attempts", "scoringPolicy", "thesis", "academicYear",
+	"semester"}
+
+// listTestRevisions lists every revision of a test, along with who made it, when, and why. Only teachers of the course
+// of the test can see its revision history.
+//
+// It will send back a Forbidden (403) response code to other teachers, and a Resource Not Found (404) response code
+// if the test has no revisions.
+func listTestRevisions(w http.ResponseWriter, r *http.Request) {
+	requestVars := mux.Vars(r)
+	responseCode := http.StatusOK
+
+	username, password, authOK := r.BasicAuth()
+
+	teacherID := FindTeacherID(username, password)
+
+	if !authOK {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid authentication scheme!")
+		return
+	}
+
+	//see if teacher exists
+	if teacherID == "notFound" {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid username and password combination!")
+		return
+	}
+
+	if !teachesTest(teacherID, requestVars["testID"]) {
+		responseCode = http.StatusForbidden
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Only teachers of the course of this test can see its revisions!")
+		return
+	}
+
+	revisions := ListTestRevisions(requestVars["testID"])
+
+	if revisions == "notFound" {
+		responseCode = http.StatusNotFound
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "404 revisions not found!")
+		return
+	}
+
+	fmt.Fprint(w, revisions)
+
+	APILogger.WithFields(logrus.Fields{
+		"host":         r.RemoteAddr,
+		"userAgent":    r.UserAgent(),
+		"teacherID":    teacherID,
+		"testID":       requestVars["testID"],
+		"responseCode": responseCode,
+	}).Info("listTestRevisions hit")
+}
+
+// getTestRevision sends back a specific revision of a test, with the full Test object as it was at that revision.
+//
+// It will send back a Forbidden (403) response code to teachers of other courses, and a Resource Not Found (404)
+// response code if there is no such revision.
+func getTestRevision(w http.ResponseWriter, r *http.Request) {
+	requestVars := mux.Vars(r)
+	responseCode := http.StatusOK
+
+	username, password, authOK := r.BasicAuth()
+
+	teacherID := FindTeacherID(username, password)
+
+	if !authOK {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid authentication scheme!")
+		return
+	}
+
+	//see if teacher exists
+	if teacherID == "notFound" {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid username and password combination!")
+		return
+	}
+
+	if !teachesTest(teacherID, requestVars["testID"]) {
+		responseCode = http.StatusForbidden
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Only teachers of the course of this test can see it in full!")
+		return
+	}
+
+	revisionNumber, _ := strconv.Atoi(requestVars["revision"])
+
+	revision := GetTestRevision(requestVars["testID"], revisionNumber)
+
+	if revision == "notFound" {
+		responseCode = http.StatusNotFound
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "404 revision not found!")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, revision)
+
+	APILogger.WithFields(logrus.Fields{
+		"host":         r.RemoteAddr,
+		"userAgent":    r.UserAgent(),
+		"teacherID":    teacherID,
+		"testID":       requestVars["testID"],
+		"revision":     revisionNumber,
+		"responseCode": responseCode,
+	}).Info("getTestRevision hit")
+}
+
+// getTestRevisionDiff sends back every difference between two revisions of a test, as a JSON array of TestChange
+// objects.
+//
+// It will send back a Forbidden (403) response code to teachers of other courses, and a Resource Not Found (404)
+// response code if either of the revisions doesn't exist.
+func getTestRevisionDiff(w http.ResponseWriter, r *http.Request) {
+	requestVars := mux.Vars(r)
+	responseCode := http.StatusOK
+
+	username, password, authOK := r.BasicAuth()
+
+	teacherID := FindTeacherID(username, password)
+
+	if !authOK {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid authentication scheme!")
+		return
+	}
+
+	//see if teacher exists
+	if teacherID == "notFound" {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid username and password combination!")
+		return
+	}
+
+	if !teachesTest(teacherID, requestVars["testID"]) {
+		responseCode = http.StatusForbidden
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Only teachers of the course of this test can see it in full!")
+		return
+	}
+
+	from, _ := strconv.Atoi(requestVars["from"])
+	to, _ := strconv.Atoi(requestVars["to"])
+
+	fromRevision := GetTestRevision(requestVars["testID"], from)
+	toRevision := GetTestRevision(requestVars["testID"], to)
+
+	if fromRevision == "notFound" || toRevision == "notFound" {
+		responseCode = http.StatusNotFound
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "404 revision not found!")
+		return
+	}
+
+	fromTest, _, _, _ := jsonparser.Get([]byte(fromRevision), "test")
+	toTest, _, _, _ := jsonparser.Get([]byte(toRevision), "test")
+
+	diff, _ := json.Marshal(diffTests(fromTest, toTest))
+
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, string(diff))
+
+	APILogger.WithFields(logrus.Fields{
+		"host":         r.RemoteAddr,
+		"userAgent":    r.UserAgent(),
+		"teacherID":    teacherID,
+		"testID":       requestVars["testID"],
+		"from":         from,
+		"to":           to,
+		"responseCode": responseCode,
+	}).Info("getTestRevisionDiff hit")
+}
+
+// correctTest replaces a test with a corrected version, even after the test has started, provided it is given valid
+// teacher credentials. The body holds the reason for the correction and the corrected test, as follows:
+//
+//	{
+//		"reason": "Question 3 had the wrong answer marked as correct.",
+//		"test": { [Test object] }
+//	}
+//
+// Only teachers of the course of the test can correct it. The correction is recorded in the revision history along
+// with its reason. Every validation conducted within this HTTP handler function is equivalent to the ones in
+// updateTest.
+func correctTest(w http.ResponseWriter, r *http.Request) {
+	requestVars := mux.Vars(r)
+
+	//first we strip out the authentication from the header
+	username, password, authOK := r.BasicAuth()
+
+	responseCode := http.StatusOK
+
+	teacherID := FindTeacherID(username, password)
+
+	templateFile, _ := os.Open("templates/TestTemplate.json")
+
+	//then we check to see if authOK
+	if !authOK {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid authentication scheme!")
+		return
+	}
+
+	//see if teacher exists
+	if teacherID == "notFound" {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid username and password combination!")
+		return
+	}
+
+	test := GetTest(requestVars["testID"])
+
+	if test == "notFound" {
+		responseCode = http.StatusNotFound
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "404 test not found!")
+		return
+	}
+
+	if !teachesTest(teacherID, requestVars["testID"]) {
+		responseCode = http.StatusForbidden
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Only teachers of the course of this test can correct it!")
+		return
+	}
+
+	if status := GetTestStatus(requestVars["testID"]); status != testActive {
+		responseCode = http.StatusGone
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "This test has been "+status+"! It can no longer be changed.")
+		return
+	}
+
+	body, _ := ioutil.ReadAll(r.Body)
+
+	reason, _ := jsonparser.GetString(body, "reason")
+	correctedTest, _, _, _ := jsonparser.Get(body, "test")
+
+	//validate JSON!
+	// we pretty much only care for the final error, since the rest of the stuff here is unlikely to ever fail randomly.
+	templateString, _ := ioutil.ReadAll(templateFile)
+
+	testTemplate := gojsonschema.NewStringLoader(string(templateString))
+
+	testResponse := gojsonschema.NewStringLoader(string(correctedTest))
+
+	validation, err := gojsonschema.Validate(testTemplate, testResponse)
+	if err != nil || !validation.Valid() || strings.TrimSpace(reason) == "" {
+		APILogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Warn("Could not validate JSON schema and document for correcting test!")
+		responseCode = http.StatusBadRequest
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid correction! A correction needs a valid Test object and the reason for it!")
+		return
+	}
+
+	if problem := validateTestSchedule(correctedTest); problem != "" {
+		responseCode = http.StatusBadRequest
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, problem)
+		return
+	}
+
+	if problem := validateTestTargets(correctedTest); problem != "" {
+		responseCode = http.StatusBadRequest
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, problem)
+		return
+	}
+
+	if problem := validateTestAttempts(correctedTest); problem != "" {
+		responseCode = http.StatusBadRequest
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, problem)
+		return
+	}
+
+	if problem := validateTestQuestions(correctedTest); problem != "" {
+		responseCode = http.StatusBadRequest
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, problem)
+		return
+	}
+
+	if problem := validateTestGradeScale(correctedTest); problem != "" {
+		responseCode = http.StatusBadRequest
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, problem)
+		return
+	}
+
+	if problem := validateTestCalendar(correctedTest, []byte(test)); problem != "" {
+		responseCode = http.StatusBadRequest
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, problem)
+		return
+	}
+
+	correctedTest = withAcademicTerm(correctedTest, testTerm(correctedTest))
+
+	submittedTestID, _ := jsonparser.GetString(correctedTest, "testID")
+	if submittedTestID != requestVars["testID"] {
+		responseCode = http.StatusBadRequest
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid test ID! Test ID must be the same as previous test upload!")
+		return
+	}
+
+	subject, _ := jsonparser.GetString(correctedTest, "course")
+
+	recordTestRevision(requestVars["testID"], test, string(correctedTest), teacherID, reason, true)
+	EditTest(subject, string(correctedTest), requestVars["testID"])
+
+	fmt.Fprint(w, "Test corrected!")
+
+	APILogger.WithFields(logrus.Fields{
+		"host":         r.RemoteAddr,
+		"userAgent":    r.UserAgent(),
+		"teacherID":    teacherID,
+		"testID":       requestVars["testID"],
+		"reason":       reason,
+		"responseCode": responseCode,
+	}).Info("correctTest hit")
+}
+
+// recordTestRevision stores a new revision of a test in the revision history.
+//
+// Tests created before the revision history existed have no revisions at all, so their previous version is stored
+// first, in order not to lose it.
+func recordTestRevision(testID, previousTest, newTest, teacherID, reason string, correction bool) {
+	if CountTestRevisions(testID) == 0 {
+		AddTestRevision(testID, previousTest, "", "Version preceding the revision history", false)
+	}
+
+	AddTestRevision(testID, newTest, teacherID, reason, correction)
+}
+
+// isStructuralEdit checks whether replacing a test with a new version changes anything other than the fields listed in
+// nonStructuralTestFields.
+func isStructuralEdit(before, after []byte) bool {
+	for _, change := range diffTests(before, after) {
+		field := strings.SplitN(change.Path, ".", 2)[0]
+
+		structural := true
+		for _, nonStructuralField := range nonStructuralTestFields {
+			if field == nonStructuralField {
+				structural = false
+			}
+		}
+
+		if structural {
+			return true
+		}
+	}
+
+	return false
+}
+
+// diffTests compares two versions of a Test JSON document value by value, and returns every difference between them,
+// sorted by path. Database IDs are ignored, and so are test times written in different timezones that still hold the
+// same moment.
+func diffTests(before, after []byte) []TestChange {
+	var beforeDocument, afterDocument interface{}
+
+	json.Unmarshal(before, &beforeDocument)
+	json.Unmarshal(after, &afterDocument)
+
+	sameTestTimes(beforeDocument, afterDocument)
+
+	beforeFields := map[string]interface{}{}
+	afterFields := map[string]interface{}{}
+
+	flattenJSON("", beforeDocument, beforeFields)
+	flattenJSON("", afterDocument, afterFields)
+
+	var paths []string
+	for path := range beforeFields {
+		paths = append(paths, path)
+	}
+	for path := range afterFields {
+		if _, ok := beforeFields[path]; !ok {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	changes := []TestChange{}
+	for _, path := range paths {
+		if path == "_id" || strings.HasPrefix(path, "_id.") {
+			continue
+		}
+
+		if !reflect.DeepEqual(beforeFields[path], afterFields[path]) {
+			changes = append(changes, TestChange{path, beforeFields[path], afterFields[path]})
+		}
+	}
+
+	return changes
+}
+
+// sameTestTimes writes the times of the newer version of a decoded Test JSON document the way the older version writes
+// them, if they hold the same moment, i.e. "2049-02-21T07:00:00Z" and "2049-02-21T09:00:00+02:00".
+func sameTestTimes(before, after interface{}) {
+	beforeDocument, beforeOK := before.(map[string]interface{})
+	afterDocument, afterOK := after.(map[string]interface{})
+	if !beforeOK || !afterOK {
+		return
+	}
+
+	for _, field := range testTimeFields {
+		beforeValue, _ := beforeDocument[field].(string)
+		afterValue, _ := afterDocument[field].(string)
+
+		beforeTime, beforeErr := parseTestTime(beforeValue)
+		afterTime, afterErr := parseTestTime(afterValue)
+		if beforeErr == nil && afterErr == nil && beforeTime.Equal(afterTime) {
+			afterDocument[field] = beforeValue
+		}
+	}
+}
+
+// flattenJSON walks a decoded JSON value and stores every leaf value in the provided map, under its dot-separated path.
+// Array elements are addressed by their index, i.e. "contents.3.questionChoices.0".
+func flattenJSON(path string, value interface{}, fields map[string]interface{}) {
+	prefix := path
+	if prefix != "" {
+		prefix = prefix + "."
+	}
+
+	switch typedValue := value.(type) {
+	case map[string]interface{}:
+		for key, child := range typedValue {
+			flattenJSON(prefix+key, child, fields)
+		}
+	case []interface{}:
+		for index, child := range typedValue {
+			flattenJSON(prefix+strconv.Itoa(index), child, fields)
+		}
+	default:
+		fields[path] = value
+	}
+}
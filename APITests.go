@@ -20,6 +20,7 @@
 package vianueduserver
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/buger/jsonparser"
 	"github.com/gorilla/mux"
@@ -28,16 +29,48 @@ import (
 	"io/ioutil"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 )
 
+// getTest sends back the student view of a test, provided it is given valid student credentials and the test has
+// already started. Before that, the handler responds with a Forbidden (403) response code. Cancelled tests are
+// answered with a Gone (410) response code.
+//
+// The student view leaves out the answer key and everything else students have no business seeing (see redactTest).
+// The full test is only sent back to teachers, by viewTest.
+//
+// The student's override on the test (if any) is applied, the moment the student opened the test is recorded, and the
+// student's time limit for the test starts running.
 func getTest(w http.ResponseWriter, r *http.Request) {
 	requestVars := mux.Vars(r)
 
-	test := GetTest(requestVars["testID"])
+	//first we strip out the authentication from the header
+	username, password, authOK := r.BasicAuth()
+
 	responseCode := http.StatusOK
 
+	studentID := FindStudentID(username, password)
+
+	//then we check to see if authOK
+	if !authOK {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid authentication scheme!")
+		return
+	}
+
+	//see if student exists
+	if studentID == "notFound" {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid username and password combination!")
+		return
+	}
+
+	test := GetTest(requestVars["testID"])
+
 	if test == "notFound" {
 		responseCode = http.StatusNotFound
 		w.WriteHeader(responseCode)
@@ -45,17 +78,31 @@ func getTest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	startTime, _ := jsonparser.GetString([]byte(test), "startTime")
+	if GetTestStatus(requestVars["testID"]) == testCancelled {
+		responseCode = http.StatusGone
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "This test has been cancelled!")
+		return
+	}
 
-	const layout = "Jan 2, 2006 3:04:05 PM"
+	test = string(applyTestOverride([]byte(test), requestVars["testID"], studentID))
 
-	zone, _ := time.LoadLocation("Europe/Bucharest")
+	startTime, _ := jsonparser.GetString([]byte(test), "startTime")
 
-	start, _ := time.ParseInLocation(layout, startTime, zone)
+	start, err := parseTestTime(startTime)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error":  err,
+			"testID": requestVars["testID"],
+		}).Warn("Cannot parse start time of test! Keeping the test unavailable!")
 
-	now := time.Now().In(zone)
+		responseCode = http.StatusInternalServerError
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "This test has an invalid start time! It can't be opened until its teacher fixes it.")
+		return
+	}
 
-	if now.Before(start) {
+	if time.Now().Before(start) {
 		responseCode = http.StatusForbidden
 		w.WriteHeader(responseCode)
 		fmt.Fprint(w, "Nice try, but this test isn't available yet! Nice thinking, though! You should work for the"+
@@ -63,16 +110,21 @@ func getTest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	fmt.Fprint(w, test)
+	OpenTestSession(requestVars["testID"], studentID, CountAttempts(requestVars["testID"], username)+1)
+
+	fmt.Fprint(w, redactTest(test))
 
 	APILogger.WithFields(logrus.Fields{
 		"host":         r.RemoteAddr,
 		"userAgent":    r.UserAgent(),
+		"studentID":    studentID,
 		"testID":       requestVars["testID"],
 		"responseCode": responseCode,
 	}).Info("getTest hit")
 }
 
+// viewTest sends back a test in full, answer key included, provided it is given the credentials of a teacher of the
+// course of the test. Other teachers are answered with a Forbidden (403) response code.
 func viewTest(w http.ResponseWriter, r *http.Request) {
 	requestVars := mux.Vars(r)
 	responseCode := http.StatusOK
@@ -105,6 +157,13 @@ func viewTest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !teachesTest(teacherID, requestVars["testID"]) {
+		responseCode = http.StatusForbidden
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Only teachers of the course of this test can see it in full!")
+		return
+	}
+
 	fmt.Fprint(w, test)
 
 	APILogger.WithFields(logrus.Fields{
@@ -116,6 +175,155 @@ func viewTest(w http.ResponseWriter, r *http.Request) {
 	}).Info("viewTest hit")
 }
 
+// exportTest sends back the fixed contents of a test as a GIFT file ("?format=gift") or as an IMS QTI 2.1 package
+// ("?format=qti"), so that it can be used in other platforms, provided it is given the credentials of a teacher of the
+// course of the test. Questions drawn from the question bank aren't exported, since every student gets different ones.
+func exportTest(w http.ResponseWriter, r *http.Request) {
+	requestVars := mux.Vars(r)
+	responseCode := http.StatusOK
+
+	username, password, authOK := r.BasicAuth()
+
+	teacherID := FindTeacherID(username, password)
+
+	if !authOK {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid authentication scheme!")
+		return
+	}
+
+	//see if teacher exists
+	if teacherID == "notFound" {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid username and password combination!")
+		return
+	}
+
+	test := GetTest(requestVars["testID"])
+
+	if test == "notFound" {
+		responseCode = http.StatusNotFound
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "404 test not found!")
+		return
+	}
+
+	if !teachesTest(teacherID, requestVars["testID"]) {
+		responseCode = http.StatusForbidden
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Only teachers of the course of this test can export it!")
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+
+	switch format {
+	case "gift":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+requestVars["testID"]+`.gift.txt"`)
+		fmt.Fprint(w, exportTestGIFT([]byte(test)))
+	case "qti":
+		qtiPackage, err := exportTestQTI([]byte(test))
+		if err != nil {
+			APILogger.WithFields(logrus.Fields{
+				"error":  err,
+				"testID": requestVars["testID"],
+			}).Warn("Cannot write test as a QTI package!")
+			responseCode = http.StatusInternalServerError
+			w.WriteHeader(responseCode)
+			fmt.Fprint(w, "Oops! We messed up somewhere! Sorry! Try again")
+			return
+		}
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+requestVars["testID"]+`.qti.zip"`)
+		w.Write(qtiPackage)
+	default:
+		responseCode = http.StatusBadRequest
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid format! Must be one of gift or qti!")
+		return
+	}
+
+	APILogger.WithFields(logrus.Fields{
+		"host":         r.RemoteAddr,
+		"userAgent":    r.UserAgent(),
+		"teacherID":    teacherID,
+		"testID":       requestVars["testID"],
+		"format":       format,
+		"responseCode": responseCode,
+	}).Info("exportTest hit")
+}
+
+// studentTestFields lists the fields of a Test object that are part of its student view.
+var studentTestFields = []string{"testID", "testName", "course", "startTime", "endTime", "duration", "attempts",
+	"scoringPolicy", "thesis", "contents"}
+
+// studentQuestionFields lists the fields of a question that are part of the student view of a test.
+var studentQuestionFields = []string{"question", "questionType", "questionChoices", "points", "languages", "timeLimit",
+	"memoryLimit"}
+
+// redactTest returns the student view of a test, which only keeps the fields listed in studentTestFields and, for every
+// question, the fields listed in studentQuestionFields. Answers, rubrics, test cases, targets, draw rules and any other
+// internal metadata are left out.
+//
+// Should the test not be a valid Test object, the method returns an empty JSON object rather than risk leaking it.
+func redactTest(test string) string {
+	var testDocument map[string]interface{}
+
+	err := json.Unmarshal([]byte(test), &testDocument)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Warn("Cannot unmarshal test into document!")
+		return "{}"
+	}
+
+	studentView := map[string]interface{}{}
+	for _, field := range studentTestFields {
+		if value, ok := testDocument[field]; ok {
+			studentView[field] = value
+		}
+	}
+
+	contents, _ := testDocument["contents"].(map[string]interface{})
+	studentContents := map[string]interface{}{}
+	for questionNumber, question := range contents {
+		questionDocument, ok := question.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		studentQuestion := map[string]interface{}{}
+		for _, field := range studentQuestionFields {
+			if value, ok := questionDocument[field]; ok {
+				studentQuestion[field] = value
+			}
+		}
+		studentContents[questionNumber] = studentQuestion
+	}
+	studentView["contents"] = studentContents
+
+	result, err := json.Marshal(studentView)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Warn("Cannot marshal student view of test!")
+		return "{}"
+	}
+
+	return string(result)
+}
+
+// teachesTest checks whether a teacher teaches the course of a test, which is what entitles them to see the test in
+// full, answer key included.
+func teachesTest(teacherID, testID string) bool {
+	course, _ := jsonparser.GetString([]byte(GetTeacherObjectByID(teacherID)), "course")
+
+	return course != "" && course == GetTestType(testID)
+}
+
 func getPlannedTests(w http.ResponseWriter, r *http.Request) {
 	requestVars := mux.Vars(r)
 	responseCode := http.StatusOK
@@ -165,6 +373,13 @@ func getPlannedTests(w http.ResponseWriter, r *http.Request) {
 	}).Info("getPlannedTests hit")
 }
 
+// getUncorrectedTests lists the IDs of the tests of a subject with answer sheets still waiting to be graded, one per
+// line, provided it is given valid teacher credentials.
+//
+// With "?flags=true", every test is followed by how many of those answer sheets were flagged by the events their exam
+// client reported (see reportExamEvent), as follows:
+//
+//	[TEST ID] // [FLAGGED ANSWER SHEETS]
 func getUncorrectedTests(w http.ResponseWriter, r *http.Request) {
 	requestVars := mux.Vars(r)
 	responseCode := http.StatusOK
@@ -203,6 +418,14 @@ func getUncorrectedTests(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if r.URL.Query().Get("flags") == "true" {
+		flaggedTests := ""
+		for _, testID := range strings.Split(strings.TrimSpace(uncorrectedTests), "\n") {
+			flaggedTests = flaggedTests + testID + " // " + strconv.Itoa(countFlaggedAnswerSheets(testID)) + "\n"
+		}
+		uncorrectedTests = flaggedTests
+	}
+
 	fmt.Fprint(w, uncorrectedTests)
 
 	APILogger.WithFields(logrus.Fields{
@@ -237,7 +460,7 @@ func getTestQueue(w http.ResponseWriter, r *http.Request) {
 	grade, _ := jsonparser.GetInt([]byte(student), "grade")
 	gradeLetter, _ := jsonparser.GetString([]byte(student), "gradeLetter")
 
-	tests := GetTestQueue(requestVars["subject"], grade, gradeLetter)
+	tests := GetTestQueue(requestVars["subject"], grade, gradeLetter, requestVars["studentID"])
 
 	if tests == "notFound" {
 		responseCode := http.StatusNotFound
@@ -325,6 +548,51 @@ func createTest(w http.ResponseWriter, r *http.Request) {
 		}
 
 		if validation.Valid() {
+			if problem := validateTestSchedule(body); problem != "" {
+				responseCode = http.StatusBadRequest
+				w.WriteHeader(responseCode)
+				fmt.Fprint(w, problem)
+				return
+			}
+
+			if problem := validateTestTargets(body); problem != "" {
+				responseCode = http.StatusBadRequest
+				w.WriteHeader(responseCode)
+				fmt.Fprint(w, problem)
+				return
+			}
+
+			if problem := validateTestAttempts(body); problem != "" {
+				responseCode = http.StatusBadRequest
+				w.WriteHeader(responseCode)
+				fmt.Fprint(w, problem)
+				return
+			}
+
+			if problem := validateTestQuestions(body); problem != "" {
+				responseCode = http.StatusBadRequest
+				w.WriteHeader(responseCode)
+				fmt.Fprint(w, problem)
+				return
+			}
+
+			if problem := validateTestGradeScale(body); problem != "" {
+				responseCode = http.StatusBadRequest
+				w.WriteHeader(responseCode)
+				fmt.Fprint(w, problem)
+				return
+			}
+
+			if problem := validateTestCalendar(body, nil); problem != "" {
+				responseCode = http.StatusBadRequest
+				w.WriteHeader(responseCode)
+				fmt.Fprint(w, problem)
+				return
+			}
+
+			// tests belong to the term they start in, whatever the teacher sent
+			body = withAcademicTerm(body, testTerm(body))
+
 			testID = GetNextTestID()
 
 			submittedTestID, _ := jsonparser.GetString(body, "testID")
@@ -337,6 +605,7 @@ func createTest(w http.ResponseWriter, r *http.Request) {
 			}
 
 			AddTest(requestVars["subject"], string(body), testID)
+			AddTestRevision(testID, string(body), teacherID, "Test created", false)
 
 			fmt.Fprint(w, "Test created! New test ID is "+testID)
 		}
@@ -351,6 +620,12 @@ func createTest(w http.ResponseWriter, r *http.Request) {
 	}).Info("createTest hit")
 }
 
+// updateTest replaces a test with the one provided in the body, provided it is given valid teacher credentials. The
+// previous version of the test is kept in the revision history.
+//
+// Once the test has started, structural edits (anything other than its name and end time) are refused with a
+// Forbidden (403) response code, since they could silently change the test under existing answer sheets. Those edits
+// must go through correctTest instead.
 func updateTest(w http.ResponseWriter, r *http.Request) {
 	requestVars := mux.Vars(r)
 
@@ -390,6 +665,13 @@ func updateTest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if status := GetTestStatus(requestVars["testID"]); status != testActive {
+		responseCode = http.StatusGone
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "This test has been "+status+"! It can no longer be changed.")
+		return
+	}
+
 	//let's go!
 	if responseCode == http.StatusOK {
 
@@ -415,6 +697,51 @@ func updateTest(w http.ResponseWriter, r *http.Request) {
 		}
 
 		if validation.Valid() {
+			if problem := validateTestSchedule(body); problem != "" {
+				responseCode = http.StatusBadRequest
+				w.WriteHeader(responseCode)
+				fmt.Fprint(w, problem)
+				return
+			}
+
+			if problem := validateTestTargets(body); problem != "" {
+				responseCode = http.StatusBadRequest
+				w.WriteHeader(responseCode)
+				fmt.Fprint(w, problem)
+				return
+			}
+
+			if problem := validateTestAttempts(body); problem != "" {
+				responseCode = http.StatusBadRequest
+				w.WriteHeader(responseCode)
+				fmt.Fprint(w, problem)
+				return
+			}
+
+			if problem := validateTestQuestions(body); problem != "" {
+				responseCode = http.StatusBadRequest
+				w.WriteHeader(responseCode)
+				fmt.Fprint(w, problem)
+				return
+			}
+
+			if problem := validateTestGradeScale(body); problem != "" {
+				responseCode = http.StatusBadRequest
+				w.WriteHeader(responseCode)
+				fmt.Fprint(w, problem)
+				return
+			}
+
+			if problem := validateTestCalendar(body, []byte(test)); problem != "" {
+				responseCode = http.StatusBadRequest
+				w.WriteHeader(responseCode)
+				fmt.Fprint(w, problem)
+				return
+			}
+
+			// tests belong to the term they start in, whatever the teacher sent
+			body = withAcademicTerm(body, testTerm(body))
+
 			testID = requestVars["testID"]
 
 			submittedTestID, _ := jsonparser.GetString(body, "testID")
@@ -426,8 +753,28 @@ func updateTest(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 
+			// once students could open the test, only non-structural edits are allowed, the rest must be corrections.
+			// Tests whose start time can't be read are treated as already started.
+			startTime, _ := jsonparser.GetString([]byte(test), "startTime")
+			start, err := parseTestTime(startTime)
+			if err != nil {
+				APILogger.WithFields(logrus.Fields{
+					"error":  err,
+					"testID": testID,
+				}).Warn("Cannot parse start time of test! Treating the test as started!")
+			}
+
+			if (err != nil || time.Now().After(start)) && isStructuralEdit([]byte(test), body) {
+				responseCode = http.StatusForbidden
+				w.WriteHeader(responseCode)
+				fmt.Fprint(w, "This test has already started! Only its name and end time can still be edited. Any other"+
+					" change must go through the correctTest endpoint, stating the reason for it.")
+				return
+			}
+
 			subject, _ := jsonparser.GetString(body, "course")
 
+			recordTestRevision(testID, test, string(body), teacherID, "", false)
 			EditTest(subject, string(body), testID)
 
 			fmt.Fprint(w, "Test updated!")
@@ -442,3 +789,567 @@ func updateTest(w http.ResponseWriter, r *http.Request) {
 		"responseCode": responseCode,
 	}).Info("updateTest hit")
 }
+
+// validateTestSchedule checks the start time, end time and duration of a Test object and returns what is wrong with
+// them, or an empty string if they are valid.
+//
+// Start and end times must be RFC 3339 timestamps, i.e. "2049-02-21T10:30:00+02:00", and the test must end after it
+// starts. The duration, if any, must be a positive number of minutes.
+func validateTestSchedule(test []byte) string {
+	startTime, _ := jsonparser.GetString(test, "startTime")
+	endTime, _ := jsonparser.GetString(test, "endTime")
+
+	start, err := parseTestTime(startTime)
+	if err != nil {
+		return "Invalid start time! Test times must be RFC 3339 timestamps, i.e. 2049-02-21T10:30:00+02:00"
+	}
+	end, err := parseTestTime(endTime)
+	if err != nil {
+		return "Invalid end time! Test times must be RFC 3339 timestamps, i.e. 2049-02-21T11:20:00+02:00"
+	}
+
+	if !start.Before(end) {
+		return "Invalid test times! A test must end after it starts!"
+	}
+
+	duration, err := jsonparser.GetInt(test, "duration")
+	if (err != nil && err != jsonparser.KeyPathNotFoundError) || (err == nil && duration <= 0) {
+		return "Invalid duration! Duration must be a positive number of minutes!"
+	}
+
+	return ""
+}
+
+// validateTestCalendar checks the start time of a Test object against the academic calendar and returns what is wrong
+// with it, or an empty string if it is valid. Tests can't start during a holiday, though edits that keep the start
+// time of the previous version of the test, if any, are let through.
+func validateTestCalendar(test, previous []byte) string {
+	startTime, _ := jsonparser.GetString(test, "startTime")
+
+	start, err := parseTestTime(startTime)
+	if err != nil {
+		return ""
+	}
+
+	if previousTime, err := jsonparser.GetString(readTestTimes(previous), "startTime"); err == nil {
+		if previousStart, err := parseTestTime(previousTime); err == nil && previousStart.Equal(start) {
+			return ""
+		}
+	}
+
+	for _, year := range getAcademicYears() {
+		if holiday, ok := year.holidayAt(start); ok {
+			return "Invalid start time! Tests can't start during a holiday (" + holiday.Name + ")!"
+		}
+	}
+
+	return ""
+}
+
+// validateTestAttempts checks how many attempts a Test object allows and its scoring policy, and returns what is wrong
+// with them, or an empty string if they are valid.
+//
+// The number of attempts ("attempts"), if any, must be a positive number. The scoring policy ("scoringPolicy"), if
+// any, decides which score counts for students who took the test several times: their "best" score, their "last"
+// score or the "average" of their scores.
+func validateTestAttempts(test []byte) string {
+	attempts, err := jsonparser.GetInt(test, "attempts")
+	if (err != nil && err != jsonparser.KeyPathNotFoundError) || (err == nil && attempts <= 0) {
+		return "Invalid attempts! Attempts must be a positive number!"
+	}
+
+	policy, err := jsonparser.GetString(test, "scoringPolicy")
+	if err != nil && err != jsonparser.KeyPathNotFoundError {
+		return "Invalid scoring policy! Must be one of best, last or average!"
+	}
+	if err == nil && policy != scoringBest && policy != scoringLast && policy != scoringAverage {
+		return "Invalid scoring policy! Must be one of best, last or average!"
+	}
+
+	return ""
+}
+
+// validateTestGradeScale checks the grade scale of a Test object ("gradeScale"), if any, and returns what is wrong with
+// it, or an empty string if it is valid. See validateGradeScale.
+func validateTestGradeScale(test []byte) string {
+	scale, _, _, err := jsonparser.Get(test, "gradeScale")
+	if err == jsonparser.KeyPathNotFoundError {
+		return ""
+	}
+	if err != nil {
+		return "Invalid grade scale! Must be an object with exOfficio, rounding and thresholds!"
+	}
+
+	return validateGradeScale(scale)
+}
+
+// validateTestQuestions checks the questions of a Test object that the server scores by itself and returns what is
+// wrong with the first of them found invalid, or an empty string if they are all valid.
+func validateTestQuestions(test []byte) string {
+	if problem := validateExpressionQuestions(test); problem != "" {
+		return problem
+	}
+	if problem := validateProgrammingQuestions(test); problem != "" {
+		return problem
+	}
+
+	return validateMatchingRules(test)
+}
+
+// validateMatchingRules checks the matching rules of the free-text questions of a Test object and returns what is
+// wrong with them, or an empty string if they are valid.
+//
+// The "matching" of a question, if any, may only turn "ignoreCase", "ignoreWhitespace" and "ignoreDiacritics" on or
+// off, list accepted "alternatives" and list "patterns" that must all be valid regular expressions (RE2 syntax).
+func validateMatchingRules(test []byte) string {
+	problem := ""
+
+	jsonparser.ObjectEach(test, func(key []byte, question []byte, dataType jsonparser.ValueType, offset int) error {
+		matchingRules, dataType, _, err := jsonparser.Get(question, "matching")
+		if err == jsonparser.KeyPathNotFoundError {
+			return nil
+		}
+		if err != nil || dataType != jsonparser.Object {
+			problem = "Invalid matching rules for question " + string(key) + "! Matching rules must be an object!"
+			return nil
+		}
+
+		jsonparser.ObjectEach(matchingRules, func(rule []byte, value []byte, dataType jsonparser.ValueType, offset int) error {
+			switch string(rule) {
+			case "ignoreCase", "ignoreWhitespace", "ignoreDiacritics":
+				if dataType != jsonparser.Boolean {
+					problem = "Invalid matching rules for question " + string(key) + "! " + string(rule) +
+						" must be true or false!"
+				}
+			case "alternatives", "patterns":
+				if dataType != jsonparser.Array {
+					problem = "Invalid matching rules for question " + string(key) + "! " + string(rule) +
+						" must be a list of text!"
+				}
+			default:
+				problem = "Invalid matching rules for question " + string(key) + "! Unknown rule " + string(rule) + "!"
+			}
+			return nil
+		})
+
+		matching := getAnswerMatching(question)
+		for _, pattern := range matching.patterns {
+			if _, err := matching.compilePattern(pattern); err != nil {
+				problem = "Invalid pattern for question " + string(key) + "! " + strconv.Quote(pattern) +
+					" is not a valid regular expression!"
+			}
+		}
+		return nil
+	}, "contents")
+
+	return problem
+}
+
+// validateExpressionQuestions checks the expression questions of a Test object and returns what is wrong with them,
+// or an empty string if they are valid.
+//
+// The answer of every question whose "questionType" is "expression" must be a mathematical expression the server can
+// parse (see parseExpression), and its "tolerance", if any, must be a number between 0 and 1.
+func validateExpressionQuestions(test []byte) string {
+	problem := ""
+
+	jsonparser.ObjectEach(test, func(key []byte, question []byte, dataType jsonparser.ValueType, offset int) error {
+		if questionType, _ := jsonparser.GetString(question, "questionType"); questionType != "expression" {
+			return nil
+		}
+
+		answer, _ := jsonparser.GetString(question, "answer")
+		if _, err := parseExpression(answer); err != nil {
+			problem = "Invalid answer for question " + string(key) + "! Cannot parse expression: " + err.Error()
+			return nil
+		}
+
+		tolerance, err := jsonparser.GetFloat(question, "tolerance")
+		if (err != nil && err != jsonparser.KeyPathNotFoundError) || (err == nil && (tolerance < 0 || tolerance >= 1)) {
+			problem = "Invalid tolerance for question " + string(key) + "! Tolerance must be a number between 0 and 1!"
+		}
+		return nil
+	}, "contents")
+
+	return problem
+}
+
+// validateProgrammingQuestions checks the programming questions of a Test object and returns what is wrong with them,
+// or an empty string if they are valid.
+//
+// Programming questions can only be part of Info tests. Every question whose "questionType" is "programming" needs at
+// least one test case, each with an input and an expected output. The "languages" it may be answered in, if any, must
+// be supported by the judge, and its "timeLimit" (in milliseconds) and "memoryLimit" (in megabytes), if any, must be
+// positive and no higher than the maximum limits.
+func validateProgrammingQuestions(test []byte) string {
+	course, _ := jsonparser.GetString(test, "course")
+	problem := ""
+
+	jsonparser.ObjectEach(test, func(key []byte, question []byte, dataType jsonparser.ValueType, offset int) error {
+		if !isProgrammingQuestion(question) {
+			return nil
+		}
+
+		if course != "Info" {
+			problem = "Invalid question " + string(key) + "! Programming questions can only be part of Info tests!"
+			return nil
+		}
+
+		caseCount := 0
+		jsonparser.ArrayEach(question, func(value []byte, dataType jsonparser.ValueType, offset int, err error) {
+			_, inputErr := jsonparser.GetString(value, "input")
+			_, outputErr := jsonparser.GetString(value, "output")
+			if inputErr != nil || outputErr != nil {
+				problem = "Invalid test case for question " + string(key) + "! Every test case needs an input and an output!"
+			}
+			caseCount++
+		}, "testCases")
+		if caseCount == 0 {
+			problem = "Invalid question " + string(key) + "! Programming questions need at least one test case!"
+		}
+
+		for _, language := range getQuestionLanguages(question) {
+			if _, ok := judgeSourceFiles[language]; !ok {
+				problem = "Invalid language for question " + string(key) + "! Must be one of cpp or python!"
+			}
+		}
+
+		timeLimit, err := jsonparser.GetInt(question, "timeLimit")
+		if (err != nil && err != jsonparser.KeyPathNotFoundError) ||
+			(err == nil && (timeLimit <= 0 || timeLimit > maximumTimeLimit)) {
+			problem = "Invalid time limit for question " + string(key) + "! Time limit must be between 1 and " +
+				strconv.Itoa(maximumTimeLimit) + " milliseconds!"
+		}
+
+		memoryLimit, err := jsonparser.GetInt(question, "memoryLimit")
+		if (err != nil && err != jsonparser.KeyPathNotFoundError) ||
+			(err == nil && (memoryLimit <= 0 || memoryLimit > maximumMemoryLimit)) {
+			problem = "Invalid memory limit for question " + string(key) + "! Memory limit must be between 1 and " +
+				strconv.Itoa(maximumMemoryLimit) + " megabytes!"
+		}
+		return nil
+	}, "contents")
+
+	return problem
+}
+
+// validateTestTargets checks who a Test object targets and returns what is wrong with its targets, or an empty string
+// if they are valid.
+//
+// A test targets either the class given by its "grade" and "gradeLetter", or the classes, student groups and students
+// listed in its "targets", or both, i.e.
+//
+//	"targets": {"classes": [{"grade": 10, "gradeLetter": "A"}], "groups": ["[GROUP ID]"], "students": ["[STUDENT ID]"]}
+//
+// Every student group and every student listed must exist, and the test must target somebody.
+func validateTestTargets(test []byte) string {
+	targetCount := 0
+
+	if _, err := jsonparser.GetInt(test, "grade"); err == nil {
+		targetCount++
+	}
+
+	problem := ""
+
+	_, err := jsonparser.ArrayEach(test, func(value []byte, dataType jsonparser.ValueType, offset int, err1 error) {
+		grade, err2 := jsonparser.GetInt(value, "grade")
+		gradeLetter, err3 := jsonparser.GetString(value, "gradeLetter")
+		if err2 != nil || err3 != nil || grade <= 0 || gradeLetter == "" {
+			problem = "Invalid target class! Every class needs a grade and a grade letter!"
+		}
+		targetCount++
+	}, "targets", "classes")
+	if err != nil && err != jsonparser.KeyPathNotFoundError {
+		return "Invalid target classes! Classes must be a list of grades and grade letters!"
+	}
+
+	_, err = jsonparser.ArrayEach(test, func(value []byte, dataType jsonparser.ValueType, offset int, err1 error) {
+		if GetStudentGroup(string(value)) == "notFound" {
+			problem = "Invalid target group! Student group " + string(value) + " doesn't exist!"
+		}
+		targetCount++
+	}, "targets", "groups")
+	if err != nil && err != jsonparser.KeyPathNotFoundError {
+		return "Invalid target groups! Groups must be a list of student group IDs!"
+	}
+
+	_, err = jsonparser.ArrayEach(test, func(value []byte, dataType jsonparser.ValueType, offset int, err1 error) {
+		if GetStudentObjectByID(string(value)) == "notFound" {
+			problem = "Invalid target student! Student " + string(value) + " doesn't exist!"
+		}
+		targetCount++
+	}, "targets", "students")
+	if err != nil && err != jsonparser.KeyPathNotFoundError {
+		return "Invalid target students! Students must be a list of student IDs!"
+	}
+
+	if problem == "" && targetCount == 0 {
+		problem = "Invalid targets! A test must target at least one class, student group or student!"
+	}
+
+	return problem
+}
+
+// describeTestTargets sums up who a Test object targets, i.e. "10A, 10B, group [GROUP ID], student [STUDENT ID]".
+func describeTestTargets(test []byte) string {
+	var targets []string
+
+	if grade, err := jsonparser.GetInt(test, "grade"); err == nil {
+		gradeLetter, _ := jsonparser.GetString(test, "gradeLetter")
+		targets = append(targets, strconv.Itoa(int(grade))+gradeLetter)
+	}
+
+	jsonparser.ArrayEach(test, func(value []byte, dataType jsonparser.ValueType, offset int, err error) {
+		grade, _ := jsonparser.GetInt(value, "grade")
+		gradeLetter, _ := jsonparser.GetString(value, "gradeLetter")
+		targets = append(targets, strconv.Itoa(int(grade))+gradeLetter)
+	}, "targets", "classes")
+
+	jsonparser.ArrayEach(test, func(value []byte, dataType jsonparser.ValueType, offset int, err error) {
+		targets = append(targets, "group "+string(value))
+	}, "targets", "groups")
+
+	jsonparser.ArrayEach(test, func(value []byte, dataType jsonparser.ValueType, offset int, err error) {
+		targets = append(targets, "student "+string(value))
+	}, "targets", "students")
+
+	return strings.Join(targets, ", ")
+}
+
+// setTestOverride gives a specific student an override on a test, provided it is given the credentials of a teacher of
+// the course of the test. Other teachers are answered with a Forbidden (403) response code.
+//
+// An override can give the student extra time (in minutes) for documented accommodations, a separate make-up window
+// (a start time and an end time) for students who were absent, or both. Every override must state its reason.
+// getTestQueue, getTest and submitAnswerSheet all respect the override. Setting an override again replaces the old one.
+//
+// It will fail with a Bad Request (400) response code if the override is invalid, and with a Resource Not Found (404)
+// response code if the test or the student don't exist.
+func setTestOverride(w http.ResponseWriter, r *http.Request) {
+	requestVars := mux.Vars(r)
+
+	//first we strip out the authentication from the header
+	username, password, authOK := r.BasicAuth()
+
+	responseCode := http.StatusOK
+
+	teacherID := FindTeacherID(username, password)
+
+	templateFile, _ := os.Open("templates/TestOverrideTemplate.json")
+
+	//then we check to see if authOK
+	if !authOK {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid authentication scheme!")
+		return
+	}
+
+	//see if teacher exists
+	if teacherID == "notFound" {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid username and password combination!")
+		return
+	}
+
+	if GetTest(requestVars["testID"]) == "notFound" || GetStudentObjectByID(requestVars["studentID"]) == "notFound" {
+		responseCode = http.StatusNotFound
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "404 test or student not found!")
+		return
+	}
+
+	if !teachesTest(teacherID, requestVars["testID"]) {
+		responseCode = http.StatusForbidden
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Only teachers of the course of this test can set its overrides!")
+		return
+	}
+
+	if status := GetTestStatus(requestVars["testID"]); status != testActive {
+		responseCode = http.StatusGone
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "This test has been "+status+"! It can no longer be changed.")
+		return
+	}
+
+	//validate JSON!
+	// we pretty much only care for the final error, since the rest of the stuff here is unlikely to ever fail randomly.
+	templateString, _ := ioutil.ReadAll(templateFile)
+
+	overrideTemplate := gojsonschema.NewStringLoader(string(templateString))
+
+	body, _ := ioutil.ReadAll(r.Body)
+
+	overrideResponse := gojsonschema.NewStringLoader(string(body))
+
+	validation, err := gojsonschema.Validate(overrideTemplate, overrideResponse)
+	if err != nil || !validation.Valid() {
+		APILogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Warn("Could not validate JSON schema and document for setting test override!")
+		responseCode = http.StatusBadRequest
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid TestOverride object!")
+		return
+	}
+
+	if problem := validateTestOverride(body); problem != "" {
+		responseCode = http.StatusBadRequest
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, problem)
+		return
+	}
+
+	SetTestOverride(requestVars["testID"], requestVars["studentID"], string(body), teacherID)
+
+	fmt.Fprint(w, "Test override set!")
+
+	APILogger.WithFields(logrus.Fields{
+		"host":         r.RemoteAddr,
+		"userAgent":    r.UserAgent(),
+		"teacherID":    teacherID,
+		"studentID":    requestVars["studentID"],
+		"testID":       requestVars["testID"],
+		"responseCode": responseCode,
+	}).Info("setTestOverride hit")
+}
+
+// validateTestOverride checks a TestOverride object and returns what is wrong with it, or an empty string if it is
+// valid.
+func validateTestOverride(override []byte) string {
+	reason, _ := jsonparser.GetString(override, "reason")
+	if strings.TrimSpace(reason) == "" {
+		return "Invalid override! Every override must state its reason!"
+	}
+
+	extraTime, err := jsonparser.GetInt(override, "extraTime")
+	if (err != nil && err != jsonparser.KeyPathNotFoundError) || extraTime < 0 {
+		return "Invalid override! Extra time must be a positive number of minutes!"
+	}
+
+	startTime, startErr := jsonparser.GetString(override, "startTime")
+	endTime, endErr := jsonparser.GetString(override, "endTime")
+	if startErr == jsonparser.KeyPathNotFoundError && endErr == jsonparser.KeyPathNotFoundError {
+		return ""
+	}
+
+	start, startErr := parseTestTime(startTime)
+	end, endErr := parseTestTime(endTime)
+	if startErr != nil || endErr != nil || !start.Before(end) {
+		return "Invalid override! A make-up window needs both a start time and a later end time, as RFC 3339 timestamps!"
+	}
+
+	return ""
+}
+
+// getTestOverride sends back the override a specific student has on a test. Only teachers of the course of the test can
+// see its overrides, the others being answered with a Forbidden (403) response code.
+//
+// It will send back a Resource Not Found (404) response code if the student has no override on the test.
+func getTestOverride(w http.ResponseWriter, r *http.Request) {
+	requestVars := mux.Vars(r)
+	responseCode := http.StatusOK
+
+	username, password, authOK := r.BasicAuth()
+
+	teacherID := FindTeacherID(username, password)
+
+	if !authOK {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid authentication scheme!")
+		return
+	}
+
+	//see if teacher exists
+	if teacherID == "notFound" {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid username and password combination!")
+		return
+	}
+
+	if !teachesTest(teacherID, requestVars["testID"]) {
+		responseCode = http.StatusForbidden
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Only teachers of the course of this test can see its overrides!")
+		return
+	}
+
+	override := GetTestOverride(requestVars["testID"], requestVars["studentID"])
+
+	if override == "notFound" {
+		responseCode = http.StatusNotFound
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "404 override not found!")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, override)
+
+	APILogger.WithFields(logrus.Fields{
+		"host":         r.RemoteAddr,
+		"userAgent":    r.UserAgent(),
+		"teacherID":    teacherID,
+		"studentID":    requestVars["studentID"],
+		"testID":       requestVars["testID"],
+		"responseCode": responseCode,
+	}).Info("getTestOverride hit")
+}
+
+// removeTestOverride removes the override a specific student has on a test, provided it is given the credentials of a
+// teacher of the course of the test. From then on, the student takes the test in the same window as their class.
+// Other teachers are answered with a Forbidden (403) response code.
+//
+// It will send back a Resource Not Found (404) response code if the student has no override on the test.
+func removeTestOverride(w http.ResponseWriter, r *http.Request) {
+	requestVars := mux.Vars(r)
+	responseCode := http.StatusOK
+
+	username, password, authOK := r.BasicAuth()
+
+	teacherID := FindTeacherID(username, password)
+
+	if !authOK {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid authentication scheme!")
+		return
+	}
+
+	//see if teacher exists
+	if teacherID == "notFound" {
+		responseCode = http.StatusUnauthorized
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Invalid username and password combination!")
+		return
+	}
+
+	if !teachesTest(teacherID, requestVars["testID"]) {
+		responseCode = http.StatusForbidden
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Only teachers of the course of this test can remove its overrides!")
+		return
+	}
+
+	if !RemoveTestOverride(requestVars["testID"], requestVars["studentID"]) {
+		responseCode = http.StatusNotFound
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "404 override not found!")
+		return
+	}
+
+	fmt.Fprint(w, "Test override removed!")
+
+	APILogger.WithFields(logrus.Fields{
+		"host":         r.RemoteAddr,
+		"userAgent":    r.UserAgent(),
+		"teacherID":    teacherID,
+		"studentID":    requestVars["studentID"],
+		"testID":       requestVars["testID"],
+		"responseCode": responseCode,
+	}).Info("removeTestOverride hit")
+}
@@ -420,3 +420,80 @@ func listClassbook(w http.ResponseWriter, r *http.Request) {
 		"grade":     requestVars["grade"] + requestVars["gradeLetter"],
 	}).Info("listClassbook hit")
 }
+
+// registerParent adds the provided Parent object to the database, provided the body contains valid JSON for a Parent
+// object and the request is made with the admin credentials. Parents can see the grades of their children ("children",
+// a list of student IDs), so they can't register themselves.
+//
+// If the JSON isn't valid, or any of the children doesn't exist, then the HTTP handler returns a Bad Request (400)
+// response code. If the parent is successfully registered, then the handler returns the ID of the new parent.
+func registerParent(w http.ResponseWriter, r *http.Request) {
+	responseCode := http.StatusOK
+
+	username, password, authOK := r.BasicAuth()
+
+	user, pass := GetAdminCreds()
+
+	if !authOK || (username != user || password != pass) {
+		responseCode = http.StatusUnauthorized
+		w.Header().Set("WWW-Authenticate", `Basic realm="Access to the admin section"`)
+		http.Error(w, "Invalid authentication scheme!", responseCode)
+		return
+	}
+
+	templateFile, err := os.Open("templates/ParentTemplate.json")
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Warn("Could not open ParentTemplate file!")
+	}
+	defer templateFile.Close()
+
+	// we pretty much only care for the final error, since the rest of the stuff here is unlikely to ever fail randomly.
+	templateString, _ := ioutil.ReadAll(templateFile)
+
+	parentTemplate := gojsonschema.NewStringLoader(string(templateString))
+
+	body, _ := ioutil.ReadAll(r.Body)
+
+	parentResponse := gojsonschema.NewStringLoader(string(body))
+
+	validation, err := gojsonschema.Validate(parentTemplate, parentResponse)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Warn("Could not validate JSON schema and document for registering Parent")
+	}
+
+	childrenFound := true
+	childrenCount := 0
+	_, err = jsonparser.ArrayEach(body, func(value []byte, dataType jsonparser.ValueType, offset int, err1 error) {
+		childrenCount++
+		if dataType != jsonparser.String || GetStudentObjectByID(string(value)) == "notFound" {
+			childrenFound = false
+		}
+	}, "children")
+
+	if validation == nil || !validation.Valid() || err != nil || childrenCount == 0 {
+		responseCode = http.StatusBadRequest
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Sent parent JSON not valid! Reevaluate")
+	} else if !childrenFound {
+		responseCode = http.StatusBadRequest
+		w.WriteHeader(responseCode)
+		fmt.Fprint(w, "Some of the children of the parent don't exist!")
+	} else {
+		RegisterParent(string(body))
+
+		parentUser, _ := jsonparser.GetString(body, "account", "userName")
+		parentPass, _ := jsonparser.GetString(body, "account", "password")
+
+		fmt.Fprint(w, FindParentID(parentUser, parentPass))
+	}
+
+	APILogger.WithFields(logrus.Fields{
+		"host":         r.RemoteAddr,
+		"userAgent":    r.UserAgent(),
+		"responseCode": responseCode,
+	}).Info("registerParent hit")
+}
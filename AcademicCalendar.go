@@ -0,0 +1,345 @@
+/*
+ * This file is part of VianuEdu.
+ *
+ *  VianuEdu is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ *  VianuEdu is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with VianuEdu.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * Developed by Matei Gardus <matei@gardus.eu>
+ */
+
+package vianueduserver
+
+import (
+	"encoding/json"
+	"github.com/buger/jsonparser"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// calendarDateLayout is the layout of the dates of the academic calendar, which are days in the timezone of the
+// school, i.e. "2025-09-08".
+const calendarDateLayout = "2006-01-02"
+
+// academicYearPattern matches the names of academic years, i.e. "2025-2026".
+var academicYearPattern = regexp.MustCompile(`^[0-9]{4}-[0-9]{4}$`)
+
+// An AcademicYear is a school year of the academic calendar, with its semesters, in order, and its holidays, i.e.
+//
+//	{"year": "2025-2026",
+//	 "semesters": [{"start": "2025-09-08", "end": "2026-01-30"}, {"start": "2026-02-09", "end": "2026-06-19"}],
+//	 "holidays": [{"name": "Vacanța de iarnă", "start": "2025-12-20", "end": "2026-01-07"}]}
+//
+// Every period of the calendar lasts from its first day to its last day, both included.
+type AcademicYear struct {
+	Year      string           `json:"year"`
+	Semesters []CalendarPeriod `json:"semesters"`
+	Holidays  []CalendarPeriod `json:"holidays"`
+}
+
+// A CalendarPeriod is a semester or a holiday of an academic year.
+type CalendarPeriod struct {
+	Name  string `json:"name,omitempty"`
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+// A Term is a semester of an academic year, from its first day (Start) to its last day (End), both at midnight in the
+// timezone of the school. A Term numbered 0 stands for the whole academic year, and a Term without a year for no
+// academic year at all, i.e. everything.
+type Term struct {
+	Year   string    `json:"year"`
+	Number int       `json:"number"`
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+}
+
+// parseCalendarDate parses a date of the academic calendar, at midnight in the timezone of the school.
+func parseCalendarDate(value string) (time.Time, error) {
+	return time.ParseInLocation(calendarDateLayout, value, schoolTimezone)
+}
+
+// bounds returns the first day of a calendar period and the moment right after its last day.
+func (period CalendarPeriod) bounds() (time.Time, time.Time) {
+	start, _ := parseCalendarDate(period.Start)
+	end, _ := parseCalendarDate(period.End)
+
+	return start, end.AddDate(0, 0, 1)
+}
+
+// contains checks whether a moment falls on one of the days of a calendar period.
+func (period CalendarPeriod) contains(moment time.Time) bool {
+	start, until := period.bounds()
+
+	return !moment.Before(start) && moment.Before(until)
+}
+
+// terms returns the semesters of an academic year, in order.
+func (year AcademicYear) terms() []Term {
+	var terms []Term
+
+	for index, semester := range year.Semesters {
+		start, _ := parseCalendarDate(semester.Start)
+		end, _ := parseCalendarDate(semester.End)
+		terms = append(terms, Term{Year: year.Year, Number: index + 1, Start: start, End: end})
+	}
+
+	return terms
+}
+
+// wholeYear returns the Term standing for the whole academic year, from the first day of its first semester to the
+// last day of its last semester.
+func (year AcademicYear) wholeYear() Term {
+	terms := year.terms()
+	if len(terms) == 0 {
+		return Term{Year: year.Year}
+	}
+
+	return Term{Year: year.Year, Start: terms[0].Start, End: terms[len(terms)-1].End}
+}
+
+// termAt returns the semester of the academic year a moment falls in, or the whole academic year if the moment falls
+// between two of its semesters. The method returns false if the moment falls outside the academic year.
+func (year AcademicYear) termAt(moment time.Time) (Term, bool) {
+	for index, semester := range year.Semesters {
+		if semester.contains(moment) {
+			return year.terms()[index], true
+		}
+	}
+
+	whole := year.wholeYear()
+	if !moment.Before(whole.Start) && moment.Before(whole.End.AddDate(0, 0, 1)) {
+		return whole, true
+	}
+
+	return Term{}, false
+}
+
+// currentTerm returns the semester of the academic year a moment falls in or, outside its semesters, the latest
+// semester that had already started, or else its first semester.
+func (year AcademicYear) currentTerm(moment time.Time) Term {
+	terms := year.terms()
+	if len(terms) == 0 {
+		return year.wholeYear()
+	}
+
+	current := terms[0]
+	for _, term := range terms {
+		if !moment.Before(term.Start) {
+			current = term
+		}
+	}
+
+	return current
+}
+
+// holidayAt returns the holiday of the academic year a moment falls in, if any.
+func (year AcademicYear) holidayAt(moment time.Time) (CalendarPeriod, bool) {
+	for _, holiday := range year.Holidays {
+		if holiday.contains(moment) {
+			return holiday, true
+		}
+	}
+
+	return CalendarPeriod{}, false
+}
+
+// getAcademicYears returns every academic year of the academic calendar, oldest first.
+func getAcademicYears() []AcademicYear {
+	var years []AcademicYear
+
+	if list := ListAcademicYears(); list != "notFound" {
+		json.Unmarshal([]byte(list), &years)
+	}
+
+	sort.SliceStable(years, func(i, j int) bool {
+		return years[i].Year < years[j].Year
+	})
+
+	return years
+}
+
+// currentAcademicYear returns the academic year a moment falls in or, between academic years, the latest academic
+// year that had already started. The method returns false if no academic year had started yet.
+func currentAcademicYear(moment time.Time) (AcademicYear, bool) {
+	var current AcademicYear
+	found := false
+
+	for _, year := range getAcademicYears() {
+		if start := year.wholeYear().Start; !moment.Before(start) {
+			current = year
+			found = true
+		}
+	}
+
+	return current, found
+}
+
+// findAcademicYear returns the academic year with the provided name, or the current one if the name is "current".
+func findAcademicYear(name string) (AcademicYear, bool) {
+	if name == "current" {
+		return currentAcademicYear(time.Now())
+	}
+
+	for _, year := range getAcademicYears() {
+		if year.Year == name {
+			return year, true
+		}
+	}
+
+	return AcademicYear{}, false
+}
+
+// academicTermAt returns the semester of the academic calendar a moment falls in, or the academic year it falls in if
+// it falls between two semesters. The method returns false if the moment falls outside every academic year.
+func academicTermAt(moment time.Time) (Term, bool) {
+	for _, year := range getAcademicYears() {
+		if term, ok := year.termAt(moment); ok {
+			return term, true
+		}
+	}
+
+	return Term{}, false
+}
+
+// withAcademicTerm returns a Test, Grade or Lesson object scoped to a term of the academic calendar, i.e. with its
+// academic year ("academicYear") and semester ("semester") set to those of the term. Whatever the document said before
+// is dropped, so documents outside every academic year are left unscoped.
+func withAcademicTerm(document []byte, term Term) []byte {
+	document = jsonparser.Delete(document, "academicYear")
+	document = jsonparser.Delete(document, "semester")
+
+	if term.Year == "" {
+		return document
+	}
+
+	if result, err := jsonparser.Set(document, []byte(strconv.Quote(term.Year)), "academicYear"); err == nil {
+		document = result
+	}
+	if term.Number > 0 {
+		if result, err := jsonparser.Set(document, []byte(strconv.Itoa(term.Number)), "semester"); err == nil {
+			document = result
+		}
+	}
+
+	return document
+}
+
+// testTerm returns the term of the academic calendar a Test object falls in, which is the semester its start time
+// falls in (see academicTermAt).
+func testTerm(test []byte) Term {
+	startTime, _ := jsonparser.GetString(readTestTimes(test), "startTime")
+
+	start, err := parseTestTime(startTime)
+	if err != nil {
+		return Term{}
+	}
+
+	term, _ := academicTermAt(start)
+
+	return term
+}
+
+// requestedTerm reads the term a request is scoped to, asked for with "?year=2025-2026&semester=1". Leaving out the
+// year asks for the current academic year, and leaving out the semester asks for the whole academic year.
+//
+// Requests that don't ask for a year aren't scoped at all as long as the academic calendar is empty. The method
+// returns a response code and a problem to send back if the term can't be found.
+func requestedTerm(r *http.Request) (Term, int, string) {
+	name := r.URL.Query().Get("year")
+	if name == "" {
+		if len(getAcademicYears()) == 0 && r.URL.Query().Get("semester") == "" {
+			return Term{}, http.StatusOK, ""
+		}
+		name = "current"
+	}
+
+	year, ok := findAcademicYear(name)
+	if !ok {
+		return Term{}, http.StatusNotFound, "404 academic year not found!"
+	}
+
+	semester := r.URL.Query().Get("semester")
+	if semester == "" {
+		return year.wholeYear(), http.StatusOK, ""
+	}
+
+	number, err := strconv.Atoi(semester)
+	if err != nil || number < 1 || number > len(year.Semesters) {
+		return Term{}, http.StatusBadRequest, "Invalid semester! Must be a number between 1 and " +
+			strconv.Itoa(len(year.Semesters)) + "!"
+	}
+
+	return year.terms()[number-1], http.StatusOK, ""
+}
+
+// validateAcademicYear checks an AcademicYear object and returns what is wrong with it, or an empty string if it is
+// valid.
+//
+// The year must be named after the calendar years it spans, i.e. "2025-2026", and have at least one semester. Every
+// period must end on or after the day it starts, semesters can't overlap and must be listed in order, and holidays must
+// have a name and fall within the academic year.
+func validateAcademicYear(document []byte) string {
+	var year AcademicYear
+	if err := json.Unmarshal(document, &year); err != nil {
+		return "Invalid academic year! Must be an object with year, semesters and holidays!"
+	}
+
+	if !academicYearPattern.MatchString(year.Year) {
+		return "Invalid academic year! Its name must be the calendar years it spans, i.e. \"2025-2026\"!"
+	}
+	first, _ := strconv.Atoi(year.Year[:4])
+	second, _ := strconv.Atoi(year.Year[5:])
+	if second != first+1 {
+		return "Invalid academic year! Its name must be the calendar years it spans, i.e. \"2025-2026\"!"
+	}
+
+	if len(year.Semesters) == 0 {
+		return "Invalid academic year! It must have at least one semester!"
+	}
+
+	periods := append(append([]CalendarPeriod(nil), year.Semesters...), year.Holidays...)
+	for _, period := range periods {
+		start, err1 := parseCalendarDate(period.Start)
+		end, err2 := parseCalendarDate(period.End)
+		if err1 != nil || err2 != nil {
+			return "Invalid date! Dates must be written as \"2025-09-08\"!"
+		}
+		if end.Before(start) {
+			return "Invalid period! Periods can't end before they start!"
+		}
+	}
+
+	for index := 1; index < len(year.Semesters); index++ {
+		_, previousUntil := year.Semesters[index-1].bounds()
+		start, _ := year.Semesters[index].bounds()
+		if start.Before(previousUntil) {
+			return "Invalid semesters! Semesters must be listed in order and can't overlap!"
+		}
+	}
+
+	whole := year.wholeYear()
+	for _, holiday := range year.Holidays {
+		start, until := holiday.bounds()
+		if holiday.Name == "" {
+			return "Invalid holiday! Every holiday must have a name!"
+		}
+		if start.Before(whole.Start) || until.After(whole.End.AddDate(0, 0, 1)) {
+			return "Invalid holiday! Holidays must fall within the academic year!"
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,256 @@
+/*
+ * This file is part of VianuEdu.
+ *
+ *  VianuEdu is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ *  VianuEdu is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with VianuEdu.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * Developed by Matei Gardus <matei@gardus.eu>
+ */
+
+package vianueduserver
+
+import (
+	"github.com/buger/jsonparser"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// diacriticFolder replaces the letters with diacritics found in Romanian answers, cedilla and comma below alike, along
+// with the other accented letters students are likely to write, with the letters they are built on.
+var diacriticFolder = strings.NewReplacer(
+	"ă", "a", "â", "a", "î", "i", "ș", "s", "ş", "s", "ț", "t", "ţ", "t",
+	"Ă", "A", "Â", "A", "Î", "I", "Ș", "S", "Ş", "S", "Ț", "T", "Ţ", "T",
+	"á", "a", "à", "a", "ä", "a", "ã", "a", "é", "e", "è", "e", "ê", "e", "ë", "e", "í", "i", "ï", "i",
+	"ó", "o", "ò", "o", "ô", "o", "ö", "o", "ú", "u", "ù", "u", "û", "u", "ü", "u", "ç", "c", "ñ", "n",
+	"Á", "A", "À", "A", "Ä", "A", "Ã", "A", "É", "E", "È", "E", "Ê", "E", "Ë", "E", "Í", "I", "Ï", "I",
+	"Ó", "O", "Ò", "O", "Ô", "O", "Ö", "O", "Ú", "U", "Ù", "U", "Û", "U", "Ü", "U", "Ç", "C", "Ñ", "N",
+)
+
+// compiledPatterns keeps the patterns of matching rules already compiled, by the regular expression they were compiled
+// to, so that each pattern is compiled once rather than for every answer it is matched against.
+var (
+	compiledPatterns      = map[string]*regexp.Regexp{}
+	compiledPatternsMutex sync.Mutex
+)
+
+// answerMatching holds the rules a free-text answer is matched against the answer key of its question with, as found
+// in the "matching" of the question, i.e.
+//
+//	"matching": {"ignoreCase": true, "ignoreWhitespace": true, "ignoreDiacritics": true,
+//	             "alternatives": ["Dunărea"], "patterns": ["(fluviul )?dunarea"]}
+//
+// Case, whitespace and diacritics are ignored unless the question says otherwise.
+type answerMatching struct {
+	ignoreCase       bool
+	ignoreWhitespace bool
+	ignoreDiacritics bool
+	alternatives     []string
+	patterns         []string
+}
+
+// A MatchingReview lists every distinct answer given to the free-text questions of a test that are matched against
+// their answer key, along with the decision taken on it, for the teacher to review.
+type MatchingReview struct {
+	TestID    string           `json:"testID"`
+	Questions []QuestionReview `json:"questions"`
+}
+
+// A QuestionReview lists the distinct answers given to a single question, the wrong ones first.
+type QuestionReview struct {
+	Question  string           `json:"question"`
+	AnswerKey string           `json:"answerKey"`
+	Answers   []ReviewedAnswer `json:"answers"`
+}
+
+// A ReviewedAnswer is an answer given by Count students, along with whether it matched the answer key and which rule
+// it matched by (see matchTextAnswer).
+type ReviewedAnswer struct {
+	Answer    string `json:"answer"`
+	Count     int    `json:"count"`
+	Right     bool   `json:"right"`
+	MatchedBy string `json:"matchedBy,omitempty"`
+}
+
+// isMatchedTextQuestion checks whether a question of a Test object is a free-text ("normal") question with matching
+// rules, in which case its answers are matched against its answer key rather than left for the teacher.
+func isMatchedTextQuestion(question []byte) bool {
+	questionType, _ := jsonparser.GetString(question, "questionType")
+	_, dataType, _, err := jsonparser.Get(question, "matching")
+
+	return questionType == "normal" && err == nil && dataType == jsonparser.Object
+}
+
+// getAnswerMatching reads the matching rules of a free-text question of a Test object.
+func getAnswerMatching(question []byte) answerMatching {
+	matching := answerMatching{ignoreCase: true, ignoreWhitespace: true, ignoreDiacritics: true}
+
+	if ignoreCase, err := jsonparser.GetBoolean(question, "matching", "ignoreCase"); err == nil {
+		matching.ignoreCase = ignoreCase
+	}
+	if ignoreWhitespace, err := jsonparser.GetBoolean(question, "matching", "ignoreWhitespace"); err == nil {
+		matching.ignoreWhitespace = ignoreWhitespace
+	}
+	if ignoreDiacritics, err := jsonparser.GetBoolean(question, "matching", "ignoreDiacritics"); err == nil {
+		matching.ignoreDiacritics = ignoreDiacritics
+	}
+
+	jsonparser.ArrayEach(question, func(value []byte, dataType jsonparser.ValueType, offset int, err error) {
+		if alternative, err := jsonparser.ParseString(value); err == nil {
+			matching.alternatives = append(matching.alternatives, alternative)
+		}
+	}, "matching", "alternatives")
+	jsonparser.ArrayEach(question, func(value []byte, dataType jsonparser.ValueType, offset int, err error) {
+		if pattern, err := jsonparser.ParseString(value); err == nil {
+			matching.patterns = append(matching.patterns, pattern)
+		}
+	}, "matching", "patterns")
+
+	return matching
+}
+
+// normalize applies the matching rules to an answer, so that answers only differing in what the rules ignore end up
+// the same. Ignoring whitespace trims the answer and turns every run of whitespace inside it into a single space.
+func (matching answerMatching) normalize(answer string) string {
+	if matching.ignoreWhitespace {
+		answer = strings.Join(strings.Fields(answer), " ")
+	}
+	if matching.ignoreDiacritics {
+		answer = diacriticFolder.Replace(answer)
+	}
+	if matching.ignoreCase {
+		answer = strings.ToLower(answer)
+	}
+
+	return answer
+}
+
+// compilePattern compiles a pattern of the matching rules so that it must match a whole answer, normalized by the same
+// rules: diacritics are folded out of the pattern if the rules ignore them, and case is ignored with the (?i) flag
+// rather than by lowercasing the pattern, which would turn escapes such as \D into others.
+func (matching answerMatching) compilePattern(pattern string) (*regexp.Regexp, error) {
+	flags := ""
+	if matching.ignoreCase {
+		flags = "(?i)"
+	}
+	if matching.ignoreDiacritics {
+		pattern = diacriticFolder.Replace(pattern)
+	}
+	source := flags + "^(?:" + pattern + ")$"
+
+	compiledPatternsMutex.Lock()
+	defer compiledPatternsMutex.Unlock()
+
+	if expression, ok := compiledPatterns[source]; ok {
+		return expression, nil
+	}
+
+	expression, err := regexp.Compile(source)
+	if err != nil {
+		return nil, err
+	}
+	compiledPatterns[source] = expression
+
+	return expression, nil
+}
+
+// matchTextAnswer matches an answer to a free-text question against an entry of its answer key, using the matching
+// rules of the question, and returns which rule it matched by: the "answer" key itself, an "alternative" answer or a
+// "pattern", followed by the alternative or pattern, i.e. "alternative: Dunărea".
+//
+// Alternatives are compared the same way the answer key is, while patterns are regular expressions (RE2 syntax) that
+// must match the whole answer, once whitespace, case and diacritics have been dealt with (see compilePattern). Empty
+// answers never match.
+func matchTextAnswer(question []byte, answer, key string) (bool, string) {
+	matching := getAnswerMatching(question)
+
+	normalized := matching.normalize(answer)
+	if strings.TrimSpace(normalized) == "" {
+		return false, ""
+	}
+
+	if normalized == matching.normalize(key) {
+		return true, "answer"
+	}
+
+	for _, alternative := range matching.alternatives {
+		if normalized == matching.normalize(alternative) {
+			return true, "alternative: " + alternative
+		}
+	}
+
+	for _, pattern := range matching.patterns {
+		expression, err := matching.compilePattern(pattern)
+		if err == nil && expression.MatchString(normalized) {
+			return true, "pattern: " + pattern
+		}
+	}
+
+	return false, ""
+}
+
+// reviewAnswerMatching lists every distinct answer given to the free-text questions of a test with matching rules,
+// graded or not, along with whether it matched the answer key and by which rule. Each answer is matched against the
+// test as its student took it, questions drawn from the question bank included.
+func reviewAnswerMatching(testID, test string) MatchingReview {
+	review := MatchingReview{TestID: testID, Questions: []QuestionReview{}}
+
+	responses, _ := collectItemResponses(testID, test)
+
+	for _, questionNumber := range listQuestionNumbers(responses) {
+		questionReview := QuestionReview{Question: questionNumber, Answers: []ReviewedAnswer{}}
+		answers := map[string]int{}
+
+		for _, response := range responses {
+			question, _, _, err := jsonparser.Get(response.test, "contents", questionNumber)
+			if err != nil || !isMatchedTextQuestion(question) {
+				continue
+			}
+
+			answer, _ := jsonparser.GetString(response.answers, questionNumber)
+			answer = strings.TrimSpace(answer)
+			if answer == "" {
+				continue
+			}
+
+			key := answerKeyEntry(question)
+			questionReview.AnswerKey = key
+
+			index, seen := answers[answer]
+			if !seen {
+				right, matchedBy := matchTextAnswer(question, answer, key)
+				index = len(questionReview.Answers)
+				answers[answer] = index
+				questionReview.Answers = append(questionReview.Answers, ReviewedAnswer{Answer: answer, Right: right,
+					MatchedBy: matchedBy})
+			}
+			questionReview.Answers[index].Count++
+		}
+
+		if len(questionReview.Answers) == 0 {
+			continue
+		}
+
+		sort.SliceStable(questionReview.Answers, func(i, j int) bool {
+			if questionReview.Answers[i].Right != questionReview.Answers[j].Right {
+				return !questionReview.Answers[i].Right
+			}
+			return questionReview.Answers[i].Count > questionReview.Answers[j].Count
+		})
+
+		review.Questions = append(review.Questions, questionReview)
+	}
+
+	return review
+}
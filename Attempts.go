@@ -0,0 +1,216 @@
+/*
+ * This file is part of VianuEdu.
+ *
+ *  VianuEdu is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ *  VianuEdu is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with VianuEdu.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * Developed by Matei Gardus <matei@gardus.eu>
+ */
+
+package vianueduserver
+
+import (
+	"github.com/buger/jsonparser"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// The scoring policies of a test decide which score counts for a student who took it several times.
+const (
+	scoringBest    = "best"
+	scoringLast    = "last"
+	scoringAverage = "average"
+)
+
+// An AttemptSummary lists every attempt of a student on a test, along with the score and the mark that count for the
+// student under the scoring policy of the test. They are left empty until at least one attempt has been graded.
+type AttemptSummary struct {
+	TestID        string    `json:"testID"`
+	StudentID     string    `json:"studentID"`
+	AttemptLimit  int       `json:"attemptLimit"`
+	ScoringPolicy string    `json:"scoringPolicy"`
+	AttemptsLeft  int       `json:"attemptsLeft"`
+	Score         *float64  `json:"score"`
+	Mark          *float64  `json:"mark"`
+	Attempts      []Attempt `json:"attempts"`
+}
+
+// An Attempt is a single answer sheet a student submitted on a test, either "graded", along with its grade and its
+// mark, or "submitted" if it is still waiting to be graded.
+type Attempt struct {
+	Attempt       int      `json:"attempt"`
+	Status        string   `json:"status"`
+	SubmittedAt   string   `json:"submittedAt,omitempty"`
+	Late          bool     `json:"late"`
+	AutoSubmitted bool     `json:"autoSubmitted"`
+	Grade         *float64 `json:"grade,omitempty"`
+	MaximumGrade  *float64 `json:"maximumGrade,omitempty"`
+	Mark          *float64 `json:"mark,omitempty"`
+}
+
+// getAttemptPolicy returns how many attempts a Test object allows ("attempts") and its scoring policy
+// ("scoringPolicy"). Tests allow a single attempt and keep the best score unless told otherwise.
+func getAttemptPolicy(test []byte) (int, string) {
+	attemptLimit, err := jsonparser.GetInt(test, "attempts")
+	if err != nil || attemptLimit < 1 {
+		attemptLimit = 1
+	}
+
+	policy, _ := jsonparser.GetString(test, "scoringPolicy")
+	if policy == "" {
+		policy = scoringBest
+	}
+
+	return int(attemptLimit), policy
+}
+
+// getAttemptNumber returns the attempt number a Grade or AnswerSheet object was submitted as. Documents submitted
+// before tests allowed several attempts count as the first attempt.
+func getAttemptNumber(document []byte, keys ...string) int {
+	attempt, err := jsonparser.GetInt(document, append(keys, "attempt")...)
+	if err != nil || attempt < 1 {
+		return 1
+	}
+
+	return int(attempt)
+}
+
+// scoreAttempts returns the score that counts under a scoring policy, given the scores of the graded attempts in the
+// order they were taken.
+func scoreAttempts(policy string, scores []float64) float64 {
+	if len(scores) == 0 {
+		return 0
+	}
+
+	switch policy {
+	case scoringLast:
+		return scores[len(scores)-1]
+	case scoringAverage:
+		total := 0.0
+		for _, score := range scores {
+			total += score
+		}
+		return total / float64(len(scores))
+	default:
+		best := scores[0]
+		for _, score := range scores[1:] {
+			if score > best {
+				best = score
+			}
+		}
+		return best
+	}
+}
+
+// attemptsLeftMessage tells a student what is left for them to do on a test once an attempt has been submitted.
+func attemptsLeftMessage(attempt, attemptLimit int) string {
+	switch attemptsLeft := attemptLimit - attempt; {
+	case attemptsLeft <= 0:
+		return "You can no longer add anything to this test!"
+	case attemptsLeft == 1:
+		return "You have 1 attempt left on this test."
+	default:
+		return "You have " + strconv.Itoa(attemptsLeft) + " attempts left on this test."
+	}
+}
+
+// attemptLimitMessage tells a student they have already used up their attempts on a test.
+func attemptLimitMessage(attemptLimit int) string {
+	if attemptLimit == 1 {
+		return "Cannot submit an answer sheet after it has already been submitted!"
+	}
+
+	return "Cannot submit more than " + strconv.Itoa(attemptLimit) + " answer sheets on this test!"
+}
+
+// summarizeAttempts lists every attempt of a student on a test, graded or not, and computes the score and the mark that
+// count for the student under the scoring policy of the test. Averaged marks are rounded by the grade scale of the
+// test.
+func summarizeAttempts(testID, test, studentID, studentUser string) AttemptSummary {
+	attemptLimit, policy := getAttemptPolicy([]byte(test))
+	scale := getTestGradeScale(test)
+
+	summary := AttemptSummary{
+		TestID:        testID,
+		StudentID:     studentID,
+		AttemptLimit:  attemptLimit,
+		ScoringPolicy: policy,
+		Attempts:      []Attempt{},
+	}
+
+	if grades := ListStudentGradesForTest(testID, studentUser); grades != "notFound" {
+		jsonparser.ArrayEach([]byte(grades), func(grade []byte, dataType jsonparser.ValueType, offset int, err error) {
+			attempt := readAttempt(grade, "studentAnswerSheet")
+			attempt.Status = "graded"
+
+			score, _ := jsonparser.GetFloat(grade, "currentGrade")
+			maximumGrade, _ := jsonparser.GetFloat(grade, "MAXIMUM_GRADE")
+			mark := scale.gradeMark(grade)
+			attempt.Grade = &score
+			attempt.MaximumGrade = &maximumGrade
+			attempt.Mark = &mark
+
+			summary.Attempts = append(summary.Attempts, attempt)
+		})
+	}
+
+	if answerSheets := ListStudentAnswerSheetsForTest(testID, studentUser); answerSheets != "notFound" {
+		jsonparser.ArrayEach([]byte(answerSheets), func(answerSheet []byte, dataType jsonparser.ValueType, offset int, err error) {
+			attempt := readAttempt(answerSheet)
+			attempt.Status = "submitted"
+
+			summary.Attempts = append(summary.Attempts, attempt)
+		})
+	}
+
+	sort.SliceStable(summary.Attempts, func(i, j int) bool {
+		return summary.Attempts[i].Attempt < summary.Attempts[j].Attempt
+	})
+
+	var scores, marks []float64
+	for _, attempt := range summary.Attempts {
+		if attempt.Grade != nil {
+			scores = append(scores, *attempt.Grade)
+			marks = append(marks, *attempt.Mark)
+		}
+	}
+	if len(scores) > 0 {
+		score := scoreAttempts(policy, scores)
+		mark := scale.roundMark(scoreAttempts(policy, marks))
+		summary.Score = &score
+		summary.Mark = &mark
+	}
+
+	summary.AttemptsLeft = attemptLimit - len(summary.Attempts)
+	if summary.AttemptsLeft < 0 {
+		summary.AttemptsLeft = 0
+	}
+
+	return summary
+}
+
+// readAttempt reads the attempt number and submission details of an AnswerSheet object, found under the provided keys.
+// The submission time is written in the timezone of the school.
+func readAttempt(document []byte, keys ...string) Attempt {
+	attempt := Attempt{Attempt: getAttemptNumber(document, keys...)}
+
+	submittedAt, _ := jsonparser.GetString(document, append(keys, "submittedAt", "$date")...)
+	if parsedTime, err := time.Parse(time.RFC3339, submittedAt); err == nil {
+		attempt.SubmittedAt = formatTestTime(parsedTime)
+	}
+	attempt.Late, _ = jsonparser.GetBoolean(document, append(keys, "late")...)
+	attempt.AutoSubmitted, _ = jsonparser.GetBoolean(document, append(keys, "autoSubmitted")...)
+
+	return attempt
+}
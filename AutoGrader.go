@@ -0,0 +1,341 @@
+/*
+ * This file is part of VianuEdu.
+ *
+ *  VianuEdu is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ *  VianuEdu is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with VianuEdu.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * Developed by Matei Gardus <matei@gardus.eu>
+ */
+
+package vianueduserver
+
+import (
+	"github.com/buger/jsonparser"
+	"github.com/sirupsen/logrus"
+	"math"
+	"sort"
+	"strings"
+)
+
+// multipleAnswerPrefix marks the answers given to multiple-choice questions in AnswerSheet objects, i.e.
+// "[MULTIPLE_ANSWER] a".
+const multipleAnswerPrefix = "[MULTIPLE_ANSWER]"
+
+// The statuses of a regrade in the VianuEdu.RegradeLog collection (see ApplyRegrades).
+const (
+	regradePending = "pending"
+	regradeApplied = "applied"
+	regradePartial = "partial"
+)
+
+// A Regrade is the change a regrade brings to a single grade, along with the marks of the score before and after the
+// regrade. Questions lists the questions whose answer key changed.
+type Regrade struct {
+	GradeID    string            `json:"gradeID"`
+	StudentID  string            `json:"studentID"`
+	Before     float64           `json:"before"`
+	BeforeMark float64           `json:"beforeMark"`
+	After      float64           `json:"after"`
+	Mark       float64           `json:"mark"`
+	Questions  []string          `json:"questions"`
+	AnswerKey  map[string]string `json:"-"`
+}
+
+// A RegradeReport sums up a regrade of all the grades given on a test, with the change brought to every grade whose
+// answer key was out of date.
+type RegradeReport struct {
+	TestID    string    `json:"testID"`
+	DryRun    bool      `json:"dryRun"`
+	Unchanged int       `json:"unchanged"`
+	Changes   []Regrade `json:"changes"`
+}
+
+// An AnswerCheck is the answer sheet of a student checked against the answer key of the test, for the grading teacher
+// to start from. Score is what the student would get for their right answers and for the test cases their programs
+// passed, out of MaximumGrade, before any of the questions that need the teacher are scored. Mark is that score on the
+// national scale.
+type AnswerCheck struct {
+	TestID       string          `json:"testID"`
+	StudentID    string          `json:"studentID"`
+	Attempt      int             `json:"attempt"`
+	Score        float64         `json:"score"`
+	MaximumGrade float64         `json:"maximumGrade"`
+	Mark         float64         `json:"mark"`
+	Questions    []QuestionCheck `json:"questions"`
+}
+
+// A QuestionCheck is a single answer of an AnswerCheck, which is either "right", "wrong", "unanswered", or "teacher"
+// if the question can only be scored by a teacher. Right answers come with the rule they matched the answer key by
+// (see matchAnswer), so that the teacher can review the decision. Programs answering programming questions are
+// "partial" if they only passed some of the test cases, as found in Judge.
+type QuestionCheck struct {
+	Question     string       `json:"question"`
+	QuestionType string       `json:"questionType"`
+	Answer       string       `json:"answer"`
+	AnswerKey    string       `json:"answerKey"`
+	Status       string       `json:"status"`
+	MatchedBy    string       `json:"matchedBy,omitempty"`
+	Judge        *JudgeResult `json:"judge,omitempty"`
+}
+
+// choiceLetter extracts the letter of the choice from a multiple-choice answer, written either as in an AnswerSheet
+// object ("[MULTIPLE_ANSWER] a") or as in a Test object ("a) Pretty.").
+func choiceLetter(answer string) string {
+	answer = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(answer), multipleAnswerPrefix))
+
+	if index := strings.Index(answer, ")"); index >= 0 {
+		answer = answer[:index]
+	}
+
+	return strings.ToLower(strings.TrimSpace(answer))
+}
+
+// isObjectiveQuestion checks whether a question of a Test object can be scored without a teacher, which is the case
+// for multiple-choice questions, for expression questions and for free-text questions with matching rules.
+func isObjectiveQuestion(question []byte) bool {
+	questionType, _ := jsonparser.GetString(question, "questionType")
+
+	return questionType == "multiple-choice" || questionType == "expression" || isMatchedTextQuestion(question)
+}
+
+// isMultipleChoiceQuestion checks whether a question of a Test object is a multiple-choice question.
+func isMultipleChoiceQuestion(question []byte) bool {
+	questionType, _ := jsonparser.GetString(question, "questionType")
+
+	return questionType == "multiple-choice"
+}
+
+// answerKeyEntry writes the answer of an objective question of a Test object as it appears in the answer key of a
+// Grade object, i.e. "[MULTIPLE_ANSWER] a" for a multiple-choice question or "2x+2" for any other question.
+func answerKeyEntry(question []byte) string {
+	answer, _ := jsonparser.GetString(question, "answer")
+
+	if !isMultipleChoiceQuestion(question) {
+		return strings.TrimSpace(answer)
+	}
+
+	return multipleAnswerPrefix + " " + choiceLetter(answer)
+}
+
+// matchesAnswerKey checks whether an answer to an objective question of a Test object matches an entry of its answer
+// key (see matchAnswer).
+func matchesAnswerKey(question []byte, answer, key string) bool {
+	matches, _ := matchAnswer(question, answer, key)
+
+	return matches
+}
+
+// matchAnswer checks whether an answer to an objective question of a Test object matches an entry of its answer key
+// and returns the rule it matched by, if any. Multiple-choice answers match if they picked the same choice, expression
+// answers match if they are equivalent to the key (see expressionsEquivalent), within the "tolerance" of the question,
+// if any, and free-text answers match by the matching rules of the question (see matchTextAnswer). Empty answers and
+// answers that can't be parsed never match.
+func matchAnswer(question []byte, answer, key string) (bool, string) {
+	if strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(answer), multipleAnswerPrefix)) == "" {
+		return false, ""
+	}
+
+	if isMultipleChoiceQuestion(question) {
+		if choiceLetter(answer) != choiceLetter(key) {
+			return false, ""
+		}
+		return true, "choice"
+	}
+
+	if isMatchedTextQuestion(question) {
+		return matchTextAnswer(question, answer, key)
+	}
+
+	tolerance, _ := jsonparser.GetFloat(question, "tolerance")
+
+	if equivalent, err := expressionsEquivalent(answer, key, tolerance); err != nil || !equivalent {
+		return false, ""
+	}
+	return true, "equivalence"
+}
+
+// checkAnswers checks every answer of an AnswerSheet object against the answer key of the test it was submitted on,
+// which must be the test as the student took it (draw included). Every question is worth the same share of 100 points,
+// the same way grades are scored (gradeScoreDistribution). Programs are judged against the test cases of their
+// question (see judgeProgram) and get the share of the question matching the share of test cases they passed.
+func checkAnswers(answerSheet, test []byte) AnswerCheck {
+	check := AnswerCheck{
+		Attempt:      getAttemptNumber(answerSheet),
+		MaximumGrade: 100,
+		Questions:    []QuestionCheck{},
+	}
+
+	questionNumbers := listQuestionNumbers([]itemResponse{{test: test}})
+	if len(questionNumbers) == 0 {
+		return check
+	}
+	questionScore := check.MaximumGrade / float64(len(questionNumbers))
+
+	for _, questionNumber := range questionNumbers {
+		question, _, _, _ := jsonparser.Get(test, "contents", questionNumber)
+
+		questionCheck := QuestionCheck{Question: questionNumber}
+		questionCheck.QuestionType, _ = jsonparser.GetString(question, "questionType")
+		questionCheck.Answer, _ = jsonparser.GetString(answerSheet, "answers", questionNumber)
+
+		switch {
+		case isProgrammingQuestion(question):
+			if _, program := parseCodeAnswer(questionCheck.Answer); strings.TrimSpace(program) == "" {
+				questionCheck.Status = "unanswered"
+				break
+			}
+
+			result := judgeProgram(question, questionCheck.Answer)
+			questionCheck.Judge = &result
+
+			switch {
+			case result.Total > 0 && result.Passed == result.Total:
+				questionCheck.Status = "right"
+			case result.Passed > 0:
+				questionCheck.Status = "partial"
+			default:
+				questionCheck.Status = "wrong"
+			}
+			if result.Total > 0 {
+				check.Score += questionScore * float64(result.Passed) / float64(result.Total)
+			}
+		case strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(questionCheck.Answer), multipleAnswerPrefix)) == "":
+			questionCheck.Status = "unanswered"
+		case !isObjectiveQuestion(question):
+			questionCheck.Status = "teacher"
+		default:
+			var right bool
+			right, questionCheck.MatchedBy = matchAnswer(question, questionCheck.Answer, answerKeyEntry(question))
+
+			questionCheck.Status = "wrong"
+			if right {
+				questionCheck.Status = "right"
+				check.Score += questionScore
+			}
+		}
+
+		if isObjectiveQuestion(question) {
+			questionCheck.AnswerKey = answerKeyEntry(question)
+		}
+
+		check.Questions = append(check.Questions, questionCheck)
+	}
+
+	return check
+}
+
+// regradeGrade recomputes a grade against the answer key of the test it was given on, which must be the test as the
+// graded student took it (draw included).
+//
+// Only objective questions whose answer changed since the grade was given are recomputed. Each of them adds or takes
+// away the score of a single question (gradeScoreDistribution), depending on whether the student's answer was right
+// under the old answer key and under the new one. Questions graded by hand keep their score. The method returns false
+// if the answer key of the grade is still up to date.
+func regradeGrade(grade, test []byte) (Regrade, bool) {
+	regrade := Regrade{AnswerKey: map[string]string{}}
+
+	regrade.Before, _ = jsonparser.GetFloat(grade, "currentGrade")
+	maximumGrade, _ := jsonparser.GetFloat(grade, "MAXIMUM_GRADE")
+	questionScore, _ := jsonparser.GetFloat(grade, "gradeScoreDistribution")
+
+	delta := 0.0
+
+	jsonparser.ObjectEach(test, func(key []byte, question []byte, dataType jsonparser.ValueType, offset int) error {
+		questionNumber := string(key)
+		if !isObjectiveQuestion(question) {
+			return nil
+		}
+
+		oldKey, _ := jsonparser.GetString(grade, "answerKey", "answers", questionNumber)
+		newKey := answerKeyEntry(question)
+		if oldKey == newKey || matchesAnswerKey(question, oldKey, newKey) {
+			return nil
+		}
+
+		studentAnswer, _ := jsonparser.GetString(grade, "studentAnswerSheet", "answers", questionNumber)
+		wasRight := matchesAnswerKey(question, studentAnswer, oldKey)
+		isRight := matchesAnswerKey(question, studentAnswer, newKey)
+
+		if isRight && !wasRight {
+			delta += questionScore
+		} else if wasRight && !isRight {
+			delta -= questionScore
+		}
+
+		regrade.Questions = append(regrade.Questions, questionNumber)
+		regrade.AnswerKey[questionNumber] = newKey
+		return nil
+	}, "contents")
+
+	if len(regrade.Questions) == 0 {
+		return regrade, false
+	}
+
+	sort.Strings(regrade.Questions)
+	regrade.After = math.Max(0, regrade.Before+delta)
+	if maximumGrade > 0 {
+		regrade.After = math.Min(maximumGrade, regrade.After)
+	}
+
+	return regrade, true
+}
+
+// computeRegrades regrades every grade given on a test against its current answer key, without saving anything, and
+// returns the grades that changed along with how many grades didn't.
+//
+// Each grade is recomputed against the test as its student took it, questions drawn from the question bank included,
+// and the regraded score is converted to a mark with the grade scale of the test.
+func computeRegrades(testID, test string) ([]Regrade, int) {
+	regrades := []Regrade{}
+	unchanged := 0
+
+	scale := getTestGradeScale(test)
+
+	grades := ListGradesForTest(testID)
+	if grades == "notFound" {
+		return regrades, unchanged
+	}
+
+	_, err := jsonparser.ArrayEach([]byte(grades), func(grade []byte, dataType jsonparser.ValueType, offset int, err error) {
+		studentUser, _ := jsonparser.GetString(grade, "studentAnswerSheet", "student", "account", "userName")
+		studentPass, _ := jsonparser.GetString(grade, "studentAnswerSheet", "student", "account", "password")
+
+		studentID := FindStudentID(studentUser, studentPass)
+
+		studentTest := test
+		if draw := GetTestDraw(testID, studentID); draw != "notFound" {
+			studentTest = mergeTestDraw(test, draw)
+		}
+
+		regrade, changed := regradeGrade(grade, []byte(studentTest))
+		if !changed {
+			unchanged++
+			return
+		}
+
+		maximumGrade, _ := jsonparser.GetFloat(grade, "MAXIMUM_GRADE")
+		regrade.BeforeMark = scale.gradeMark(grade)
+		regrade.Mark = scale.convertToMark(regrade.After, maximumGrade)
+		regrade.GradeID, _ = jsonparser.GetString(grade, "_id", "$oid")
+		regrade.StudentID = studentID
+		regrades = append(regrades, regrade)
+	})
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error":  err,
+			"testID": testID,
+		}).Warn("Unable to iterate JSON array of grades to regrade!")
+	}
+
+	return regrades, unchanged
+}
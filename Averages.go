@@ -0,0 +1,221 @@
+/*
+ * This file is part of VianuEdu.
+ *
+ *  VianuEdu is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ *  VianuEdu is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with VianuEdu.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * Developed by Matei Gardus <matei@gardus.eu>
+ */
+
+package vianueduserver
+
+import (
+	"github.com/buger/jsonparser"
+	"math"
+)
+
+// passingAverage is the lowest average a student passes a subject with.
+const passingAverage = 5.0
+
+// thesisWeight is the weight the thesis mark of a semester has in the term average of a subject (see GetThesisWeight).
+// It is read from the configuration files when the server boots.
+var thesisWeight = 0.25
+
+// StudentAverages lists the term averages of a student in every subject, for one semester of an academic year or for
+// all of them, in which case the yearly averages are listed as well.
+type StudentAverages struct {
+	StudentID string          `json:"studentID"`
+	Semesters []TermAverages  `json:"semesters"`
+	Yearly    []YearlyAverage `json:"yearly,omitempty"`
+}
+
+// TermAverages lists the averages of a student in every subject over a semester.
+type TermAverages struct {
+	Term     Term             `json:"term"`
+	Subjects []SubjectAverage `json:"subjects"`
+}
+
+// A SubjectAverage is the average of a student in a subject over a semester, along with the marks it was computed
+// from. CurrentAverage is the average of the marks other than the thesis ("teză"), kept with two decimals and not
+// rounded, as the national rules ask. Average is left empty if the student has no marks other than the thesis.
+type SubjectAverage struct {
+	Course         string         `json:"course"`
+	Marks          []AveragedMark `json:"marks"`
+	Thesis         *AveragedMark  `json:"thesis,omitempty"`
+	CurrentAverage *float64       `json:"currentAverage"`
+	Average        *float64       `json:"average"`
+	Failing        bool           `json:"failing"`
+}
+
+// An AveragedMark is the mark a student got on a test, under the scoring policy of the test.
+type AveragedMark struct {
+	TestID   string  `json:"testID"`
+	TestName string  `json:"testName"`
+	Mark     float64 `json:"mark"`
+}
+
+// A YearlyAverage is the average of the term averages of a student in a subject, kept with two decimals and not
+// rounded. It is left empty until the student has an average in every semester.
+type YearlyAverage struct {
+	Course  string   `json:"course"`
+	Average *float64 `json:"average"`
+	Failing bool     `json:"failing"`
+}
+
+// isThesis checks whether a Test object is the thesis ("teză") of its semester ("thesis").
+func isThesis(test []byte) bool {
+	thesis, _ := jsonparser.GetBoolean(test, "thesis")
+
+	return thesis
+}
+
+// truncateAverage keeps the first two decimals of an average, dropping the rest without rounding.
+func truncateAverage(average float64) float64 {
+	// the tolerance keeps averages such as 8.3299999999 from losing a hundredth
+	return math.Floor(average*100+1e-9) / 100
+}
+
+// computeSubjectAverage computes the average of a student in a course over a semester.
+//
+// Every test the student was graded on in the semester (see ListStudentGradesForTerm) counts once, with the mark that
+// counts under its scoring policy, and the thesis of the semester, if any, is weighed in (see settle).
+func computeSubjectAverage(course, studentUser string, term Term, thesisWeight float64) SubjectAverage {
+	average := SubjectAverage{Course: course, Marks: []AveragedMark{}}
+
+	grades := ListStudentGradesForTerm(studentUser, course, term)
+	if grades == "notFound" {
+		return average
+	}
+
+	var testIDs []string
+	gradesByTest := map[string][][]byte{}
+
+	jsonparser.ArrayEach([]byte(grades), func(grade []byte, dataType jsonparser.ValueType, offset int, err error) {
+		testID, err := jsonparser.GetString(grade, "studentAnswerSheet", "testID")
+		if err != nil {
+			return
+		}
+
+		if _, seen := gradesByTest[testID]; !seen {
+			testIDs = append(testIDs, testID)
+		}
+		gradesByTest[testID] = append(gradesByTest[testID], grade)
+	})
+
+	for _, testID := range testIDs {
+		test := GetTest(testID)
+		if test == "notFound" {
+			test = `{"course": "` + course + `"}`
+		}
+
+		_, policy := getAttemptPolicy([]byte(test))
+		scale := getTestGradeScale(test)
+
+		var marks []float64
+		for _, grade := range gradesByTest[testID] {
+			marks = append(marks, scale.gradeMark(grade))
+		}
+
+		testName, _ := jsonparser.GetString([]byte(test), "testName")
+		average.addMark(AveragedMark{TestID: testID, TestName: testName,
+			Mark: scale.roundMark(scoreAttempts(policy, marks))}, isThesis([]byte(test)))
+	}
+
+	average.settle(thesisWeight)
+
+	return average
+}
+
+// addMark adds a mark to the marks an average is computed from. Should there be several theses, the latest one added
+// counts as the thesis and the others as ordinary marks.
+func (average *SubjectAverage) addMark(mark AveragedMark, thesis bool) {
+	if !thesis {
+		average.Marks = append(average.Marks, mark)
+		return
+	}
+
+	if average.Thesis != nil {
+		average.Marks = append(average.Marks, *average.Thesis)
+	}
+	average.Thesis = &mark
+}
+
+// settle computes an average from the marks added to it, weighing the thesis mark, if any, by the provided weight and
+// the average of the other marks by the rest, i.e. (3M + T) / 4 with the usual weight of 0.25. The average is then
+// rounded by the grade scale of the course. There is no average without marks other than the thesis.
+func (average *SubjectAverage) settle(thesisWeight float64) {
+	average.CurrentAverage, average.Average, average.Failing = nil, nil, false
+
+	if len(average.Marks) == 0 {
+		return
+	}
+
+	total := 0.0
+	for _, mark := range average.Marks {
+		total += mark.Mark
+	}
+
+	currentAverage := truncateAverage(total / float64(len(average.Marks)))
+	average.CurrentAverage = &currentAverage
+
+	termAverage := currentAverage
+	if average.Thesis != nil {
+		termAverage = (1-thesisWeight)*currentAverage + thesisWeight*average.Thesis.Mark
+	}
+	termAverage = getCourseGradeScale(average.Course).roundMark(termAverage)
+	average.Average = &termAverage
+	average.Failing = termAverage < passingAverage
+}
+
+// computeStudentAverages computes the averages of a student in every subject over the provided semesters of an
+// academic year, along with the yearly averages if every semester of the academic year is provided.
+func computeStudentAverages(studentID, studentUser string, year AcademicYear, terms []Term) StudentAverages {
+	averages := StudentAverages{StudentID: studentID, Semesters: []TermAverages{}}
+
+	for _, term := range terms {
+		termAverages := TermAverages{Term: term, Subjects: []SubjectAverage{}}
+		for _, course := range courses {
+			termAverages.Subjects = append(termAverages.Subjects, computeSubjectAverage(course, studentUser, term,
+				thesisWeight))
+		}
+		averages.Semesters = append(averages.Semesters, termAverages)
+	}
+
+	if len(terms) != len(year.Semesters) {
+		return averages
+	}
+
+	for index, course := range courses {
+		yearly := YearlyAverage{Course: course}
+
+		total := 0.0
+		complete := true
+		for _, termAverages := range averages.Semesters {
+			if termAverages.Subjects[index].Average == nil {
+				complete = false
+				break
+			}
+			total += *termAverages.Subjects[index].Average
+		}
+
+		if complete && len(averages.Semesters) > 0 {
+			yearlyAverage := truncateAverage(total / float64(len(averages.Semesters)))
+			yearly.Average = &yearlyAverage
+			yearly.Failing = yearlyAverage < passingAverage
+		}
+
+		averages.Yearly = append(averages.Yearly, yearly)
+	}
+
+	return averages
+}
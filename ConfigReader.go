@@ -24,6 +24,8 @@ import (
 	"github.com/sirupsen/logrus"
 	"io/ioutil"
 	"os"
+	"os/exec"
+	"time"
 )
 
 // GetListenPort reads the configuration file HTTPServer.json for the HTTP server listening port.
@@ -236,3 +238,295 @@ func ShouldIGoSecure() (bool, string, string) {
 	HTTPLogger.Warn("[BOOT][WARN] TLS disabled! Recheck configuration if this is non-intentional!")
 	return false, "", ""
 }
+
+// GetSubmissionGracePeriod reads the configuration file TestSettings.json for the grace period given to students after
+// their time for a test has run out, during which answer sheets are still accepted as submitted on time.
+//
+// The grace period is configured in seconds, in the "submissionGracePeriod" entry.
+// The configuration file must follow the template provided with the source code and release distribution,
+// otherwise the server exits immediately.
+func GetSubmissionGracePeriod() time.Duration {
+	configFile, err := os.Open("config/TestSettings.json")
+	if err != nil {
+		HTTPLogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Fatal("Error opening TestSettings configuration file!")
+	}
+	defer configFile.Close()
+
+	mainConfig, err := ioutil.ReadAll(configFile)
+	if err != nil {
+		HTTPLogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Fatal("Error reading TestSettings configuration variable!")
+	}
+	HTTPLogger.Println("[BOOT] Reading submission grace period...")
+	gracePeriod, err := jsonparser.GetInt(mainConfig, "submissionGracePeriod")
+	if err != nil {
+		HTTPLogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Fatal("Error parsing TestSettings configuration file! (can't parse submissionGracePeriod)")
+	}
+
+	return time.Duration(gracePeriod) * time.Second
+}
+
+// GetLateSubmissionPolicy reads the configuration file TestSettings.json for what the server should do with answer
+// sheets submitted after the grace period has run out.
+//
+// The "lateSubmissionPolicy" entry can either be "reject", in which case late answer sheets are refused, or "flag", in
+// which case they are accepted, but marked as late.
+// The configuration file must follow the template provided with the source code and release distribution,
+// otherwise the server exits immediately.
+func GetLateSubmissionPolicy() string {
+	configFile, err := os.Open("config/TestSettings.json")
+	if err != nil {
+		HTTPLogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Fatal("Error opening TestSettings configuration file!")
+	}
+	defer configFile.Close()
+
+	mainConfig, err := ioutil.ReadAll(configFile)
+	if err != nil {
+		HTTPLogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Fatal("Error reading TestSettings configuration variable!")
+	}
+	HTTPLogger.Println("[BOOT] Reading late submission policy...")
+	policy, err := jsonparser.GetString(mainConfig, "lateSubmissionPolicy")
+	if err != nil || (policy != "reject" && policy != "flag") {
+		HTTPLogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Fatal("Error parsing TestSettings configuration file! (lateSubmissionPolicy must be \"reject\" or \"flag\")")
+	}
+
+	return policy
+}
+
+// GetSchoolTimezone reads the configuration file TestSettings.json for the timezone of the school, i.e.
+// "Europe/Bucharest". All test times are presented in this timezone, and old tests are migrated from it.
+//
+// The configuration file must follow the template provided with the source code and release distribution,
+// otherwise the server exits immediately.
+func GetSchoolTimezone() *time.Location {
+	configFile, err := os.Open("config/TestSettings.json")
+	if err != nil {
+		HTTPLogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Fatal("Error opening TestSettings configuration file!")
+	}
+	defer configFile.Close()
+
+	mainConfig, err := ioutil.ReadAll(configFile)
+	if err != nil {
+		HTTPLogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Fatal("Error reading TestSettings configuration variable!")
+	}
+	HTTPLogger.Println("[BOOT] Reading school timezone...")
+	timezone, err := jsonparser.GetString(mainConfig, "schoolTimezone")
+	if err != nil {
+		HTTPLogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Fatal("Error parsing TestSettings configuration file! (can't parse schoolTimezone)")
+	}
+
+	zone, err := time.LoadLocation(timezone)
+	if err != nil {
+		HTTPLogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Fatal("Error parsing TestSettings configuration file! (schoolTimezone is not a valid timezone)")
+	}
+
+	return zone
+}
+
+// GetSimilarityThreshold reads the configuration file TestSettings.json for the similarity, between 0 and 1, from which
+// two free-text answers to the same question are flagged as suspiciously similar.
+//
+// The threshold is configured in the "similarityThreshold" entry.
+// The configuration file must follow the template provided with the source code and release distribution,
+// otherwise the server exits immediately.
+func GetSimilarityThreshold() float64 {
+	configFile, err := os.Open("config/TestSettings.json")
+	if err != nil {
+		HTTPLogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Fatal("Error opening TestSettings configuration file!")
+	}
+	defer configFile.Close()
+
+	mainConfig, err := ioutil.ReadAll(configFile)
+	if err != nil {
+		HTTPLogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Fatal("Error reading TestSettings configuration variable!")
+	}
+	HTTPLogger.Println("[BOOT] Reading similarity threshold...")
+	threshold, err := jsonparser.GetFloat(mainConfig, "similarityThreshold")
+	if err != nil || threshold < 0 || threshold > 1 {
+		HTTPLogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Fatal("Error parsing TestSettings configuration file! (similarityThreshold must be between 0 and 1)")
+	}
+
+	return threshold
+}
+
+// GetJudgeCommands reads the configuration file TestSettings.json for the commands the judge runs programs with, for
+// every programming language it supports, i.e. "g++" to compile C++ programs and "python3" to run Python programs.
+//
+// The commands are configured in the "judgeCommands" entry, keyed by language. Languages left out can't be used to
+// answer programming questions.
+// The configuration file must follow the template provided with the source code and release distribution,
+// otherwise the server exits immediately.
+func GetJudgeCommands() map[string]string {
+	configFile, err := os.Open("config/TestSettings.json")
+	if err != nil {
+		HTTPLogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Fatal("Error opening TestSettings configuration file!")
+	}
+	defer configFile.Close()
+
+	mainConfig, err := ioutil.ReadAll(configFile)
+	if err != nil {
+		HTTPLogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Fatal("Error reading TestSettings configuration variable!")
+	}
+
+	HTTPLogger.Println("[BOOT] Reading judge commands...")
+	commands := map[string]string{}
+	err = jsonparser.ObjectEach(mainConfig, func(key []byte, value []byte, dataType jsonparser.ValueType, offset int) error {
+		commands[string(key)] = string(value)
+		return nil
+	}, "judgeCommands")
+	if err != nil {
+		HTTPLogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Fatal("Error parsing TestSettings configuration file! (can't parse judgeCommands)")
+	}
+
+	return commands
+}
+
+// GetJudgeWorkers reads the configuration file TestSettings.json for how many programs the judge may run at the same
+// time, configured in the "judgeWorkers" entry.
+//
+// The configuration file must follow the template provided with the source code and release distribution,
+// otherwise the server exits immediately.
+func GetJudgeWorkers() int {
+	configFile, err := os.Open("config/TestSettings.json")
+	if err != nil {
+		HTTPLogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Fatal("Error opening TestSettings configuration file!")
+	}
+	defer configFile.Close()
+
+	mainConfig, err := ioutil.ReadAll(configFile)
+	if err != nil {
+		HTTPLogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Fatal("Error reading TestSettings configuration variable!")
+	}
+
+	HTTPLogger.Println("[BOOT] Reading judge workers...")
+	workers, err := jsonparser.GetInt(mainConfig, "judgeWorkers")
+	if err != nil || workers < 1 {
+		HTTPLogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Fatal("Error parsing TestSettings configuration file! (judgeWorkers must be a positive number)")
+	}
+
+	return int(workers)
+}
+
+// GetJudgeSandbox reads the configuration file TestSettings.json for the command the judge runs every program through,
+// so that programs run as an unprivileged user, without network access and without access to the files of the server,
+// i.e. bubblewrap ("bwrap"), nsjail or firejail. The "{directory}" argument is replaced by the directory the program
+// is judged in, and the program is appended to the command.
+//
+// The command is configured in the "judgeSandbox" entry, as a list of arguments. Should it be left out, or should its
+// program not be found, the judge is disabled and programming questions are left for the teacher to grade.
+// The configuration file must follow the template provided with the source code and release distribution,
+// otherwise the server exits immediately.
+func GetJudgeSandbox() []string {
+	configFile, err := os.Open("config/TestSettings.json")
+	if err != nil {
+		HTTPLogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Fatal("Error opening TestSettings configuration file!")
+	}
+	defer configFile.Close()
+
+	mainConfig, err := ioutil.ReadAll(configFile)
+	if err != nil {
+		HTTPLogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Fatal("Error reading TestSettings configuration variable!")
+	}
+
+	HTTPLogger.Println("[BOOT] Reading judge sandbox...")
+	var sandbox []string
+	_, err = jsonparser.ArrayEach(mainConfig, func(value []byte, dataType jsonparser.ValueType, offset int, err1 error) {
+		if dataType != jsonparser.String {
+			HTTPLogger.Fatal("Error parsing TestSettings configuration file! (judgeSandbox must be a list of strings)")
+		}
+		sandbox = append(sandbox, string(value))
+	}, "judgeSandbox")
+	if err != nil && err != jsonparser.KeyPathNotFoundError {
+		HTTPLogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Fatal("Error parsing TestSettings configuration file! (can't parse judgeSandbox)")
+	}
+
+	if len(sandbox) == 0 {
+		HTTPLogger.Warn("No judge sandbox is configured! Programs will not be judged.")
+		return nil
+	}
+
+	if _, err := exec.LookPath(sandbox[0]); err != nil {
+		HTTPLogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Warn("Cannot find the judge sandbox! Programs will not be judged.")
+		return nil
+	}
+
+	return sandbox
+}
+
+// GetThesisWeight reads the configuration file TestSettings.json for the weight, between 0 and 1, the thesis ("teză")
+// mark of a semester has in the term average of a subject, configured in the "thesisWeight" entry. The national rule
+// is 0.25, i.e. the thesis counts as much as a third of the average of the other marks.
+//
+// The configuration file must follow the template provided with the source code and release distribution,
+// otherwise the server exits immediately.
+func GetThesisWeight() float64 {
+	configFile, err := os.Open("config/TestSettings.json")
+	if err != nil {
+		HTTPLogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Fatal("Error opening TestSettings configuration file!")
+	}
+	defer configFile.Close()
+
+	mainConfig, err := ioutil.ReadAll(configFile)
+	if err != nil {
+		HTTPLogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Fatal("Error reading TestSettings configuration variable!")
+	}
+
+	HTTPLogger.Println("[BOOT] Reading thesis weight...")
+	weight, err := jsonparser.GetFloat(mainConfig, "thesisWeight")
+	if err != nil || weight < 0 || weight >= 1 {
+		HTTPLogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Fatal("Error parsing TestSettings configuration file! (thesisWeight must be at least 0 and less than 1)")
+	}
+
+	return weight
+}
@@ -0,0 +1,406 @@
+/*
+ * This file is part of VianuEdu.
+ *
+ *  VianuEdu is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ *  VianuEdu is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with VianuEdu.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * Developed by Matei Gardus <matei@gardus.eu>
+ */
+
+package vianueduserver
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"github.com/buger/jsonparser"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// giftSpecialCharacters escapes the characters GIFT gives a meaning to with a backslash.
+var giftSpecialCharacters = strings.NewReplacer(`\`, `\\`, ":", `\:`, "~", `\~`, "=", `\=`, "#", `\#`, "{", `\{`,
+	"}", `\}`)
+
+// An exportedQuestion is a question of a Test object, ready to be written in another format.
+type exportedQuestion struct {
+	Number   string
+	Question string
+	Answer   string
+	Choices  []string
+	Type     string
+}
+
+// listTestQuestions returns the fixed contents of a Test object, in numerical order. Questions drawn from the question
+// bank aren't part of them, since every student gets different ones.
+func listTestQuestions(test []byte) []exportedQuestion {
+	var questions []exportedQuestion
+
+	questionNumbers := listQuestionNumbers([]itemResponse{{test: test}})
+
+	for _, questionNumber := range questionNumbers {
+		question, _, _, _ := jsonparser.Get(test, "contents", questionNumber)
+
+		exported := exportedQuestion{Number: questionNumber}
+		exported.Question, _ = jsonparser.GetString(question, "question")
+		exported.Answer, _ = jsonparser.GetString(question, "answer")
+		exported.Type, _ = jsonparser.GetString(question, "questionType")
+
+		jsonparser.ArrayEach(question, func(choice []byte, dataType jsonparser.ValueType, offset int, err error) {
+			exported.Choices = append(exported.Choices, string(choice))
+		}, "questionChoices")
+
+		questions = append(questions, exported)
+	}
+
+	return questions
+}
+
+// choiceText strips the label off a choice written the way choices are written in a Test object, i.e. "b) Moldoveanu."
+// becomes "Moldoveanu.".
+func choiceText(choice string) string {
+	if index := strings.Index(choice, ")"); index >= 0 && index <= 3 {
+		return strings.TrimSpace(choice[index+1:])
+	}
+
+	return strings.TrimSpace(choice)
+}
+
+// exportTestGIFT writes the fixed contents of a Test object as a GIFT file, within a category named after the test.
+// Multiple-choice questions keep their choices, normal questions with an answer become short-answer questions and
+// normal questions without one become essay questions.
+func exportTestGIFT(test []byte) string {
+	var gift strings.Builder
+
+	testName, _ := jsonparser.GetString(test, "testName")
+	if testName != "" {
+		gift.WriteString("$CATEGORY: " + strings.Replace(testName, "/", "-", -1) + "\n\n")
+	}
+
+	for _, question := range listTestQuestions(test) {
+		gift.WriteString("::" + giftSpecialCharacters.Replace("Q"+question.Number) + ":: ")
+		gift.WriteString(giftSpecialCharacters.Replace(question.Question) + " {")
+
+		switch {
+		case question.Type == "multiple-choice":
+			gift.WriteString("\n")
+			for _, choice := range question.Choices {
+				mark := "~"
+				if choiceLetter(choice) == choiceLetter(question.Answer) {
+					mark = "="
+				}
+				gift.WriteString("\t" + mark + giftSpecialCharacters.Replace(choiceText(choice)) + "\n")
+			}
+		case strings.TrimSpace(question.Answer) != "":
+			gift.WriteString("=" + giftSpecialCharacters.Replace(strings.TrimSpace(question.Answer)))
+		}
+
+		gift.WriteString("}\n\n")
+	}
+
+	return gift.String()
+}
+
+// escapeXML escapes text so that it can be written as XML character data or as the value of an attribute.
+func escapeXML(text string) string {
+	var escaped bytes.Buffer
+	xml.EscapeText(&escaped, []byte(text))
+
+	return escaped.String()
+}
+
+// exportTestQTI writes the fixed contents of a Test object as an IMS QTI 2.1 package, a zip archive holding a manifest
+// and one item per question. Multiple-choice questions become choice interactions, normal questions with an answer
+// become text entry interactions and normal questions without one become extended text interactions.
+func exportTestQTI(test []byte) ([]byte, error) {
+	var archive bytes.Buffer
+
+	writer := zip.NewWriter(&archive)
+
+	testID, _ := jsonparser.GetString(test, "testID")
+
+	var resources strings.Builder
+
+	for _, question := range listTestQuestions(test) {
+		identifier := "Q" + question.Number
+		fileName := "items/" + identifier + ".xml"
+
+		file, err := writer.Create(fileName)
+		if err != nil {
+			return nil, err
+		}
+		if _, err = io.WriteString(file, qtiItem(identifier, question)); err != nil {
+			return nil, err
+		}
+
+		resources.WriteString(`    <resource identifier="` + identifier + `" type="imsqti_item_xmlv2p1" href="` + fileName + `">
+      <file href="` + fileName + `"/>
+    </resource>
+`)
+	}
+
+	manifest, err := writer.Create("imsmanifest.xml")
+	if err != nil {
+		return nil, err
+	}
+	_, err = io.WriteString(manifest, `<?xml version="1.0" encoding="UTF-8"?>
+<manifest xmlns="http://www.imsglobal.org/xsd/imscp_v1p1" identifier="`+escapeXML(testID)+`">
+  <metadata>
+    <schema>IMS Content</schema>
+    <schemaversion>1.1</schemaversion>
+  </metadata>
+  <organizations/>
+  <resources>
+`+resources.String()+`  </resources>
+</manifest>
+`)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = writer.Close(); err != nil {
+		return nil, err
+	}
+
+	return archive.Bytes(), nil
+}
+
+// qtiItem writes a single question as a QTI 2.1 assessment item with the provided identifier.
+func qtiItem(identifier string, question exportedQuestion) string {
+	var declaration, interaction string
+
+	switch {
+	case question.Type == "multiple-choice":
+		var choices strings.Builder
+		for _, choice := range question.Choices {
+			choices.WriteString(`      <simpleChoice identifier="` + escapeXML(strings.ToUpper(choiceLetter(choice))) + `">` +
+				escapeXML(choiceText(choice)) + "</simpleChoice>\n")
+		}
+
+		declaration = `  <responseDeclaration identifier="RESPONSE" cardinality="single" baseType="identifier">
+    <correctResponse>
+      <value>` + escapeXML(strings.ToUpper(choiceLetter(question.Answer))) + `</value>
+    </correctResponse>
+  </responseDeclaration>
+`
+		interaction = `    <choiceInteraction responseIdentifier="RESPONSE" shuffle="false" maxChoices="1">
+` + choices.String() + `    </choiceInteraction>
+`
+	case strings.TrimSpace(question.Answer) != "":
+		declaration = `  <responseDeclaration identifier="RESPONSE" cardinality="single" baseType="string">
+    <correctResponse>
+      <value>` + escapeXML(strings.TrimSpace(question.Answer)) + `</value>
+    </correctResponse>
+  </responseDeclaration>
+`
+		interaction = `    <p><textEntryInteraction responseIdentifier="RESPONSE"/></p>
+`
+	default:
+		declaration = `  <responseDeclaration identifier="RESPONSE" cardinality="single" baseType="string"/>
+`
+		interaction = `    <extendedTextInteraction responseIdentifier="RESPONSE"/>
+`
+	}
+
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<assessmentItem xmlns="http://www.imsglobal.org/xsd/imsqti_v2p1" identifier="` + identifier + `" title="` +
+		identifier + `" adaptive="false" timeDependent="false">
+` + declaration + `  <outcomeDeclaration identifier="SCORE" cardinality="single" baseType="float"/>
+  <itemBody>
+    <p>` + escapeXML(question.Question) + `</p>
+` + interaction + `  </itemBody>
+  <responseProcessing template="http://www.imsglobal.org/question/qti_v2p1/rptemplates/match_correct"/>
+</assessmentItem>
+`
+}
+
+// csvText writes text written by a student or a teacher as a CSV cell, prefixed with "'" if it starts like a formula,
+// so that spreadsheets opening the file show it as text instead of running it, i.e. "=HYPERLINK(...)".
+func csvText(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+
+	return value
+}
+
+// A resultRow is the line of a single student in the results of a test.
+type resultRow struct {
+	lastName       string
+	firstName      string
+	fathersInitial string
+	grade          string
+	gradeLetter    string
+	status         string
+	attempt        int
+	score          string
+	maximumGrade   string
+	mark           string
+	answers        []byte
+}
+
+// writeTestResultsCSV writes the results of a test as CSV, one student per line and one column per question, sorted
+// by the students' names. Every answer sheet of the test shows up, either "graded", along with its score and its mark,
+// or "submitted" if it is still waiting to be graded. Students who took the test several times get one line per
+// attempt. Answers to multiple-choice questions are written as the letter of the picked choice, and text that looks
+// like a formula is kept from running (see csvText).
+func writeTestResultsCSV(w io.Writer, testID, test string) error {
+	var rows []resultRow
+	var responses []itemResponse
+
+	studentTest := func(studentSheet []byte) []byte {
+		studentUser, _ := jsonparser.GetString(studentSheet, "student", "account", "userName")
+		studentPass, _ := jsonparser.GetString(studentSheet, "student", "account", "password")
+
+		if draw := GetTestDraw(testID, FindStudentID(studentUser, studentPass)); draw != "notFound" {
+			return []byte(mergeTestDraw(test, draw))
+		}
+		return []byte(test)
+	}
+
+	addRow := func(answerSheet []byte, status, score, maximumGrade, mark string) {
+		row := resultRow{status: status, attempt: getAttemptNumber(answerSheet), score: score, maximumGrade: maximumGrade,
+			mark: mark}
+		row.lastName, _ = jsonparser.GetString(answerSheet, "student", "lastName")
+		row.firstName, _ = jsonparser.GetString(answerSheet, "student", "firstName")
+		row.fathersInitial, _ = jsonparser.GetString(answerSheet, "student", "fathersInitial")
+		row.gradeLetter, _ = jsonparser.GetString(answerSheet, "student", "gradeLetter")
+		row.answers, _, _, _ = jsonparser.Get(answerSheet, "answers")
+		if grade, err := jsonparser.GetInt(answerSheet, "student", "grade"); err == nil {
+			row.grade = strconv.FormatInt(grade, 10)
+		}
+
+		rows = append(rows, row)
+		responses = append(responses, itemResponse{test: studentTest(answerSheet)})
+	}
+
+	scale := getTestGradeScale(test)
+
+	if grades := ListGradesForTest(testID); grades != "notFound" {
+		jsonparser.ArrayEach([]byte(grades), func(grade []byte, dataType jsonparser.ValueType, offset int, err error) {
+			answerSheet, _, _, _ := jsonparser.Get(grade, "studentAnswerSheet")
+			score, _ := jsonparser.GetFloat(grade, "currentGrade")
+			maximumGrade, _ := jsonparser.GetFloat(grade, "MAXIMUM_GRADE")
+			mark := scale.gradeMark(grade)
+
+			addRow(answerSheet, "graded", formatStatistic(&score), formatStatistic(&maximumGrade), formatStatistic(&mark))
+		})
+	}
+
+	if answerSheets := ListAnswerSheetsForTest(testID); answerSheets != "notFound" {
+		jsonparser.ArrayEach([]byte(answerSheets), func(value []byte, dataType jsonparser.ValueType, offset int, err error) {
+			addRow(value, "submitted", "", "", "")
+		})
+	}
+
+	if len(responses) == 0 {
+		responses = append(responses, itemResponse{test: []byte(test)})
+	}
+	questionNumbers := listQuestionNumbers(responses)
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		if rows[i].lastName != rows[j].lastName {
+			return rows[i].lastName < rows[j].lastName
+		}
+		if rows[i].firstName != rows[j].firstName {
+			return rows[i].firstName < rows[j].firstName
+		}
+		return rows[i].attempt < rows[j].attempt
+	})
+
+	writer := csv.NewWriter(w)
+
+	header := []string{"lastName", "firstName", "fathersInitial", "grade", "gradeLetter", "status", "attempt", "score",
+		"maximumGrade", "mark"}
+	for _, questionNumber := range questionNumbers {
+		header = append(header, "Q"+questionNumber)
+	}
+	writer.Write(header)
+
+	for _, row := range rows {
+		line := []string{csvText(row.lastName), csvText(row.firstName), csvText(row.fathersInitial), row.grade,
+			csvText(row.gradeLetter), row.status, strconv.Itoa(row.attempt), row.score, row.maximumGrade, row.mark}
+
+		for _, questionNumber := range questionNumbers {
+			answer, _ := jsonparser.GetString(row.answers, questionNumber)
+			if strings.HasPrefix(strings.TrimSpace(answer), multipleAnswerPrefix) {
+				answer = choiceLetter(answer)
+			}
+			line = append(line, csvText(strings.TrimSpace(answer)))
+		}
+
+		writer.Write(line)
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// writeGradebookCSV writes a gradebook as CSV, one student per line and one column per test, headed by the test ID and
+// name of the test. Marks are followed by "(late)" if any attempt was submitted late, while students without a mark get
+// their status instead ("submitted", "missing" or "pending"), or "-" if the test isn't meant for them. The last line
+// holds the average mark of the class on every test. Names that look like formulas are kept from running (see csvText).
+func writeGradebookCSV(w io.Writer, gradebook Gradebook) error {
+	writer := csv.NewWriter(w)
+
+	header := []string{"lastName", "firstName"}
+	for _, test := range gradebook.Tests {
+		column := test.TestID + " " + test.TestName
+		if test.Thesis {
+			column += " (thesis)"
+		}
+		header = append(header, column)
+	}
+	header = append(header, "currentAverage", "average", "failing")
+	writer.Write(header)
+
+	formatMark := func(mark *float64) string {
+		if mark == nil {
+			return ""
+		}
+		return strconv.FormatFloat(*mark, 'f', -1, 64)
+	}
+
+	for _, row := range gradebook.Students {
+		line := []string{csvText(row.LastName), csvText(row.FirstName)}
+
+		for _, cell := range row.Cells {
+			value := cell.Status
+			switch {
+			case cell.Mark != nil:
+				value = formatMark(cell.Mark)
+			case cell.Status == gradebookNotAssigned:
+				value = "-"
+			}
+			if cell.Late {
+				value += " (late)"
+			}
+			line = append(line, value)
+		}
+
+		line = append(line, formatMark(row.CurrentAverage), formatMark(row.Average), strconv.FormatBool(row.Failing))
+		writer.Write(line)
+	}
+
+	footer := []string{"class average", ""}
+	for _, test := range gradebook.Tests {
+		footer = append(footer, formatMark(test.Average))
+	}
+	writer.Write(footer)
+
+	writer.Flush()
+	return writer.Error()
+}
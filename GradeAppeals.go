@@ -0,0 +1,92 @@
+/*
+ * This file is part of VianuEdu.
+ *
+ *  VianuEdu is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ *  VianuEdu is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with VianuEdu.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * Developed by Matei Gardus <matei@gardus.eu>
+ */
+
+package vianueduserver
+
+import (
+	"github.com/buger/jsonparser"
+	"time"
+)
+
+// The statuses of a grade appeal. Appeals stay "open" until the teacher who gave the grade resolves them, either by
+// keeping the score ("kept") or by amending it ("amended"). While its resolution is being applied, an appeal is
+// "resolving", so that it can't be resolved twice at the same time.
+const (
+	appealOpen      = "open"
+	appealResolving = "resolving"
+	appealKept      = "kept"
+	appealAmended   = "amended"
+)
+
+// maxAppealMessage is the longest message, in characters, a student or a teacher can write on a grade appeal.
+const maxAppealMessage = 2000
+
+// maxResolveAttempts is how many times resolveGradeAppeal tries to record the resolution of an appeal whose grade has
+// already been amended, since the appeal can't be opened again once it has.
+const maxResolveAttempts = 3
+
+// A GradeAppeal is a student contesting the score they got on a question of a graded attempt, with a message for the
+// teacher who gave the grade. Once resolved, the appeal records when and how it was resolved, along with the response
+// of the teacher and, if the grade was amended, its new score. Pending marks the appeals still open or being resolved,
+// of which a question can only have one (see AddGradeAppeal).
+type GradeAppeal struct {
+	ID           string     `json:"appealID" bson:"appealID"`
+	GradeID      string     `json:"gradeID" bson:"gradeID"`
+	TestID       string     `json:"testID" bson:"testID"`
+	Course       string     `json:"course" bson:"course"`
+	StudentID    string     `json:"studentID" bson:"studentID"`
+	Attempt      int        `json:"attempt" bson:"attempt"`
+	Question     string     `json:"question" bson:"question"`
+	Message      string     `json:"message" bson:"message"`
+	Teacher      string     `json:"teacher" bson:"teacher"`
+	Status       string     `json:"status" bson:"status"`
+	OpenedAt     time.Time  `json:"openedAt" bson:"openedAt"`
+	ResolvedAt   *time.Time `json:"resolvedAt,omitempty" bson:"resolvedAt,omitempty"`
+	Response     string     `json:"response,omitempty" bson:"response,omitempty"`
+	CurrentGrade *float64   `json:"currentGrade,omitempty" bson:"currentGrade,omitempty"`
+	Pending      bool       `json:"-" bson:"pending,omitempty"`
+}
+
+// gradeHasQuestion checks whether a question number is one of the questions of a Grade object, as found in its answer
+// key or in the answer sheet it graded.
+func gradeHasQuestion(grade []byte, question string) bool {
+	if _, _, _, err := jsonparser.Get(grade, "answerKey", "answers", question); err == nil {
+		return true
+	}
+
+	_, _, _, err := jsonparser.Get(grade, "studentAnswerSheet", "answers", question)
+
+	return err == nil
+}
+
+// inSchoolTimezone returns grade appeals with the moments they were opened and resolved in the timezone of the school.
+func inSchoolTimezone(appeals []GradeAppeal) []GradeAppeal {
+	result := []GradeAppeal{}
+
+	for _, appeal := range appeals {
+		appeal.OpenedAt = appeal.OpenedAt.In(schoolTimezone)
+		if appeal.ResolvedAt != nil {
+			resolvedAt := appeal.ResolvedAt.In(schoolTimezone)
+			appeal.ResolvedAt = &resolvedAt
+		}
+		result = append(result, appeal)
+	}
+
+	return result
+}
@@ -0,0 +1,113 @@
+/*
+ * This file is part of VianuEdu.
+ *
+ *  VianuEdu is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ *  VianuEdu is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with VianuEdu.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * Developed by Matei Gardus <matei@gardus.eu>
+ */
+
+package vianueduserver
+
+import (
+	"github.com/buger/jsonparser"
+	"time"
+)
+
+// The ways a grade can be changed once it has been given: "amended" by the teacher who gave it or by an admin, or
+// "regraded" along with every other grade of its test after its answer key was corrected.
+const (
+	gradeAmended  = "amended"
+	gradeRegraded = "regraded"
+)
+
+// The possible outcomes of replacing a grade (see replaceGrade): the grade was replaced, it was changed by someone
+// else in the meantime, or it couldn't be replaced at all.
+const (
+	gradeReplaced = iota
+	gradeConflict
+	gradeNotReplaced
+)
+
+// adminAuthor stands for the admin as the author of a change, in place of a teacher ID.
+const adminAuthor = "admin"
+
+// A GradeVersion is a previous version of a grade: its score and mark until it was replaced, along with when, how and
+// by whom (a teacher ID, or "admin") it was replaced, and why.
+type GradeVersion struct {
+	GradeID      string    `json:"gradeID" bson:"gradeID"`
+	TestID       string    `json:"testID" bson:"testID"`
+	StudentID    string    `json:"studentID" bson:"studentID"`
+	Version      int       `json:"version" bson:"version"`
+	Kind         string    `json:"kind" bson:"kind"`
+	CurrentGrade float64   `json:"currentGrade" bson:"currentGrade"`
+	Mark         float64   `json:"mark" bson:"mark"`
+	ReplacedAt   time.Time `json:"replacedAt" bson:"replacedAt"`
+	ReplacedBy   string    `json:"replacedBy" bson:"replacedBy"`
+	Reason       string    `json:"reason" bson:"reason"`
+}
+
+// A GradeHistory lists every version of a grade, the previous ones oldest first, along with the current one.
+type GradeHistory struct {
+	TestID       string         `json:"testID"`
+	StudentID    string         `json:"studentID"`
+	Attempt      int            `json:"attempt"`
+	CurrentGrade float64        `json:"currentGrade"`
+	MaximumGrade float64        `json:"maximumGrade"`
+	Mark         float64        `json:"mark"`
+	Versions     []GradeVersion `json:"versions"`
+}
+
+// amendGradeScore gives a Grade object of a test a new score, converted to a mark with the grade scale of the test,
+// keeping the version it replaces in its history along with its author (a teacher ID, or "admin") and the reason for
+// the change. The method returns whether the grade was amended, as one of the outcomes of replaceGrade.
+func amendGradeScore(test, testID, studentID string, grade []byte, currentGrade float64, author, reason string) int {
+	scale := getTestGradeScale(test)
+
+	maximumGrade, _ := jsonparser.GetFloat(grade, "MAXIMUM_GRADE")
+	previousGrade, _ := jsonparser.GetFloat(grade, "currentGrade")
+	gradeID, _ := jsonparser.GetString(grade, "_id", "$oid")
+
+	previous := GradeVersion{
+		GradeID:      gradeID,
+		TestID:       testID,
+		StudentID:    studentID,
+		Kind:         gradeAmended,
+		CurrentGrade: previousGrade,
+		Mark:         scale.gradeMark(grade),
+		ReplacedAt:   time.Now(),
+		ReplacedBy:   author,
+		Reason:       reason,
+	}
+
+	return AmendGrade(testID, previous, currentGrade, scale.convertToMark(currentGrade, maximumGrade))
+}
+
+// buildGradeHistory lists every version of a Grade object, converting its current score to a mark with the provided
+// grade scale if it has none stored.
+func buildGradeHistory(testID, studentID string, grade []byte, scale GradeScale) GradeHistory {
+	history := GradeHistory{TestID: testID, StudentID: studentID, Versions: []GradeVersion{}}
+
+	history.Attempt = getAttemptNumber(grade, "studentAnswerSheet")
+	history.CurrentGrade, _ = jsonparser.GetFloat(grade, "currentGrade")
+	history.MaximumGrade, _ = jsonparser.GetFloat(grade, "MAXIMUM_GRADE")
+	history.Mark = scale.gradeMark(grade)
+
+	gradeID, _ := jsonparser.GetString(grade, "_id", "$oid")
+	for _, version := range ListGradeVersions(gradeID) {
+		version.ReplacedAt = version.ReplacedAt.In(schoolTimezone)
+		history.Versions = append(history.Versions, version)
+	}
+
+	return history
+}
@@ -0,0 +1,222 @@
+/*
+ * This file is part of VianuEdu.
+ *
+ *  VianuEdu is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ *  VianuEdu is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with VianuEdu.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * Developed by Matei Gardus <matei@gardus.eu>
+ */
+
+package vianueduserver
+
+import (
+	"encoding/json"
+	"github.com/buger/jsonparser"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// Marks are given on the national scale, from 1 to 10.
+const (
+	minimumMark = 1.0
+	maximumMark = 10.0
+)
+
+// The rounding rules of a grade scale. Marks are rounded to the "nearest" whole mark, halves going up (9.50 becomes
+// 10), rounded "up" or "down" to a whole mark, or kept with two decimals if there is no rounding ("none").
+const (
+	roundingNearest = "nearest"
+	roundingUp      = "up"
+	roundingDown    = "down"
+	roundingNone    = "none"
+)
+
+// A GradeScale converts the scores of a test, out of its MAXIMUM_GRADE, to marks on the national scale, i.e.
+//
+//	{"exOfficio": 1, "rounding": "nearest"}
+//	{"rounding": "none", "thresholds": [{"from": 90, "mark": 10}, {"from": 80, "mark": 9}, {"from": 0, "mark": 4}]}
+//
+// Without thresholds, the conversion is linear: the ex officio point(s) are given to everybody and the rest of the
+// scale is split according to the score, so that with the usual ex officio point a score of 50% gets a 5.50. With
+// thresholds, a score gets the mark of the highest threshold (a percentage) it reached, or 1 if it reached none.
+type GradeScale struct {
+	ExOfficio  float64          `json:"exOfficio"`
+	Rounding   string           `json:"rounding"`
+	Thresholds []GradeThreshold `json:"thresholds,omitempty"`
+}
+
+// A GradeThreshold gives a mark to the scores of at least a percentage of the maximum grade.
+type GradeThreshold struct {
+	From float64 `json:"from"`
+	Mark float64 `json:"mark"`
+}
+
+// defaultGradeScale is the grade scale of courses and tests that don't have one of their own: the linear conversion
+// with one ex officio point, rounded to the nearest whole mark.
+var defaultGradeScale = GradeScale{ExOfficio: 1, Rounding: roundingNearest}
+
+// readGradeScale reads a GradeScale found under the provided keys of a JSON document. Settings left out of it are
+// taken from the default grade scale. The method returns false if there is no grade scale to be found.
+func readGradeScale(document []byte, keys ...string) (GradeScale, bool) {
+	value, dataType, _, err := jsonparser.Get(document, keys...)
+	if err != nil || dataType != jsonparser.Object {
+		return defaultGradeScale, false
+	}
+
+	scale := defaultGradeScale
+	if err := json.Unmarshal(value, &scale); err != nil {
+		return defaultGradeScale, false
+	}
+
+	sort.SliceStable(scale.Thresholds, func(i, j int) bool {
+		return scale.Thresholds[i].From > scale.Thresholds[j].From
+	})
+
+	return scale, true
+}
+
+// getTestGradeScale returns the grade scale the scores of a test are converted with, which is the grade scale of the
+// test itself ("gradeScale"), if any, or else the grade scale of its course (see getCourseGradeScale).
+func getTestGradeScale(test string) GradeScale {
+	if scale, ok := readGradeScale([]byte(test), "gradeScale"); ok {
+		return scale
+	}
+
+	course, _ := jsonparser.GetString([]byte(test), "course")
+
+	return getCourseGradeScale(course)
+}
+
+// getCourseGradeScale returns the grade scale of a course, if it has one, or else the default grade scale.
+func getCourseGradeScale(course string) GradeScale {
+	if courseScale := GetGradeScale(course); courseScale != "notFound" {
+		if scale, ok := readGradeScale([]byte(courseScale)); ok {
+			return scale
+		}
+	}
+
+	return defaultGradeScale
+}
+
+// convertToMark converts a score, out of the maximum grade, to a mark on the national scale.
+func (scale GradeScale) convertToMark(score, maximumGrade float64) float64 {
+	percentage := 0.0
+	if maximumGrade > 0 {
+		percentage = math.Max(0, math.Min(100, score/maximumGrade*100))
+	}
+
+	var mark float64
+	if len(scale.Thresholds) > 0 {
+		mark = minimumMark
+		for _, threshold := range scale.Thresholds {
+			if percentage >= threshold.From {
+				mark = threshold.Mark
+				break
+			}
+		}
+	} else {
+		mark = scale.ExOfficio + percentage/100*(maximumMark-scale.ExOfficio)
+	}
+
+	return scale.roundMark(mark)
+}
+
+// roundMark rounds a mark by the rounding rule of the grade scale, keeping it on the national scale.
+func (scale GradeScale) roundMark(mark float64) float64 {
+	// the tolerance keeps marks such as 9.4999999999 from being rounded the wrong way
+	const tolerance = 1e-9
+
+	switch scale.Rounding {
+	case roundingUp:
+		mark = math.Ceil(mark - tolerance)
+	case roundingDown:
+		mark = math.Floor(mark + tolerance)
+	case roundingNone:
+		mark = math.Floor(mark*100+0.5+tolerance) / 100
+	default:
+		mark = math.Floor(mark + 0.5 + tolerance)
+	}
+
+	return math.Max(minimumMark, math.Min(maximumMark, mark))
+}
+
+// gradeMark returns the mark of a Grade object, which is the one stored along with it ("mark"), or else its score
+// converted with the provided grade scale, for grades given before marks were stored.
+func (scale GradeScale) gradeMark(grade []byte) float64 {
+	if mark, err := jsonparser.GetFloat(grade, "mark"); err == nil {
+		return mark
+	}
+
+	score, _ := jsonparser.GetFloat(grade, "currentGrade")
+	maximumGrade, _ := jsonparser.GetFloat(grade, "MAXIMUM_GRADE")
+
+	return scale.convertToMark(score, maximumGrade)
+}
+
+// withMark returns a Grade object with its mark ("mark") set to the provided one.
+func withMark(grade []byte, mark float64) []byte {
+	result, err := jsonparser.Set(grade, []byte(strconv.FormatFloat(mark, 'f', -1, 64)), "mark")
+	if err != nil {
+		return grade
+	}
+
+	return result
+}
+
+// validateGradeScale checks a GradeScale and returns what is wrong with it, or an empty string if it is valid.
+//
+// The ex officio points must be between 0 and 9, the rounding must be one of nearest, up, down or none, and every
+// threshold must give a mark between 1 and 10 from a percentage between 0 and 100. Higher thresholds can't give lower
+// marks, and no two thresholds can start from the same percentage.
+func validateGradeScale(document []byte) string {
+	var scale GradeScale
+	if err := json.Unmarshal(document, &scale); err != nil {
+		return "Invalid grade scale! Must be an object with exOfficio, rounding and thresholds!"
+	}
+
+	if _, err := jsonparser.GetFloat(document, "exOfficio"); err != nil && err != jsonparser.KeyPathNotFoundError {
+		return "Invalid ex officio points! Must be a number between 0 and 9!"
+	}
+	if scale.ExOfficio < 0 || scale.ExOfficio > maximumMark-minimumMark {
+		return "Invalid ex officio points! Must be a number between 0 and 9!"
+	}
+
+	rounding, err := jsonparser.GetString(document, "rounding")
+	if err != nil && err != jsonparser.KeyPathNotFoundError {
+		return "Invalid rounding! Must be one of nearest, up, down or none!"
+	}
+	if err == nil && rounding != roundingNearest && rounding != roundingUp && rounding != roundingDown &&
+		rounding != roundingNone {
+		return "Invalid rounding! Must be one of nearest, up, down or none!"
+	}
+
+	thresholds := append([]GradeThreshold(nil), scale.Thresholds...)
+	sort.SliceStable(thresholds, func(i, j int) bool {
+		return thresholds[i].From < thresholds[j].From
+	})
+
+	for index, threshold := range thresholds {
+		if threshold.From < 0 || threshold.From > 100 || threshold.Mark < minimumMark || threshold.Mark > maximumMark {
+			return "Invalid threshold! Thresholds must give a mark between 1 and 10 from a percentage between 0 and 100!"
+		}
+		if index > 0 && threshold.From == thresholds[index-1].From {
+			return "Invalid threshold! No two thresholds can start from the same percentage!"
+		}
+		if index > 0 && threshold.Mark < thresholds[index-1].Mark {
+			return "Invalid threshold! Higher thresholds can't give lower marks!"
+		}
+	}
+
+	return ""
+}
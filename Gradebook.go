@@ -0,0 +1,285 @@
+/*
+ * This file is part of VianuEdu.
+ *
+ *  VianuEdu is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ *  VianuEdu is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with VianuEdu.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * Developed by Matei Gardus <matei@gardus.eu>
+ */
+
+package vianueduserver
+
+import (
+	"github.com/buger/jsonparser"
+	"sort"
+	"time"
+)
+
+// The statuses of a student on a test of the gradebook. Students are "graded" once at least one of their attempts has
+// been graded, and "submitted" while their answer sheets are still waiting to be graded. Students who didn't submit
+// anything are "missing" once the test is over for them, and "pending" until then. Students the test isn't meant for
+// are "notAssigned".
+const (
+	gradebookGraded      = "graded"
+	gradebookSubmitted   = "submitted"
+	gradebookMissing     = "missing"
+	gradebookPending     = "pending"
+	gradebookNotAssigned = "notAssigned"
+)
+
+// A Gradebook lays out the results of a class on the tests of a course over a term, one row per student and one column
+// per test, the tests sorted by their start time.
+type Gradebook struct {
+	Course      string          `json:"course"`
+	Grade       int             `json:"grade"`
+	GradeLetter string          `json:"gradeLetter"`
+	Term        Term            `json:"term"`
+	Tests       []GradebookTest `json:"tests"`
+	Students    []GradebookRow  `json:"students"`
+}
+
+// A GradebookTest is a column of the gradebook, along with the average mark of the class on the test and how many
+// students of the class are in each status.
+type GradebookTest struct {
+	TestID    string   `json:"testID"`
+	TestName  string   `json:"testName"`
+	StartTime string   `json:"startTime"`
+	Thesis    bool     `json:"thesis"`
+	Average   *float64 `json:"average"`
+	Graded    int      `json:"graded"`
+	Submitted int      `json:"submitted"`
+	Missing   int      `json:"missing"`
+}
+
+// A GradebookRow is a row of the gradebook, with a cell for every test of the gradebook, in the same order, and the
+// average of the student over the term (see SubjectAverage).
+type GradebookRow struct {
+	StudentID      string          `json:"studentID"`
+	LastName       string          `json:"lastName"`
+	FirstName      string          `json:"firstName"`
+	Cells          []GradebookCell `json:"cells"`
+	CurrentAverage *float64        `json:"currentAverage"`
+	Average        *float64        `json:"average"`
+	Failing        bool            `json:"failing"`
+}
+
+// A GradebookCell is the result of a student on a test: their status, the mark that counts for them under the scoring
+// policy of the test, how many attempts they submitted and whether any of them was submitted late.
+type GradebookCell struct {
+	Status   string   `json:"status"`
+	Mark     *float64 `json:"mark,omitempty"`
+	Attempts int      `json:"attempts"`
+	Late     bool     `json:"late"`
+}
+
+// gradebookStudent is a student of the class of a gradebook, along with the student groups they are part of.
+type gradebookStudent struct {
+	id          string
+	userName    string
+	lastName    string
+	firstName   string
+	grade       int64
+	gradeLetter string
+	groupIDs    []string
+}
+
+// testTargetsStudent checks whether a Test object is meant for a student, be it through their class, one of their
+// student groups or the student themselves (see validateTestTargets).
+func testTargetsStudent(test []byte, student gradebookStudent) bool {
+	targeted := false
+
+	if grade, err := jsonparser.GetInt(test, "grade"); err == nil {
+		gradeLetter, _ := jsonparser.GetString(test, "gradeLetter")
+		targeted = grade == student.grade && gradeLetter == student.gradeLetter
+	}
+
+	jsonparser.ArrayEach(test, func(value []byte, dataType jsonparser.ValueType, offset int, err error) {
+		grade, _ := jsonparser.GetInt(value, "grade")
+		gradeLetter, _ := jsonparser.GetString(value, "gradeLetter")
+		targeted = targeted || (grade == student.grade && gradeLetter == student.gradeLetter)
+	}, "targets", "classes")
+
+	jsonparser.ArrayEach(test, func(value []byte, dataType jsonparser.ValueType, offset int, err error) {
+		for _, groupID := range student.groupIDs {
+			targeted = targeted || string(value) == groupID
+		}
+	}, "targets", "groups")
+
+	jsonparser.ArrayEach(test, func(value []byte, dataType jsonparser.ValueType, offset int, err error) {
+		targeted = targeted || string(value) == student.id
+	}, "targets", "students")
+
+	return targeted
+}
+
+// buildGradebook lays out the results of a class on the tests of a course over a term. Cancelled tests are left out.
+//
+// Tests only some students of the class take, through student groups or individually, are part of the gradebook as
+// well, the other students being "notAssigned" on them. Whether a test is over for a student takes their override on
+// the test, if any, into account.
+func buildGradebook(course string, grade int, gradeLetter string, term Term) Gradebook {
+	gradebook := Gradebook{Course: course, Grade: grade, GradeLetter: gradeLetter, Term: term,
+		Tests: []GradebookTest{}, Students: []GradebookRow{}}
+
+	var students []gradebookStudent
+	var studentIDs, groupIDs []string
+	studentsByUser := map[string]int{}
+
+	if classStudents := ListClassStudents(grade, gradeLetter); classStudents != "notFound" {
+		jsonparser.ArrayEach([]byte(classStudents), func(value []byte, dataType jsonparser.ValueType, offset int, err error) {
+			student := gradebookStudent{grade: int64(grade), gradeLetter: gradeLetter}
+			student.id, _ = jsonparser.GetString(value, "_id", "$oid")
+			student.userName, _ = jsonparser.GetString(value, "account", "userName")
+			student.lastName, _ = jsonparser.GetString(value, "lastName")
+			student.firstName, _ = jsonparser.GetString(value, "firstName")
+			student.groupIDs = GetStudentGroupIDs(student.id)
+
+			studentsByUser[student.userName] = len(students)
+			students = append(students, student)
+			studentIDs = append(studentIDs, student.id)
+			groupIDs = append(groupIDs, student.groupIDs...)
+		})
+	}
+
+	var tests [][]byte
+	if classTests := ListClassTests(course, grade, gradeLetter, studentIDs, groupIDs, term); classTests != "notFound" {
+		jsonparser.ArrayEach([]byte(classTests), func(value []byte, dataType jsonparser.ValueType, offset int, err error) {
+			test := readTestTimes(append([]byte(nil), value...))
+			testID, _ := jsonparser.GetString(test, "testID")
+			if testID == "" || GetTestStatus(testID) == testCancelled {
+				return
+			}
+			tests = append(tests, test)
+		})
+	}
+
+	sort.SliceStable(tests, func(i, j int) bool {
+		startI, _ := jsonparser.GetString(tests[i], "startTime")
+		startJ, _ := jsonparser.GetString(tests[j], "startTime")
+		timeI, _ := parseTestTime(startI)
+		timeJ, _ := parseTestTime(startJ)
+		return timeI.Before(timeJ)
+	})
+
+	cells := make([][]GradebookCell, len(students))
+	for index := range cells {
+		cells[index] = make([]GradebookCell, len(tests))
+	}
+
+	for column, test := range tests {
+		testID, _ := jsonparser.GetString(test, "testID")
+		testName, _ := jsonparser.GetString(test, "testName")
+		startTime, _ := jsonparser.GetString(test, "startTime")
+		gradebookTest := GradebookTest{TestID: testID, TestName: testName, StartTime: startTime, Thesis: isThesis(test)}
+
+		_, policy := getAttemptPolicy(test)
+		scale := getTestGradeScale(string(test))
+
+		marks := make([][]float64, len(students))
+
+		if grades := ListGradesForTest(testID); grades != "notFound" {
+			jsonparser.ArrayEach([]byte(grades), func(grade []byte, dataType jsonparser.ValueType, offset int, err error) {
+				studentUser, _ := jsonparser.GetString(grade, "studentAnswerSheet", "student", "account", "userName")
+				row, ok := studentsByUser[studentUser]
+				if cancelled, _ := jsonparser.GetBoolean(grade, "cancelled"); !ok || cancelled {
+					return
+				}
+
+				marks[row] = append(marks[row], scale.gradeMark(grade))
+				cells[row][column].Attempts++
+				cells[row][column].Late = cells[row][column].Late || readAttempt(grade, "studentAnswerSheet").Late
+			})
+		}
+
+		if answerSheets := ListAnswerSheetsForTest(testID); answerSheets != "notFound" {
+			jsonparser.ArrayEach([]byte(answerSheets), func(answerSheet []byte, dataType jsonparser.ValueType, offset int, err error) {
+				studentUser, _ := jsonparser.GetString(answerSheet, "student", "account", "userName")
+				row, ok := studentsByUser[studentUser]
+				if !ok {
+					return
+				}
+
+				cells[row][column].Attempts++
+				cells[row][column].Late = cells[row][column].Late || readAttempt(answerSheet).Late
+			})
+		}
+
+		overridden := map[string]bool{}
+		for _, studentID := range GetTestOverrideStudentIDs(testID) {
+			overridden[studentID] = true
+		}
+
+		total := 0.0
+		for row, student := range students {
+			cell := &cells[row][column]
+
+			switch {
+			case len(marks[row]) > 0:
+				mark := scale.roundMark(scoreAttempts(policy, marks[row]))
+				cell.Status = gradebookGraded
+				cell.Mark = &mark
+				gradebookTest.Graded++
+				total += mark
+			case cell.Attempts > 0:
+				cell.Status = gradebookSubmitted
+				gradebookTest.Submitted++
+			case !testTargetsStudent(test, student) && !overridden[student.id]:
+				cell.Status = gradebookNotAssigned
+			default:
+				studentTest := test
+				if overridden[student.id] {
+					studentTest = applyTestOverride(test, testID, student.id)
+				}
+
+				endTime, _ := jsonparser.GetString(studentTest, "endTime")
+				end, err := parseTestTime(endTime)
+				if err == nil && time.Now().After(end) {
+					cell.Status = gradebookMissing
+					gradebookTest.Missing++
+				} else {
+					cell.Status = gradebookPending
+				}
+			}
+		}
+
+		if gradebookTest.Graded > 0 {
+			average := truncateAverage(total / float64(gradebookTest.Graded))
+			gradebookTest.Average = &average
+		}
+
+		gradebook.Tests = append(gradebook.Tests, gradebookTest)
+	}
+
+	for row, student := range students {
+		average := SubjectAverage{Course: course}
+		for column, cell := range cells[row] {
+			if cell.Mark != nil {
+				average.addMark(AveragedMark{TestID: gradebook.Tests[column].TestID,
+					TestName: gradebook.Tests[column].TestName, Mark: *cell.Mark}, gradebook.Tests[column].Thesis)
+			}
+		}
+		average.settle(thesisWeight)
+
+		gradebook.Students = append(gradebook.Students, GradebookRow{
+			StudentID:      student.id,
+			LastName:       student.lastName,
+			FirstName:      student.firstName,
+			Cells:          cells[row],
+			CurrentAverage: average.CurrentAverage,
+			Average:        average.Average,
+			Failing:        average.Failing,
+		})
+	}
+
+	return gradebook
+}
@@ -103,6 +103,12 @@ var routes = Routes{
 		"/api/registerTeacher",
 		registerTeacher,
 	},
+	Route{
+		"RegisterParent",
+		"POST",
+		"/api/registerParent",
+		registerParent,
+	},
 	Route{
 		"ListClassbook",
 		"GET",
@@ -121,6 +127,48 @@ var routes = Routes{
 		"/api/submitAnswerSheet/{testID}",
 		submitAnswerSheet,
 	},
+	Route{
+		"GetSimilarAnswers",
+		"GET",
+		"/api/getSimilarAnswers/{testID}",
+		getSimilarAnswers,
+	},
+	Route{
+		"CheckAnswerSheet",
+		"GET",
+		"/api/checkAnswerSheet/{testID}/{studentID}",
+		checkAnswerSheet,
+	},
+	Route{
+		"SaveDraftAnswerSheet",
+		"POST",
+		"/api/saveDraftAnswerSheet/{testID}",
+		saveDraftAnswerSheet,
+	},
+	Route{
+		"GetDraftAnswerSheet",
+		"GET",
+		"/api/getDraftAnswerSheet/{testID}",
+		getDraftAnswerSheet,
+	},
+	Route{
+		"FinalizeDraftAnswerSheet",
+		"POST",
+		"/api/finalizeDraftAnswerSheet/{testID}",
+		finalizeDraftAnswerSheet,
+	},
+	Route{
+		"ReportExamEvent",
+		"POST",
+		"/api/reportExamEvent/{testID}",
+		reportExamEvent,
+	},
+	Route{
+		"GetExamTimeline",
+		"GET",
+		"/api/getExamTimeline/{testID}/{studentID}",
+		getExamTimeline,
+	},
 	Route{
 		"GetAnswerSheetsForTest",
 		"GET",
@@ -139,6 +187,120 @@ var routes = Routes{
 		"/api/submitGrade/{testID}",
 		submitGrade,
 	},
+	Route{
+		"GetTestResults",
+		"GET",
+		"/api/getTestResults/{testID}",
+		getTestResults,
+	},
+	Route{
+		"GetItemAnalysis",
+		"GET",
+		"/api/getItemAnalysis/{testID}",
+		getItemAnalysis,
+	},
+	Route{
+		"GetMatchingReview",
+		"GET",
+		"/api/getMatchingReview/{testID}",
+		getMatchingReview,
+	},
+	Route{
+		"GetGradeScale",
+		"GET",
+		"/api/getGradeScale/{course}",
+		getGradeScale,
+	},
+	Route{
+		"SetGradeScale",
+		"POST",
+		"/api/setGradeScale/{course}",
+		setGradeScale,
+	},
+	Route{
+		"AmendGrade",
+		"POST",
+		"/api/amendGrade/{testID}/{studentID}",
+		amendGrade,
+	},
+	Route{
+		"GetGradeHistory",
+		"GET",
+		"/api/getGradeHistory/{testID}/{studentID}",
+		getGradeHistory,
+	},
+	Route{
+		"OpenGradeAppeal",
+		"POST",
+		"/api/openGradeAppeal/{testID}",
+		openGradeAppeal,
+	},
+	Route{
+		"ListGradeAppeals",
+		"GET",
+		"/api/listGradeAppeals",
+		listGradeAppeals,
+	},
+	Route{
+		"ResolveGradeAppeal",
+		"POST",
+		"/api/resolveGradeAppeal/{appealID}",
+		resolveGradeAppeal,
+	},
+	Route{
+		"ExportTestResults",
+		"GET",
+		"/api/exportTestResults/{testID}",
+		exportTestResults,
+	},
+	Route{
+		"RegradeTest",
+		"POST",
+		"/api/regradeTest/{testID}",
+		regradeTest,
+	},
+	Route{
+		"ListAttempts",
+		"GET",
+		"/api/listAttempts/{testID}",
+		listAttempts,
+	},
+	Route{
+		"ListStudentAttempts",
+		"GET",
+		"/api/listStudentAttempts/{testID}/{studentID}",
+		listStudentAttempts,
+	},
+	Route{
+		"GetGradebook",
+		"GET",
+		"/api/getGradebook/{subject}/{grade}/{gradeLetter}",
+		getGradebook,
+	},
+	Route{
+		"ListAcademicYears",
+		"GET",
+		"/api/listAcademicYears",
+		listAcademicYears,
+	},
+	Route{
+		"GetAcademicYear",
+		"GET",
+		"/api/getAcademicYear/{year}",
+		getAcademicYear,
+	},
+	Route{
+		"SetAcademicYear",
+		"POST",
+		"/api/setAcademicYear/{year}",
+		setAcademicYear,
+	},
+	Route{
+		"GetAverages",
+		"GET",
+		"/api/getAverages/{studentID}",
+		getAverages,
+	},
 	Route{
 		"GetCurrentGrades",
 		"GET",
@@ -175,6 +337,12 @@ var routes = Routes{
 		"/api/viewTest/{testID}",
 		viewTest,
 	},
+	Route{
+		"ExportTest",
+		"GET",
+		"/api/exportTest/{testID}",
+		exportTest,
+	},
 	Route{
 		"GetNextTestID",
 		"GET",
@@ -193,12 +361,96 @@ var routes = Routes{
 		"/api/updateTest/{testID}",
 		updateTest,
 	},
+	Route{
+		"CancelTest",
+		"POST",
+		"/api/cancelTest/{testID}",
+		cancelTest,
+	},
+	Route{
+		"ArchiveTest",
+		"POST",
+		"/api/archiveTest/{testID}",
+		archiveTest,
+	},
+	Route{
+		"DeleteTest",
+		"POST",
+		"/api/deleteTest/{testID}",
+		deleteTest,
+	},
 	Route{
 		"GetTestQueue",
 		"GET",
 		"/api/getTestQueue/{subject}/{studentID}",
 		getTestQueue,
 	},
+	Route{
+		"CorrectTest",
+		"POST",
+		"/api/correctTest/{testID}",
+		correctTest,
+	},
+	Route{
+		"ListTestRevisions",
+		"GET",
+		"/api/listTestRevisions/{testID}",
+		listTestRevisions,
+	},
+	Route{
+		"GetTestRevision",
+		"GET",
+		"/api/getTestRevision/{testID}/{revision}",
+		getTestRevision,
+	},
+	Route{
+		"GetTestRevisionDiff",
+		"GET",
+		"/api/getTestRevisionDiff/{testID}/{from}/{to}",
+		getTestRevisionDiff,
+	},
+	Route{
+		"SetTestOverride",
+		"POST",
+		"/api/setTestOverride/{testID}/{studentID}",
+		setTestOverride,
+	},
+	Route{
+		"GetTestOverride",
+		"GET",
+		"/api/getTestOverride/{testID}/{studentID}",
+		getTestOverride,
+	},
+	Route{
+		"RemoveTestOverride",
+		"POST",
+		"/api/removeTestOverride/{testID}/{studentID}",
+		removeTestOverride,
+	},
+	Route{
+		"CreateStudentGroup",
+		"POST",
+		"/api/createStudentGroup",
+		createStudentGroup,
+	},
+	Route{
+		"UpdateStudentGroup",
+		"POST",
+		"/api/updateStudentGroup/{groupID}",
+		updateStudentGroup,
+	},
+	Route{
+		"GetStudentGroup",
+		"GET",
+		"/api/getStudentGroup/{groupID}",
+		getStudentGroup,
+	},
+	Route{
+		"ListStudentGroups",
+		"GET",
+		"/api/listStudentGroups",
+		listStudentGroups,
+	},
 	Route{
 		"GetPlannedTests",
 		"GET",
@@ -211,12 +463,60 @@ var routes = Routes{
 		"/api/getUncorrectedTests/{subject}",
 		getUncorrectedTests,
 	},
+	Route{
+		"GetOpenAppeals",
+		"GET",
+		"/api/getOpenAppeals/{subject}",
+		getOpenAppeals,
+	},
+	Route{
+		"AddBankQuestion",
+		"POST",
+		"/api/addBankQuestion/{course}",
+		addBankQuestion,
+	},
+	Route{
+		"GetBankQuestion",
+		"GET",
+		"/api/getBankQuestion/{course}/{questionID}",
+		getBankQuestion,
+	},
+	Route{
+		"ListBankQuestions",
+		"GET",
+		"/api/listBankQuestions/{course}",
+		listBankQuestions,
+	},
+	Route{
+		"ImportQuestions",
+		"POST",
+		"/api/importQuestions/{course}",
+		importQuestions,
+	},
+	Route{
+		"GetTestDraw",
+		"GET",
+		"/api/getTestDraw/{testID}",
+		getTestDraw,
+	},
+	Route{
+		"ViewTestDraw",
+		"GET",
+		"/api/viewTestDraw/{testID}/{studentID}",
+		viewTestDraw,
+	},
 	Route{
 		"AdminDownloadLogs",
 		"GET",
 		"/api/downloadLogs",
 		downloadLogs,
 	},
+	Route{
+		"AdminMigrateTestTimes",
+		"POST",
+		"/api/migrateTestTimes",
+		migrateTestTimes,
+	},
 	Route{
 		"UpdateServer",
 		"GET",
@@ -44,11 +44,24 @@ func StartServer() {
 	listenPort := strconv.FormatInt(listenPortInt, 10)
 	listenPort = ":" + listenPort
 
+	schoolTimezone = GetSchoolTimezone()
+	submissionGracePeriod = GetSubmissionGracePeriod()
+	lateSubmissionPolicy = GetLateSubmissionPolicy()
+	similarityThreshold = GetSimilarityThreshold()
+	judgeCommands = GetJudgeCommands()
+	judgeSandbox = GetJudgeSandbox()
+	judgeSlots = make(chan struct{}, GetJudgeWorkers())
+	thesisWeight = GetThesisWeight()
+
 	HTTPLogger.Println("[BOOT] Done reading configuration file")
 	HTTPLogger.Println("[BOOT] Initializing database backend...")
 
 	ConnectToDatabase()
 
+	HTTPLogger.Println("[BOOT] Starting draft answer sheet auto-submitter...")
+
+	StartDraftAutoSubmitter()
+
 	HTTPLogger.Print("[BOOT] Configuring HTTP Server...")
 
 	router := CreateRouter()
@@ -0,0 +1,633 @@
+/*
+ * This file is part of VianuEdu.
+ *
+ *  VianuEdu is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ *  VianuEdu is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with VianuEdu.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * Developed by Matei Gardus <matei@gardus.eu>
+ */
+
+package vianueduserver
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"html"
+	"io"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// An importedQuestion is a question converted from another format, as it appears in the contents of a Test object or
+// in the question bank.
+type importedQuestion struct {
+	Question        string   `json:"question"`
+	Answer          string   `json:"answer"`
+	QuestionChoices []string `json:"questionChoices,omitempty"`
+	QuestionType    string   `json:"questionType"`
+	Tags            []string `json:"tags,omitempty"`
+}
+
+// A SkippedQuestion is a question that couldn't be imported, along with its type in the original format and the reason
+// it was skipped.
+type SkippedQuestion struct {
+	Name         string `json:"name"`
+	QuestionType string `json:"questionType"`
+	Reason       string `json:"reason"`
+}
+
+// An ImportReport sums up an import. Imported questions are either added to the question bank, in which case their IDs
+// are listed, or gathered in a Test object, which is sent back for the teacher to complete and create.
+type ImportReport struct {
+	Format      string                 `json:"format"`
+	Target      string                 `json:"target"`
+	Imported    int                    `json:"imported"`
+	QuestionIDs []string               `json:"questionIDs,omitempty"`
+	Test        map[string]interface{} `json:"test,omitempty"`
+	Skipped     []SkippedQuestion      `json:"skipped"`
+}
+
+// maxImportSize is the largest file, in bytes, questions can be imported from. The items of a QTI package can't add up
+// to more than this once uncompressed either.
+const maxImportSize = 10 << 20
+
+// htmlTagPattern matches HTML tags, which are stripped from imported questions.
+var htmlTagPattern = regexp.MustCompile(`<[^>]*>`)
+
+// stripHTML turns the HTML text of an imported question into plain text.
+func stripHTML(text string) string {
+	text = htmlTagPattern.ReplaceAllString(text, " ")
+	text = html.UnescapeString(text)
+
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// choiceLabel labels the choice with the provided index the way choices are written in a Test object, i.e.
+// "b) Moldoveanu.".
+func choiceLabel(index int, choice string) string {
+	return string(rune('a'+index)) + ") " + choice
+}
+
+// convertQuestionFile converts the questions of a Moodle XML file ("moodle"), a GIFT file ("gift") or an IMS QTI 2.1
+// item or package ("qti") and returns them, along with the questions that couldn't be converted.
+func convertQuestionFile(format string, data []byte) ([]importedQuestion, []SkippedQuestion) {
+	switch format {
+	case "moodle":
+		return importMoodleXML(data)
+	case "gift":
+		return importGIFT(string(data))
+	default:
+		return importQTI(data)
+	}
+}
+
+// importedTest gathers imported questions in the contents of a Test object of the provided course, numbered in the
+// order they were imported. The rest of the test, such as its name and times, is left for the teacher to fill in.
+func importedTest(course string, questions []importedQuestion) map[string]interface{} {
+	contents := map[string]interface{}{}
+	for index, question := range questions {
+		question.Tags = nil
+		contents[strconv.Itoa(index+1)] = question
+	}
+
+	return map[string]interface{}{
+		"course":   course,
+		"contents": contents,
+	}
+}
+
+// A moodleQuiz is a Moodle XML file.
+type moodleQuiz struct {
+	Questions []moodleQuestion `xml:"question"`
+}
+
+// A moodleQuestion is a single question of a Moodle XML file. Categories are written as questions as well.
+type moodleQuestion struct {
+	Type         string         `xml:"type,attr"`
+	Name         string         `xml:"name>text"`
+	QuestionText string         `xml:"questiontext>text"`
+	Category     string         `xml:"category>text"`
+	Single       string         `xml:"single"`
+	Answers      []moodleAnswer `xml:"answer"`
+	Tags         []string       `xml:"tags>tag>text"`
+}
+
+// A moodleAnswer is an answer of a Moodle question. Right answers are worth a fraction of 100.
+type moodleAnswer struct {
+	Fraction string `xml:"fraction,attr"`
+	Text     string `xml:"text"`
+}
+
+// isRight checks whether an answer of a Moodle question is worth full marks.
+func (answer moodleAnswer) isRight() bool {
+	fraction, err := strconv.ParseFloat(answer.Fraction, 64)
+
+	return err == nil && fraction >= 100
+}
+
+// importMoodleXML converts the questions of a Moodle XML file. Multiple-choice questions with a single right answer
+// and true/false questions become multiple-choice questions, while short-answer, numerical and essay questions become
+// normal questions. The category of every question is kept as a tag.
+func importMoodleXML(data []byte) ([]importedQuestion, []SkippedQuestion) {
+	var quiz moodleQuiz
+	var questions []importedQuestion
+	var skipped []SkippedQuestion
+
+	if err := xml.Unmarshal(data, &quiz); err != nil {
+		return nil, []SkippedQuestion{{Name: "file", QuestionType: "moodle", Reason: "Invalid Moodle XML: " + err.Error()}}
+	}
+
+	category := ""
+
+	for _, moodleQuestion := range quiz.Questions {
+		if moodleQuestion.Type == "category" {
+			category = path.Base(strings.TrimSpace(moodleQuestion.Category))
+			continue
+		}
+
+		question, reason := convertMoodleQuestion(moodleQuestion)
+		if reason != "" {
+			skipped = append(skipped, SkippedQuestion{Name: moodleQuestion.Name, QuestionType: moodleQuestion.Type, Reason: reason})
+			continue
+		}
+
+		question.Tags = moodleQuestion.Tags
+		if category != "" && category != "top" && category != "." {
+			question.Tags = append(question.Tags, category)
+		}
+
+		questions = append(questions, question)
+	}
+
+	return questions, skipped
+}
+
+// convertMoodleQuestion converts a single Moodle question, or returns the reason it can't be converted.
+func convertMoodleQuestion(moodleQuestion moodleQuestion) (importedQuestion, string) {
+	question := importedQuestion{Question: stripHTML(moodleQuestion.QuestionText), QuestionType: "normal"}
+
+	switch moodleQuestion.Type {
+	case "multichoice":
+		if moodleQuestion.Single == "false" || moodleQuestion.Single == "0" {
+			return question, "Multiple-choice questions with several right answers aren't supported."
+		}
+		question.QuestionType = "multiple-choice"
+		for index, answer := range moodleQuestion.Answers {
+			choice := choiceLabel(index, stripHTML(answer.Text))
+			question.QuestionChoices = append(question.QuestionChoices, choice)
+			if answer.isRight() && question.Answer == "" {
+				question.Answer = choice
+			}
+		}
+	case "truefalse":
+		question.QuestionType = "multiple-choice"
+		question.QuestionChoices = []string{choiceLabel(0, "True."), choiceLabel(1, "False.")}
+		for _, answer := range moodleQuestion.Answers {
+			if answer.isRight() && strings.EqualFold(strings.TrimSpace(answer.Text), "false") {
+				question.Answer = question.QuestionChoices[1]
+			} else if answer.isRight() {
+				question.Answer = question.QuestionChoices[0]
+			}
+		}
+	case "shortanswer", "numerical":
+		for _, answer := range moodleQuestion.Answers {
+			if answer.isRight() {
+				question.Answer = stripHTML(answer.Text)
+				break
+			}
+		}
+	case "essay":
+		return question, ""
+	default:
+		return question, "Moodle questions of type " + moodleQuestion.Type + " aren't supported."
+	}
+
+	if question.Answer == "" {
+		return question, "The question has no right answer."
+	}
+
+	return question, ""
+}
+
+// giftEscapes lists the characters GIFT escapes with a backslash, along with the private characters they are swapped
+// with while a GIFT file is parsed.
+var giftEscapes = strings.NewReplacer(`\:`, "", `\~`, "", `\=`, "", `\#`, "", `\{`, "",
+	`\}`, "")
+
+// giftUnescapes swaps the private characters of giftEscapes back to the characters they stand for.
+var giftUnescapes = strings.NewReplacer("", ":", "", "~", "", "=", "", "#", "", "{",
+	"", "}")
+
+// giftFormatPattern matches the text format a GIFT question may start with, i.e. "[html]".
+var giftFormatPattern = regexp.MustCompile(`^\[(html|moodle|plain|markdown)\]`)
+
+// importGIFT converts the questions of a GIFT file, which are separated by blank lines. Multiple-choice questions with
+// a single right answer and true/false questions become multiple-choice questions, while short-answer, numerical and
+// essay questions become normal questions. The category of every question is kept as a tag.
+func importGIFT(data string) ([]importedQuestion, []SkippedQuestion) {
+	var questions []importedQuestion
+	var skipped []SkippedQuestion
+
+	category := ""
+
+	for _, block := range splitGIFTBlocks(data) {
+		var lines []string
+		for _, line := range strings.Split(block, "\n") {
+			trimmedLine := strings.TrimSpace(line)
+			if strings.HasPrefix(trimmedLine, "$CATEGORY:") {
+				category = path.Base(strings.TrimSpace(strings.TrimPrefix(trimmedLine, "$CATEGORY:")))
+				continue
+			}
+			lines = append(lines, line)
+		}
+
+		if strings.TrimSpace(strings.Join(lines, "")) == "" {
+			continue
+		}
+
+		question, name, reason := convertGIFTQuestion(strings.Join(lines, "\n"))
+		if reason != "" {
+			skipped = append(skipped, SkippedQuestion{Name: name, QuestionType: "gift", Reason: reason})
+			continue
+		}
+
+		if category != "" && category != "top" && category != "." {
+			question.Tags = []string{category}
+		}
+
+		questions = append(questions, question)
+	}
+
+	return questions, skipped
+}
+
+// splitGIFTBlocks splits a GIFT file into the blocks its questions are written in, leaving out comments.
+func splitGIFTBlocks(data string) []string {
+	data = giftEscapes.Replace(strings.Replace(data, "\r\n", "\n", -1))
+
+	var blocks []string
+	var block []string
+
+	for _, line := range strings.Split(data, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "//") {
+			continue
+		}
+		if strings.TrimSpace(line) == "" {
+			if len(block) > 0 {
+				blocks = append(blocks, strings.Join(block, "\n"))
+			}
+			block = nil
+			continue
+		}
+		block = append(block, line)
+	}
+	if len(block) > 0 {
+		blocks = append(blocks, strings.Join(block, "\n"))
+	}
+
+	return blocks
+}
+
+// convertGIFTQuestion converts a single GIFT question, and returns it along with its name. Should the question not be
+// convertible, the reason for it is returned as well.
+func convertGIFTQuestion(block string) (importedQuestion, string, string) {
+	block = strings.TrimSpace(block)
+	name := ""
+
+	if strings.HasPrefix(block, "::") {
+		if end := strings.Index(block[2:], "::"); end >= 0 {
+			name = strings.TrimSpace(giftUnescapes.Replace(block[2 : end+2]))
+			block = strings.TrimSpace(block[end+4:])
+		}
+	}
+
+	block = giftFormatPattern.ReplaceAllString(block, "")
+
+	open := strings.Index(block, "{")
+	closing := strings.LastIndex(block, "}")
+	if open < 0 || closing < open {
+		return importedQuestion{}, name, "Descriptions aren't questions, since they have no answer."
+	}
+
+	text := strings.TrimSpace(block[:open])
+	if after := strings.TrimSpace(block[closing+1:]); after != "" {
+		text = text + " _____ " + after
+	}
+	if name == "" {
+		name = giftUnescapes.Replace(text)
+	}
+
+	question, reason := convertGIFTAnswers(block[open+1 : closing])
+	question.Question = stripHTML(giftUnescapes.Replace(text))
+
+	return question, name, reason
+}
+
+// giftFeedbackPattern matches the feedback of a GIFT answer, which is left out.
+var giftFeedbackPattern = regexp.MustCompile(`#[^=~]*`)
+
+// convertGIFTAnswers converts the answers of a GIFT question, written between braces, or returns the reason they
+// can't be converted.
+func convertGIFTAnswers(answers string) (importedQuestion, string) {
+	question := importedQuestion{QuestionType: "normal"}
+	answers = strings.TrimSpace(answers)
+
+	switch {
+	case answers == "":
+		return question, ""
+	case answers == "T" || answers == "TRUE" || answers == "F" || answers == "FALSE":
+		question.QuestionType = "multiple-choice"
+		question.QuestionChoices = []string{choiceLabel(0, "True."), choiceLabel(1, "False.")}
+		question.Answer = question.QuestionChoices[0]
+		if strings.HasPrefix(answers, "F") {
+			question.Answer = question.QuestionChoices[1]
+		}
+		return question, ""
+	case strings.HasPrefix(answers, "#"):
+		value := strings.TrimPrefix(strings.TrimPrefix(answers, "#"), "=")
+		fields := strings.FieldsFunc(value, func(r rune) bool { return r == ':' || r == '=' || r == '#' || r == '~' })
+		if len(fields) == 0 {
+			return question, "GIFT numerical questions must have an answer."
+		}
+		question.Answer = strings.TrimSpace(strings.Split(fields[0], "..")[0])
+		return question, ""
+	case strings.Contains(answers, "->"):
+		return question, "GIFT matching questions aren't supported."
+	case strings.Contains(answers, "%"):
+		return question, "GIFT questions with partial credit aren't supported."
+	}
+
+	return convertGIFTChoices(giftFeedbackPattern.ReplaceAllString(answers, ""))
+}
+
+// convertGIFTChoices converts the answers of a GIFT question made of choices ("~") and right answers ("="). Questions
+// without choices are short-answer questions, while questions with choices must have a single right answer.
+func convertGIFTChoices(answers string) (importedQuestion, string) {
+	question := importedQuestion{QuestionType: "normal"}
+
+	var choices []string
+	rightAnswers := 0
+
+	for index := 0; index < len(answers); {
+		next := strings.IndexAny(answers[index+1:], "=~")
+		end := len(answers)
+		if next >= 0 {
+			end = index + 1 + next
+		}
+
+		answer := strings.TrimSpace(giftUnescapes.Replace(answers[index+1 : end]))
+		if answers[index] == '=' {
+			rightAnswers++
+			if question.Answer == "" {
+				question.Answer = answer
+			}
+		}
+		if answers[index] == '~' || answers[index] == '=' {
+			choices = append(choices, answer)
+		}
+
+		index = end
+	}
+
+	if len(choices) == rightAnswers {
+		if question.Answer == "" {
+			return question, "The question has no right answer."
+		}
+		return question, ""
+	}
+
+	if rightAnswers == 0 {
+		return question, "The question has no right answer."
+	}
+	if rightAnswers != 1 {
+		return question, "Multiple-choice questions with several right answers aren't supported."
+	}
+
+	question.QuestionType = "multiple-choice"
+	for index, choice := range choices {
+		question.QuestionChoices = append(question.QuestionChoices, choiceLabel(index, choice))
+		if choice == question.Answer {
+			question.Answer = question.QuestionChoices[index]
+		}
+	}
+
+	return question, ""
+}
+
+// A qtiAssessmentItem is a single question of an IMS QTI 2.1 package.
+type qtiAssessmentItem struct {
+	XMLName              xml.Name                 `xml:"assessmentItem"`
+	Identifier           string                   `xml:"identifier,attr"`
+	Title                string                   `xml:"title,attr"`
+	ResponseDeclarations []qtiResponseDeclaration `xml:"responseDeclaration"`
+	ItemBody             struct {
+		Inner string `xml:",innerxml"`
+	} `xml:"itemBody"`
+}
+
+// A qtiResponseDeclaration declares a response of a QTI item, along with its right values.
+type qtiResponseDeclaration struct {
+	Identifier      string   `xml:"identifier,attr"`
+	CorrectResponse []string `xml:"correctResponse>value"`
+}
+
+// A qtiInteraction is an interaction of a QTI item, through which the student answers it.
+type qtiInteraction struct {
+	Type               string
+	ResponseIdentifier string `xml:"responseIdentifier,attr"`
+	MaxChoices         int    `xml:"maxChoices,attr"`
+	Prompt             string `xml:"prompt"`
+	SimpleChoices      []struct {
+		Identifier string `xml:"identifier,attr"`
+		Inner      string `xml:",innerxml"`
+	} `xml:"simpleChoice"`
+}
+
+// importQTI converts the questions of an IMS QTI 2.1 package, which is either a zip archive of items or a single item.
+// Items are imported in the order of their file names.
+// Choice interactions with a single right choice become multiple-choice questions, while text entry and extended text
+// interactions become normal questions.
+func importQTI(data []byte) ([]importedQuestion, []SkippedQuestion) {
+	var questions []importedQuestion
+	var skipped []SkippedQuestion
+
+	items, tooLarge := readQTIItems(data)
+	for _, name := range tooLarge {
+		skipped = append(skipped, SkippedQuestion{Name: name, QuestionType: "qti",
+			Reason: "The QTI package is too large once uncompressed."})
+	}
+
+	var names []string
+	for name := range items {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		item := items[name]
+
+		var assessmentItem qtiAssessmentItem
+		if err := xml.Unmarshal(item, &assessmentItem); err != nil {
+			if !strings.Contains(err.Error(), "expected element type <assessmentItem>") {
+				skipped = append(skipped, SkippedQuestion{Name: name, QuestionType: "qti", Reason: "Invalid QTI item: " + err.Error()})
+			}
+			continue
+		}
+
+		question, questionType, reason := convertQTIItem(assessmentItem)
+		if reason != "" {
+			if assessmentItem.Title != "" {
+				name = assessmentItem.Title
+			}
+			skipped = append(skipped, SkippedQuestion{Name: name, QuestionType: questionType, Reason: reason})
+			continue
+		}
+
+		questions = append(questions, question)
+	}
+
+	return questions, skipped
+}
+
+// readQTIItems returns every XML file of a QTI package by name, leaving out its manifest. A single XML file is treated
+// as a package of one item.
+//
+// Once the items read add up to maxImportSize, uncompressed, the rest of the package is left unread, and the names of
+// the items left out are returned as well.
+func readQTIItems(data []byte) (map[string][]byte, []string) {
+	items := map[string][]byte{}
+	var tooLarge []string
+
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		items["item"] = data
+		return items, nil
+	}
+
+	remaining := int64(maxImportSize)
+
+	for _, file := range archive.File {
+		if !strings.HasSuffix(strings.ToLower(file.Name), ".xml") || path.Base(file.Name) == "imsmanifest.xml" {
+			continue
+		}
+
+		if remaining <= 0 {
+			tooLarge = append(tooLarge, file.Name)
+			continue
+		}
+
+		reader, err := file.Open()
+		if err != nil {
+			continue
+		}
+		item, err := ioutil.ReadAll(io.LimitReader(reader, remaining+1))
+		reader.Close()
+		if err != nil {
+			continue
+		}
+
+		if int64(len(item)) > remaining {
+			tooLarge = append(tooLarge, file.Name)
+			remaining = 0
+			continue
+		}
+
+		remaining -= int64(len(item))
+		items[file.Name] = item
+	}
+
+	return items, tooLarge
+}
+
+// convertQTIItem converts a single QTI item and returns it along with the type of its interaction. Should the item not
+// be convertible, the reason for it is returned as well.
+func convertQTIItem(item qtiAssessmentItem) (importedQuestion, string, string) {
+	text, interactions := readQTIItemBody(item.ItemBody.Inner)
+
+	if len(interactions) != 1 {
+		return importedQuestion{}, "qti", "Only QTI items with exactly one interaction are supported."
+	}
+	interaction := interactions[0]
+
+	question := importedQuestion{Question: strings.TrimSpace(text + " " + stripHTML(interaction.Prompt)), QuestionType: "normal"}
+
+	var rightValues []string
+	for _, declaration := range item.ResponseDeclarations {
+		if declaration.Identifier == interaction.ResponseIdentifier {
+			rightValues = declaration.CorrectResponse
+		}
+	}
+
+	switch interaction.Type {
+	case "choiceInteraction":
+		if interaction.MaxChoices != 1 || len(rightValues) != 1 {
+			return question, interaction.Type, "Multiple-choice questions with several right answers aren't supported."
+		}
+		question.QuestionType = "multiple-choice"
+		for index, choice := range interaction.SimpleChoices {
+			label := choiceLabel(index, stripHTML(choice.Inner))
+			question.QuestionChoices = append(question.QuestionChoices, label)
+			if choice.Identifier == strings.TrimSpace(rightValues[0]) {
+				question.Answer = label
+			}
+		}
+	case "textEntryInteraction":
+		if len(rightValues) > 0 {
+			question.Answer = strings.TrimSpace(rightValues[0])
+		}
+	case "extendedTextInteraction":
+		return question, interaction.Type, ""
+	default:
+		return question, interaction.Type, "QTI items with a " + interaction.Type + " aren't supported."
+	}
+
+	if question.Answer == "" {
+		return question, interaction.Type, "The question has no right answer."
+	}
+
+	return question, interaction.Type, ""
+}
+
+// readQTIItemBody reads the body of a QTI item, returning its text, as plain text, and its interactions.
+func readQTIItemBody(body string) (string, []qtiInteraction) {
+	var text []string
+	var interactions []qtiInteraction
+
+	decoder := xml.NewDecoder(strings.NewReader(body))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			break
+		}
+
+		switch element := token.(type) {
+		case xml.StartElement:
+			if strings.HasSuffix(element.Name.Local, "Interaction") {
+				var interaction qtiInteraction
+				if decoder.DecodeElement(&interaction, &element) == nil {
+					interaction.Type = element.Name.Local
+					interactions = append(interactions, interaction)
+				}
+			}
+		case xml.CharData:
+			text = append(text, string(element))
+		}
+	}
+
+	return stripHTML(strings.Join(text, " ")), interactions
+}
@@ -0,0 +1,444 @@
+/*
+ * This file is part of VianuEdu.
+ *
+ *  VianuEdu is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ *  VianuEdu is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with VianuEdu.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * Developed by Matei Gardus <matei@gardus.eu>
+ */
+
+package vianueduserver
+
+import (
+	"encoding/csv"
+	"fmt"
+	"github.com/buger/jsonparser"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// scoreBinCount is the number of equal bins the score distribution of a test is split into.
+const scoreBinCount = 10
+
+// discriminationGroupShare is the share of graded students that make up each of the upper and lower groups used to
+// compute the discrimination index of a question.
+const discriminationGroupShare = 0.27
+
+// An ItemAnalysis holds the statistics of a test, computed from the answer sheets of all of its students, graded or
+// not.
+type ItemAnalysis struct {
+	TestID            string               `json:"testID"`
+	Submissions       int                  `json:"submissions"`
+	ScoreDistribution ScoreDistribution    `json:"scoreDistribution"`
+	Questions         []QuestionStatistics `json:"questions"`
+}
+
+// A ScoreDistribution sums up the grades given on a test. Only graded answer sheets are part of it.
+type ScoreDistribution struct {
+	Graded  int        `json:"graded"`
+	Mean    float64    `json:"mean"`
+	Minimum float64    `json:"minimum"`
+	Maximum float64    `json:"maximum"`
+	Bins    []ScoreBin `json:"bins"`
+}
+
+// A ScoreBin counts the grades between two scores. The upper bound only belongs to the last bin.
+type ScoreBin struct {
+	From  float64 `json:"from"`
+	To    float64 `json:"to"`
+	Count int     `json:"count"`
+}
+
+// QuestionStatistics holds the statistics of a single question of a test.
+//
+// The facility index is the share of students who answered the question right, while the discrimination index is the
+// difference between that share in the upper and in the lower 27% of graded students. Both are only computed for
+// objective questions and are left empty otherwise. Distractors count how many students picked each choice of a
+// multiple-choice question.
+type QuestionStatistics struct {
+	QuestionNumber string         `json:"questionNumber"`
+	QuestionType   string         `json:"questionType"`
+	Responses      int            `json:"responses"`
+	Omissions      int            `json:"omissions"`
+	OmissionRate   float64        `json:"omissionRate"`
+	Facility       *float64       `json:"facility"`
+	Discrimination *float64       `json:"discrimination"`
+	Distractors    map[string]int `json:"distractors,omitempty"`
+}
+
+// An itemResponse is a single answer sheet of a test, along with the test as its student took it and, if it has been
+// graded, its score.
+type itemResponse struct {
+	answers []byte
+	test    []byte
+	score   float64
+	graded  bool
+}
+
+// analyzeTest computes the item analysis of a test from the grades given on it and its answer sheets still waiting to
+// be graded, one per student (see collectItemResponses). Answers are checked against the current answer key of the
+// test.
+func analyzeTest(testID, test string) ItemAnalysis {
+	responses, maximumGrade := collectItemResponses(testID, test)
+
+	analysis := ItemAnalysis{
+		TestID:            testID,
+		Submissions:       len(responses),
+		ScoreDistribution: distributeScores(responses, maximumGrade),
+		Questions:         []QuestionStatistics{},
+	}
+
+	upper, lower := discriminationGroups(responses)
+
+	for _, questionNumber := range listQuestionNumbers(responses) {
+		analysis.Questions = append(analysis.Questions, analyzeQuestion(questionNumber, responses, upper, lower))
+	}
+
+	return analysis
+}
+
+// collectItemResponses gathers the answer sheet of every student who took a test, graded or not, and returns them
+// along with the highest maximum grade of the graded ones.
+//
+// Students who took the test several times only count once, with the attempt that counts under the scoring policy of
+// the test: their best graded attempt, or their last one if the test keeps the last or the average score. Students
+// with no graded attempt count with their last answer sheet.
+func collectItemResponses(testID, test string) ([]itemResponse, float64) {
+	var responses []itemResponse
+	maximumGrade := 0.0
+
+	_, policy := getAttemptPolicy([]byte(test))
+
+	studentTest := func(studentSheet []byte) []byte {
+		studentUser, _ := jsonparser.GetString(studentSheet, "student", "account", "userName")
+		studentPass, _ := jsonparser.GetString(studentSheet, "student", "account", "password")
+
+		if draw := GetTestDraw(testID, FindStudentID(studentUser, studentPass)); draw != "notFound" {
+			return []byte(mergeTestDraw(test, draw))
+		}
+		return []byte(test)
+	}
+
+	// the index in responses and the attempt number of the answer sheet kept for each student
+	kept := map[string]int{}
+	keptAttempts := map[string]int{}
+
+	keep := func(studentSheet []byte, response itemResponse, replaces func(keptResponse itemResponse, later bool) bool) {
+		studentUser, _ := jsonparser.GetString(studentSheet, "student", "account", "userName")
+		attempt := getAttemptNumber(studentSheet)
+
+		index, ok := kept[studentUser]
+		switch {
+		case !ok:
+			kept[studentUser] = len(responses)
+			responses = append(responses, response)
+		case replaces(responses[index], attempt > keptAttempts[studentUser]):
+			responses[index] = response
+		default:
+			return
+		}
+		keptAttempts[studentUser] = attempt
+	}
+
+	if grades := ListGradesForTest(testID); grades != "notFound" {
+		jsonparser.ArrayEach([]byte(grades), func(grade []byte, dataType jsonparser.ValueType, offset int, err error) {
+			answerSheet, _, _, _ := jsonparser.Get(grade, "studentAnswerSheet")
+			answers, _, _, _ := jsonparser.Get(answerSheet, "answers")
+			score, _ := jsonparser.GetFloat(grade, "currentGrade")
+
+			if gradeMaximum, _ := jsonparser.GetFloat(grade, "MAXIMUM_GRADE"); gradeMaximum > maximumGrade {
+				maximumGrade = gradeMaximum
+			}
+
+			keep(answerSheet, itemResponse{answers, studentTest(answerSheet), score, true},
+				func(keptResponse itemResponse, later bool) bool {
+					if policy == scoringBest {
+						return score > keptResponse.score || score == keptResponse.score && later
+					}
+					return later
+				})
+		})
+	}
+
+	if answerSheets := ListAnswerSheetsForTest(testID); answerSheets != "notFound" {
+		jsonparser.ArrayEach([]byte(answerSheets), func(answerSheet []byte, dataType jsonparser.ValueType, offset int, err error) {
+			answers, _, _, _ := jsonparser.Get(answerSheet, "answers")
+
+			keep(answerSheet, itemResponse{answers, studentTest(answerSheet), 0, false},
+				func(keptResponse itemResponse, later bool) bool {
+					return !keptResponse.graded && later
+				})
+		})
+	}
+
+	return responses, maximumGrade
+}
+
+// listQuestionNumbers lists the numbers of every question found in the tests the students took, in numerical order.
+func listQuestionNumbers(responses []itemResponse) []string {
+	seen := map[string]bool{}
+	var questionNumbers []string
+
+	for _, response := range responses {
+		jsonparser.ObjectEach(response.test, func(key []byte, value []byte, dataType jsonparser.ValueType, offset int) error {
+			if !seen[string(key)] {
+				seen[string(key)] = true
+				questionNumbers = append(questionNumbers, string(key))
+			}
+			return nil
+		}, "contents")
+	}
+
+	sort.Slice(questionNumbers, func(i, j int) bool {
+		first, err1 := strconv.Atoi(questionNumbers[i])
+		second, err2 := strconv.Atoi(questionNumbers[j])
+		if err1 != nil || err2 != nil {
+			return questionNumbers[i] < questionNumbers[j]
+		}
+		return first < second
+	})
+
+	return questionNumbers
+}
+
+// discriminationGroups splits off the upper and lower 27% of the graded answer sheets, by score, and returns their
+// indexes. Both groups are empty when there are fewer than two graded answer sheets.
+func discriminationGroups(responses []itemResponse) ([]int, []int) {
+	var graded []int
+	for index, response := range responses {
+		if response.graded {
+			graded = append(graded, index)
+		}
+	}
+
+	if len(graded) < 2 {
+		return nil, nil
+	}
+
+	sort.SliceStable(graded, func(i, j int) bool {
+		return responses[graded[i]].score > responses[graded[j]].score
+	})
+
+	groupSize := int(math.Ceil(float64(len(graded)) * discriminationGroupShare))
+	if groupSize > len(graded)/2 {
+		groupSize = len(graded) / 2
+	}
+
+	return graded[:groupSize], graded[len(graded)-groupSize:]
+}
+
+// analyzeQuestion computes the statistics of a single question. Omitted answers count as wrong answers.
+func analyzeQuestion(questionNumber string, responses []itemResponse, upper, lower []int) QuestionStatistics {
+	statistics := QuestionStatistics{QuestionNumber: questionNumber}
+
+	objective := false
+	correct := make([]bool, len(responses))
+	correctCount := 0
+
+	for index, response := range responses {
+		question, _, _, err := jsonparser.Get(response.test, "contents", questionNumber)
+		if err != nil {
+			continue
+		}
+
+		statistics.Responses++
+		statistics.QuestionType, _ = jsonparser.GetString(question, "questionType")
+
+		if isObjectiveQuestion(question) {
+			objective = true
+		}
+		if isMultipleChoiceQuestion(question) {
+			statistics.Distractors = countChoices(question, statistics.Distractors)
+		}
+
+		answer, _ := jsonparser.GetString(response.answers, questionNumber)
+		if strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(answer), multipleAnswerPrefix)) == "" {
+			statistics.Omissions++
+			continue
+		}
+
+		if !isObjectiveQuestion(question) {
+			continue
+		}
+
+		if isMultipleChoiceQuestion(question) {
+			statistics.Distractors[choiceLetter(answer)]++
+		}
+
+		if matchesAnswerKey(question, answer, answerKeyEntry(question)) {
+			correct[index] = true
+			correctCount++
+		}
+	}
+
+	if statistics.Responses == 0 {
+		return statistics
+	}
+
+	statistics.OmissionRate = float64(statistics.Omissions) / float64(statistics.Responses)
+
+	if objective {
+		facility := float64(correctCount) / float64(statistics.Responses)
+		statistics.Facility = &facility
+
+		if len(upper) > 0 {
+			discrimination := float64(countCorrect(correct, upper)-countCorrect(correct, lower)) / float64(len(upper))
+			statistics.Discrimination = &discrimination
+		}
+	}
+
+	return statistics
+}
+
+// countChoices makes sure every choice of a multiple-choice question shows up in its distractor counts, even if nobody
+// picked it.
+func countChoices(question []byte, distractors map[string]int) map[string]int {
+	if distractors == nil {
+		distractors = map[string]int{}
+	}
+
+	jsonparser.ArrayEach(question, func(choice []byte, dataType jsonparser.ValueType, offset int, err error) {
+		letter := choiceLetter(string(choice))
+		if _, ok := distractors[letter]; !ok {
+			distractors[letter] = 0
+		}
+	}, "questionChoices")
+
+	return distractors
+}
+
+// countCorrect counts how many of the answer sheets with the provided indexes got a question right.
+func countCorrect(correct []bool, indexes []int) int {
+	count := 0
+	for _, index := range indexes {
+		if correct[index] {
+			count++
+		}
+	}
+
+	return count
+}
+
+// distributeScores computes the score distribution of the graded answer sheets, splitting the scores from 0 up to the
+// maximum grade of the test into equal bins.
+func distributeScores(responses []itemResponse, maximumGrade float64) ScoreDistribution {
+	distribution := ScoreDistribution{Bins: []ScoreBin{}}
+
+	if maximumGrade <= 0 {
+		maximumGrade = 100
+	}
+
+	binWidth := maximumGrade / scoreBinCount
+	for bin := 0; bin < scoreBinCount; bin++ {
+		distribution.Bins = append(distribution.Bins, ScoreBin{From: float64(bin) * binWidth, To: float64(bin+1) * binWidth})
+	}
+
+	total := 0.0
+	for _, response := range responses {
+		if !response.graded {
+			continue
+		}
+
+		if distribution.Graded == 0 || response.score < distribution.Minimum {
+			distribution.Minimum = response.score
+		}
+		if distribution.Graded == 0 || response.score > distribution.Maximum {
+			distribution.Maximum = response.score
+		}
+
+		distribution.Graded++
+		total += response.score
+
+		bin := int(response.score / binWidth)
+		if bin >= scoreBinCount {
+			bin = scoreBinCount - 1
+		}
+		if bin < 0 {
+			bin = 0
+		}
+		distribution.Bins[bin].Count++
+	}
+
+	if distribution.Graded > 0 {
+		distribution.Mean = total / float64(distribution.Graded)
+	}
+
+	return distribution
+}
+
+// writeItemAnalysisCSV writes the statistics of every question of an item analysis as CSV, one question per line.
+// Distractors are written as "a:3;b:5", in alphabetical order, and empty indexes are left blank.
+func writeItemAnalysisCSV(w io.Writer, analysis ItemAnalysis) error {
+	writer := csv.NewWriter(w)
+
+	writer.Write([]string{"questionNumber", "questionType", "responses", "omissions", "omissionRate", "facility",
+		"discrimination", "distractors"})
+
+	for _, question := range analysis.Questions {
+		writer.Write([]string{
+			question.QuestionNumber,
+			question.QuestionType,
+			strconv.Itoa(question.Responses),
+			strconv.Itoa(question.Omissions),
+			formatStatistic(&question.OmissionRate),
+			formatStatistic(question.Facility),
+			formatStatistic(question.Discrimination),
+			formatDistractors(question.Distractors),
+		})
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// writeScoreDistributionCSV writes the score distribution of an item analysis as CSV, one bin per line.
+func writeScoreDistributionCSV(w io.Writer, analysis ItemAnalysis) error {
+	writer := csv.NewWriter(w)
+
+	writer.Write([]string{"from", "to", "count"})
+
+	for _, bin := range analysis.ScoreDistribution.Bins {
+		writer.Write([]string{formatStatistic(&bin.From), formatStatistic(&bin.To), strconv.Itoa(bin.Count)})
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// formatStatistic writes a statistic with three decimals, or as an empty string if it wasn't computed.
+func formatStatistic(value *float64) string {
+	if value == nil {
+		return ""
+	}
+
+	return fmt.Sprintf("%.3f", *value)
+}
+
+// formatDistractors writes the distractor counts of a question as "a:3;b:5", in alphabetical order.
+func formatDistractors(distractors map[string]int) string {
+	var letters []string
+	for letter := range distractors {
+		letters = append(letters, letter)
+	}
+	sort.Strings(letters)
+
+	var counts []string
+	for _, letter := range letters {
+		counts = append(counts, letter+":"+strconv.Itoa(distractors[letter]))
+	}
+
+	return strings.Join(counts, ";")
+}
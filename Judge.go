@@ -0,0 +1,291 @@
+/*
+ * This file is part of VianuEdu.
+ *
+ *  VianuEdu is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ *  VianuEdu is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with VianuEdu.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * Developed by Matei Gardus <matei@gardus.eu>
+ */
+
+package vianueduserver
+
+import (
+	"bytes"
+	"github.com/buger/jsonparser"
+	"github.com/sirupsen/logrus"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// codeAnswerPrefix marks the answers given to programming questions in AnswerSheet objects. It is followed by the
+// language of the program on the same line and by the program itself on the next lines, i.e.
+// "[CODE_ANSWER] python\nprint(sum(map(int, input().split())))".
+const codeAnswerPrefix = "[CODE_ANSWER]"
+
+// The limits programs run under. Programming questions may set their own time limit ("timeLimit", in milliseconds)
+// and memory limit ("memoryLimit", in megabytes), up to the maximum limits.
+const (
+	defaultTimeLimit   = 1000
+	defaultMemoryLimit = 256
+	maximumTimeLimit   = 10000
+	maximumMemoryLimit = 1024
+	compileTimeLimit   = 30 * time.Second
+	maximumOutputSize  = 1 << 20
+	maximumErrorSize   = 4096
+)
+
+// The verdicts a program can get on a single test case.
+const (
+	verdictAccepted     = "accepted"
+	verdictWrongAnswer  = "wrongAnswer"
+	verdictTimeLimit    = "timeLimitExceeded"
+	verdictRuntimeError = "runtimeError"
+)
+
+// judgeSourceFiles lists the languages programming questions can be answered in, along with the file their programs
+// are saved as before being compiled or run.
+var judgeSourceFiles = map[string]string{
+	"cpp":    "main.cpp",
+	"python": "main.py",
+}
+
+// judgeCommands and judgeSandbox are the commands programs are compiled or run with, by language, and the sandbox they
+// run in (see GetJudgeCommands and GetJudgeSandbox). judgeSlots holds a slot for every program the judge is running, so
+// that no more than the configured number of programs (see GetJudgeWorkers) run at the same time. They are read from
+// the configuration files when the server boots.
+var (
+	judgeCommands map[string]string
+	judgeSandbox  []string
+	judgeSlots    chan struct{}
+)
+
+// A JudgeResult is the outcome of running the answer to a programming question against the test cases of the question.
+// Error explains why the program couldn't be run at all, and CompileError why it couldn't be compiled.
+type JudgeResult struct {
+	Language     string       `json:"language"`
+	Error        string       `json:"error,omitempty"`
+	CompileError string       `json:"compileError,omitempty"`
+	Passed       int          `json:"passed"`
+	Total        int          `json:"total"`
+	Cases        []CaseResult `json:"cases"`
+}
+
+// A CaseResult is the verdict a program got on a single test case, along with how long it ran for, in milliseconds.
+type CaseResult struct {
+	Verdict string `json:"verdict"`
+	Time    int64  `json:"time"`
+}
+
+// A testCase is the input given to a program and the output expected from it.
+type testCase struct {
+	input  string
+	output string
+}
+
+// limitedBuffer keeps the first bytes written to it, up to its limit, and quietly throws away the rest, so that a
+// program can't fill the memory of the server with its output.
+type limitedBuffer struct {
+	buffer bytes.Buffer
+	limit  int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.buffer.Len(); room > 0 {
+		if len(p) > room {
+			b.buffer.Write(p[:room])
+		} else {
+			b.buffer.Write(p)
+		}
+	}
+
+	return len(p), nil
+}
+
+// isProgrammingQuestion checks whether a question of a Test object is a programming question, answered with a program
+// that is judged against the test cases of the question.
+func isProgrammingQuestion(question []byte) bool {
+	questionType, _ := jsonparser.GetString(question, "questionType")
+
+	return questionType == "programming"
+}
+
+// parseCodeAnswer splits the answer to a programming question into the language it was written in and the program.
+func parseCodeAnswer(answer string) (string, string) {
+	answer = strings.TrimPrefix(strings.TrimLeft(answer, " \t\r\n"), codeAnswerPrefix)
+
+	language, program := answer, ""
+	if index := strings.Index(answer, "\n"); index >= 0 {
+		language, program = answer[:index], answer[index+1:]
+	}
+
+	return strings.ToLower(strings.TrimSpace(language)), program
+}
+
+// getQuestionLanguages returns the languages a programming question may be answered in, which are all the languages
+// the judge supports unless the question lists its own ("languages").
+func getQuestionLanguages(question []byte) []string {
+	var languages []string
+
+	jsonparser.ArrayEach(question, func(language []byte, dataType jsonparser.ValueType, offset int, err error) {
+		languages = append(languages, string(language))
+	}, "languages")
+
+	if len(languages) == 0 {
+		for language := range judgeSourceFiles {
+			languages = append(languages, language)
+		}
+		sort.Strings(languages)
+	}
+
+	return languages
+}
+
+// getJudgeLimits returns the time limit and the memory limit, in megabytes, programs answering a programming question
+// run under.
+func getJudgeLimits(question []byte) (time.Duration, int64) {
+	timeLimit, err := jsonparser.GetInt(question, "timeLimit")
+	if err != nil || timeLimit <= 0 {
+		timeLimit = defaultTimeLimit
+	}
+
+	memoryLimit, err := jsonparser.GetInt(question, "memoryLimit")
+	if err != nil || memoryLimit <= 0 {
+		memoryLimit = defaultMemoryLimit
+	}
+
+	return time.Duration(timeLimit) * time.Millisecond, memoryLimit
+}
+
+// getTestCases returns the test cases of a programming question ("testCases"), i.e.
+//
+//	"testCases": [{"input": "1 2\n", "output": "3\n"}]
+func getTestCases(question []byte) []testCase {
+	var cases []testCase
+
+	jsonparser.ArrayEach(question, func(value []byte, dataType jsonparser.ValueType, offset int, err error) {
+		input, _ := jsonparser.GetString(value, "input")
+		output, _ := jsonparser.GetString(value, "output")
+		cases = append(cases, testCase{input: input, output: output})
+	}, "testCases")
+
+	return cases
+}
+
+// judgeProgram compiles, if need be, and runs the answer to a programming question against every test case of the
+// question, and returns how many of them it passed.
+//
+// Programs run through the configured sandbox (see GetJudgeSandbox), and aren't judged at all without one. They run in
+// a temporary directory of their own, which is removed once they are judged, with nothing but the PATH of the server in
+// their environment, in a process group of their own that is killed as soon as the time limit runs out, and under
+// limits on CPU time, memory and the size of the files they write. Only the configured number of programs run at the
+// same time.
+func judgeProgram(question []byte, answer string) JudgeResult {
+	language, program := parseCodeAnswer(answer)
+
+	result := JudgeResult{Language: language, Cases: []CaseResult{}}
+
+	cases := getTestCases(question)
+	result.Total = len(cases)
+
+	allowed := false
+	for _, questionLanguage := range getQuestionLanguages(question) {
+		if questionLanguage == language {
+			allowed = true
+		}
+	}
+	command := judgeCommands[language]
+	sourceFile, supported := judgeSourceFiles[language]
+	if !allowed || !supported || command == "" {
+		result.Error = "Programs can't be written in " + strconv.Quote(language) + " for this question!"
+		return result
+	}
+
+	if !judgeAvailable || len(judgeSandbox) == 0 {
+		result.Error = "This server can't judge programs!"
+		return result
+	}
+
+	judgeSlots <- struct{}{}
+	defer func() { <-judgeSlots }()
+
+	directory, err := ioutil.TempDir("", "vianuedu-judge-")
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Warn("Cannot create directory for judging program!")
+		result.Error = "The program could not be judged!"
+		return result
+	}
+	defer os.RemoveAll(directory)
+
+	err = ioutil.WriteFile(filepath.Join(directory, sourceFile), []byte(program), 0600)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Warn("Cannot save program for judging!")
+		result.Error = "The program could not be judged!"
+		return result
+	}
+
+	var run []string
+	switch language {
+	case "cpp":
+		output, verdict, _ := runSandboxed(directory, []string{command, "-O2", "-std=c++17", "-o", "main", sourceFile}, "",
+			compileTimeLimit, 0)
+		if verdict != verdictAccepted {
+			if len(output) > maximumErrorSize {
+				output = output[:maximumErrorSize]
+			}
+			if strings.TrimSpace(output) == "" {
+				output = "The program could not be compiled!"
+			}
+			result.CompileError = output
+			return result
+		}
+		run = []string{"./main"}
+	case "python":
+		run = []string{command, sourceFile}
+	}
+
+	timeLimit, memoryLimit := getJudgeLimits(question)
+
+	for _, currentCase := range cases {
+		output, verdict, elapsed := runSandboxed(directory, run, currentCase.input, timeLimit, memoryLimit)
+		if verdict == verdictAccepted && normalizeOutput(output) != normalizeOutput(currentCase.output) {
+			verdict = verdictWrongAnswer
+		}
+		if verdict == verdictAccepted {
+			result.Passed++
+		}
+
+		result.Cases = append(result.Cases, CaseResult{Verdict: verdict, Time: int64(elapsed / time.Millisecond)})
+	}
+
+	return result
+}
+
+// normalizeOutput strips the trailing whitespace off every line of the output of a program, along with any trailing
+// empty lines, so that programs aren't failed over a missing newline.
+func normalizeOutput(output string) string {
+	lines := strings.Split(strings.Replace(output, "\r\n", "\n", -1), "\n")
+	for index, line := range lines {
+		lines[index] = strings.TrimRight(line, " \t\r")
+	}
+
+	return strings.TrimRight(strings.Join(lines, "\n"), "\n")
+}
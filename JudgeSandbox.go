@@ -0,0 +1,96 @@
+//go:build !windows
+// +build !windows
+
+/*
+ * This file is part of VianuEdu.
+ *
+ *  VianuEdu is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ *  VianuEdu is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with VianuEdu.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * Developed by Matei Gardus <matei@gardus.eu>
+ */
+
+package vianueduserver
+
+import (
+	"github.com/sirupsen/logrus"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// judgeAvailable tells whether programs can be judged on this server, which takes process groups and resource limits.
+const judgeAvailable = true
+
+// runSandboxed runs a command through the configured sandbox (see judgeSandbox) in the provided directory, with the
+// provided input, and returns everything it wrote along with its verdict and how long it ran for. A memory limit of 0
+// leaves the memory of the command unlimited.
+//
+// The verdict is only ever accepted, runtime error or time limit exceeded, since the output isn't checked.
+func runSandboxed(directory string, command []string, input string, timeLimit time.Duration, memoryLimit int64) (string,
+	string, time.Duration) {
+	limits := "ulimit -t " + strconv.Itoa(int(timeLimit/time.Second)+1) + " && ulimit -f 4096"
+	if memoryLimit > 0 {
+		limits += " && ulimit -v " + strconv.FormatInt(memoryLimit*1024, 10)
+	}
+
+	arguments := []string{"-c", limits + ` && exec "$@"`, "judge"}
+	for _, argument := range judgeSandbox {
+		arguments = append(arguments, strings.Replace(argument, "{directory}", directory, -1))
+	}
+
+	process := exec.Command("sh", append(arguments, command...)...)
+	process.Dir = directory
+	process.Env = []string{"PATH=" + os.Getenv("PATH"), "HOME=" + directory, "TMPDIR=" + directory}
+	process.Stdin = strings.NewReader(input)
+	output := &limitedBuffer{limit: maximumOutputSize}
+	process.Stdout = output
+	process.Stderr = output
+	process.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	start := time.Now()
+	if err := process.Start(); err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Warn("Cannot start program for judging!")
+		return "", verdictRuntimeError, 0
+	}
+
+	// the whole process group goes down, along with anything the program started
+	var timedOut int32
+	timer := time.AfterFunc(timeLimit, func() {
+		atomic.StoreInt32(&timedOut, 1)
+		syscall.Kill(-process.Process.Pid, syscall.SIGKILL)
+	})
+	err := process.Wait()
+	timer.Stop()
+	elapsed := time.Since(start)
+	syscall.Kill(-process.Process.Pid, syscall.SIGKILL)
+
+	if atomic.LoadInt32(&timedOut) == 1 {
+		return output.buffer.String(), verdictTimeLimit, elapsed
+	}
+	if err != nil {
+		if status, ok := process.ProcessState.Sys().(syscall.WaitStatus); ok && status.Signaled() &&
+			(status.Signal() == syscall.SIGXCPU || status.Signal() == syscall.SIGKILL) {
+			return output.buffer.String(), verdictTimeLimit, elapsed
+		}
+		return output.buffer.String(), verdictRuntimeError, elapsed
+	}
+
+	return output.buffer.String(), verdictAccepted, elapsed
+}
@@ -0,0 +1,37 @@
+//go:build windows
+// +build windows
+
+/*
+ * This file is part of VianuEdu.
+ *
+ *  VianuEdu is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ *  VianuEdu is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with VianuEdu.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * Developed by Matei Gardus <matei@gardus.eu>
+ */
+
+package vianueduserver
+
+import (
+	"time"
+)
+
+// judgeAvailable tells whether programs can be judged on this server. Windows has neither the process groups nor the
+// resource limits the judge relies on, so programming questions are left for the teacher there.
+const judgeAvailable = false
+
+// runSandboxed never runs anything on Windows, see judgeAvailable.
+func runSandboxed(directory string, command []string, input string, timeLimit time.Duration, memoryLimit int64) (string,
+	string, time.Duration) {
+	return "", verdictRuntimeError, 0
+}
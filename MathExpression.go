@@ -0,0 +1,505 @@
+/*
+ * This file is part of VianuEdu.
+ *
+ *  VianuEdu is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ *  VianuEdu is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with VianuEdu.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * Developed by Matei Gardus <matei@gardus.eu>
+ */
+
+package vianueduserver
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// expressionSamples is the number of points two expressions are evaluated at to check whether they are equivalent.
+const expressionSamples = 24
+
+// expressionMinimumSamples is the number of points, out of expressionSamples, at which both expressions must be
+// defined for them to be compared at all.
+const expressionMinimumSamples = 6
+
+// defaultExpressionTolerance is the relative difference allowed between the values of two equivalent expressions.
+const defaultExpressionTolerance = 1e-7
+
+// maxExpressionLength and maxExpressionDepth are the longest expression, in characters, and the deepest nesting of
+// brackets, signs, powers and functions that are parsed at all, so that no answer can exhaust the stack of the server.
+const (
+	maxExpressionLength = 1000
+	maxExpressionDepth  = 100
+)
+
+// expressionFunctions lists the functions mathematical expressions may use, by name.
+var expressionFunctions = map[string]func(float64) float64{
+	"sin":    math.Sin,
+	"cos":    math.Cos,
+	"tan":    math.Tan,
+	"tg":     math.Tan,
+	"cot":    func(x float64) float64 { return 1 / math.Tan(x) },
+	"ctg":    func(x float64) float64 { return 1 / math.Tan(x) },
+	"arcsin": math.Asin,
+	"arccos": math.Acos,
+	"arctan": math.Atan,
+	"arctg":  math.Atan,
+	"sqrt":   math.Sqrt,
+	"ln":     math.Log,
+	"lg":     math.Log10,
+	"log":    math.Log10,
+	"exp":    math.Exp,
+	"abs":    math.Abs,
+}
+
+// expressionConstants lists the constants mathematical expressions may use, by name.
+var expressionConstants = map[string]float64{
+	"pi": math.Pi,
+	"π":  math.Pi,
+	"e":  math.E,
+}
+
+// expressionNames lists the names of every function and constant, longest first, so that a run of letters such as
+// "xsin" is read as "x" followed by "sin".
+var expressionNames = func() []string {
+	var names []string
+	for name := range expressionFunctions {
+		names = append(names, name)
+	}
+	for name := range expressionConstants {
+		names = append(names, name)
+	}
+
+	sort.Slice(names, func(i, j int) bool {
+		if len(names[i]) != len(names[j]) {
+			return len(names[i]) > len(names[j])
+		}
+		return names[i] < names[j]
+	})
+
+	return names
+}()
+
+// A mathExpression is a parsed mathematical expression, which can be evaluated for given values of its variables.
+type mathExpression struct {
+	evaluate  func(values map[string]float64) float64
+	variables map[string]bool
+}
+
+// An expressionToken is a single token of a mathematical expression: a number, a name or an operator.
+type expressionToken struct {
+	kind  byte
+	text  string
+	value float64
+}
+
+// The kinds of tokens of a mathematical expression. Operators and brackets are their own kind.
+const (
+	tokenNumber   = 'n'
+	tokenVariable = 'v'
+	tokenFunction = 'f'
+	tokenConstant = 'c'
+	tokenEnd      = 0
+)
+
+// parseExpression parses a mathematical expression as students write it, i.e. "2(x+1)", "x^2 - 3x + 2" or
+// "sqrt(2)/2".
+//
+// Multiplication may be implicit, "^" (or "**") raises to a power, ":" divides, "|x|" is the absolute value of x and
+// decimals may be written with a comma. Variables are single letters, so "xy" is x times y. The functions in
+// expressionFunctions and the constants in expressionConstants may be used as well.
+//
+// Expressions longer than maxExpressionLength, or nested deeper than maxExpressionDepth, are refused.
+func parseExpression(text string) (mathExpression, error) {
+	if utf8.RuneCountInString(text) > maxExpressionLength {
+		return mathExpression{}, errors.New("expression too long")
+	}
+
+	tokens, err := tokenizeExpression(text)
+	if err != nil {
+		return mathExpression{}, err
+	}
+
+	parser := expressionParser{tokens: tokens, variables: map[string]bool{}}
+
+	evaluate, err := parser.parseSum()
+	if err != nil {
+		return mathExpression{}, err
+	}
+	if parser.peek().kind != tokenEnd {
+		return mathExpression{}, errors.New("unexpected " + parser.peek().text)
+	}
+
+	return mathExpression{evaluate: evaluate, variables: parser.variables}, nil
+}
+
+// tokenizeExpression splits a mathematical expression into tokens.
+func tokenizeExpression(text string) ([]expressionToken, error) {
+	var tokens []expressionToken
+
+	replacer := strings.NewReplacer("**", "^", "·", "*", "×", "*", "÷", "/", ":", "/", "−", "-", "[", "(", "]", ")",
+		"{", "(", "}", ")")
+	runes := []rune(replacer.Replace(strings.ToLower(text)))
+
+	for index := 0; index < len(runes); {
+		current := runes[index]
+
+		switch {
+		case unicode.IsSpace(current):
+			index++
+		case unicode.IsDigit(current) || current == '.' ||
+			(current == ',' && index+1 < len(runes) && unicode.IsDigit(runes[index+1])):
+			start := index
+			for index < len(runes) && (unicode.IsDigit(runes[index]) || runes[index] == '.' ||
+				(runes[index] == ',' && index+1 < len(runes) && unicode.IsDigit(runes[index+1]))) {
+				index++
+			}
+			number := strings.Replace(string(runes[start:index]), ",", ".", -1)
+			value, err := strconv.ParseFloat(number, 64)
+			if err != nil {
+				return nil, errors.New("invalid number " + number)
+			}
+			tokens = append(tokens, expressionToken{kind: tokenNumber, text: number, value: value})
+		case unicode.IsLetter(current):
+			start := index
+			for index < len(runes) && unicode.IsLetter(runes[index]) {
+				index++
+			}
+			tokens = append(tokens, splitExpressionNames(string(runes[start:index]))...)
+		case strings.ContainsRune("+-*/^()|", current):
+			tokens = append(tokens, expressionToken{kind: byte(current), text: string(current)})
+			index++
+		default:
+			return nil, errors.New("unexpected " + string(current))
+		}
+	}
+
+	return append(tokens, expressionToken{kind: tokenEnd, text: "end of expression"}), nil
+}
+
+// splitExpressionNames splits a run of letters into functions, constants and single-letter variables.
+func splitExpressionNames(letters string) []expressionToken {
+	var tokens []expressionToken
+
+	for letters != "" {
+		matched := false
+		for _, name := range expressionNames {
+			if !strings.HasPrefix(letters, name) {
+				continue
+			}
+
+			if _, ok := expressionFunctions[name]; ok {
+				tokens = append(tokens, expressionToken{kind: tokenFunction, text: name})
+			} else {
+				tokens = append(tokens, expressionToken{kind: tokenConstant, text: name, value: expressionConstants[name]})
+			}
+			letters = letters[len(name):]
+			matched = true
+			break
+		}
+
+		if !matched {
+			variable := []rune(letters)[0]
+			tokens = append(tokens, expressionToken{kind: tokenVariable, text: string(variable)})
+			letters = letters[len(string(variable)):]
+		}
+	}
+
+	return tokens
+}
+
+// An expressionParser parses the tokens of a mathematical expression by recursive descent, turning them into a function
+// that evaluates the expression.
+type expressionParser struct {
+	tokens    []expressionToken
+	position  int
+	variables map[string]bool
+	inAbs     bool
+	depth     int
+}
+
+// peek returns the current token without consuming it.
+func (parser *expressionParser) peek() expressionToken {
+	return parser.tokens[parser.position]
+}
+
+// next consumes the current token and returns it.
+func (parser *expressionParser) next() expressionToken {
+	token := parser.tokens[parser.position]
+	if token.kind != tokenEnd {
+		parser.position++
+	}
+
+	return token
+}
+
+// parseSum parses terms added to or subtracted from one another.
+func (parser *expressionParser) parseSum() (func(map[string]float64) float64, error) {
+	left, err := parser.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+
+	for parser.peek().kind == '+' || parser.peek().kind == '-' {
+		operator := parser.next().kind
+
+		right, err := parser.parseProduct()
+		if err != nil {
+			return nil, err
+		}
+
+		first, second := left, right
+		if operator == '+' {
+			left = func(values map[string]float64) float64 { return first(values) + second(values) }
+		} else {
+			left = func(values map[string]float64) float64 { return first(values) - second(values) }
+		}
+	}
+
+	return left, nil
+}
+
+// parseProduct parses factors multiplied or divided by one another, multiplication being implicit between a factor
+// and a number, name or bracket that follows it.
+func (parser *expressionParser) parseProduct() (func(map[string]float64) float64, error) {
+	left, err := parser.parseSigned()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		operator := parser.peek().kind
+
+		switch {
+		case operator == '*' || operator == '/':
+			parser.next()
+		case operator == tokenNumber || operator == tokenVariable || operator == tokenFunction ||
+			operator == tokenConstant || operator == '(' || (operator == '|' && !parser.inAbs):
+			operator = '*'
+		default:
+			return left, nil
+		}
+
+		right, err := parser.parseSigned()
+		if err != nil {
+			return nil, err
+		}
+
+		first, second := left, right
+		if operator == '*' {
+			left = func(values map[string]float64) float64 { return first(values) * second(values) }
+		} else {
+			left = func(values map[string]float64) float64 { return first(values) / second(values) }
+		}
+	}
+}
+
+// enter goes one level deeper into the expression being parsed, and fails past maxExpressionDepth. Every call must be
+// followed by a call to leave.
+func (parser *expressionParser) enter() error {
+	parser.depth++
+	if parser.depth > maxExpressionDepth {
+		return errors.New("expression nested too deeply")
+	}
+
+	return nil
+}
+
+// leave goes back up one level of the expression being parsed.
+func (parser *expressionParser) leave() {
+	parser.depth--
+}
+
+// parseSigned parses a factor preceded by any number of signs, so that "-x^2" is the opposite of x squared.
+func (parser *expressionParser) parseSigned() (func(map[string]float64) float64, error) {
+	defer parser.leave()
+	if err := parser.enter(); err != nil {
+		return nil, err
+	}
+
+	switch parser.peek().kind {
+	case '-':
+		parser.next()
+		operand, err := parser.parseSigned()
+		if err != nil {
+			return nil, err
+		}
+		return func(values map[string]float64) float64 { return -operand(values) }, nil
+	case '+':
+		parser.next()
+		return parser.parseSigned()
+	}
+
+	return parser.parsePower()
+}
+
+// parsePower parses a factor raised to a power. Powers are right-associative, so "2^3^2" is 2 to the 9th.
+func (parser *expressionParser) parsePower() (func(map[string]float64) float64, error) {
+	base, err := parser.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	if parser.peek().kind != '^' {
+		return base, nil
+	}
+	parser.next()
+
+	exponent, err := parser.parseSigned()
+	if err != nil {
+		return nil, err
+	}
+
+	return func(values map[string]float64) float64 { return math.Pow(base(values), exponent(values)) }, nil
+}
+
+// parsePrimary parses a number, a constant, a variable, a function applied to its argument, a bracketed expression or
+// an absolute value.
+func (parser *expressionParser) parsePrimary() (func(map[string]float64) float64, error) {
+	defer parser.leave()
+	if err := parser.enter(); err != nil {
+		return nil, err
+	}
+
+	token := parser.next()
+
+	switch token.kind {
+	case tokenNumber, tokenConstant:
+		value := token.value
+		return func(map[string]float64) float64 { return value }, nil
+	case tokenVariable:
+		name := token.text
+		parser.variables[name] = true
+		return func(values map[string]float64) float64 { return values[name] }, nil
+	case tokenFunction:
+		// a bracketed argument ends with its bracket, so that "sin(x)^2" is the square of sin(x), while "sin x^2" is
+		// the sine of x squared
+		function := expressionFunctions[token.text]
+		var argument func(map[string]float64) float64
+		var err error
+		if parser.peek().kind == '(' {
+			parser.next()
+			argument, err = parser.parseBracketed(')')
+		} else {
+			argument, err = parser.parsePower()
+		}
+		if err != nil {
+			return nil, err
+		}
+		return func(values map[string]float64) float64 { return function(argument(values)) }, nil
+	case '(':
+		inner, err := parser.parseBracketed(')')
+		if err != nil {
+			return nil, err
+		}
+		return inner, nil
+	case '|':
+		inner, err := parser.parseBracketed('|')
+		if err != nil {
+			return nil, err
+		}
+		return func(values map[string]float64) float64 { return math.Abs(inner(values)) }, nil
+	}
+
+	return nil, errors.New("unexpected " + token.text)
+}
+
+// parseBracketed parses an expression up to the provided closing bracket.
+func (parser *expressionParser) parseBracketed(closing byte) (func(map[string]float64) float64, error) {
+	inAbs := parser.inAbs
+	parser.inAbs = closing == '|'
+
+	inner, err := parser.parseSum()
+
+	parser.inAbs = inAbs
+
+	if err != nil {
+		return nil, err
+	}
+	if parser.next().kind != closing {
+		return nil, errors.New("missing closing " + string(closing))
+	}
+
+	return inner, nil
+}
+
+// expressionsEquivalent checks whether a student's answer is equivalent to the answer key of an expression question,
+// so that "2(x+1)" matches "2x+2".
+//
+// Both expressions are evaluated at the same points, drawn from a fixed seed so that checking an answer twice always
+// gives the same result, and must agree within the provided relative tolerance at each point where both are defined.
+// An error is returned if either expression can't be parsed.
+func expressionsEquivalent(answer, key string, tolerance float64) (bool, error) {
+	keyExpression, err := parseExpression(key)
+	if err != nil {
+		return false, errors.New("invalid answer key: " + err.Error())
+	}
+	answerExpression, err := parseExpression(answer)
+	if err != nil {
+		return false, errors.New("invalid answer: " + err.Error())
+	}
+
+	if tolerance <= 0 {
+		tolerance = defaultExpressionTolerance
+	}
+
+	var variables []string
+	for variable := range keyExpression.variables {
+		variables = append(variables, variable)
+	}
+	for variable := range answerExpression.variables {
+		if !keyExpression.variables[variable] {
+			variables = append(variables, variable)
+		}
+	}
+	sort.Strings(variables)
+
+	random := rand.New(rand.NewSource(1))
+	compared := 0
+
+	for sample := 0; sample < expressionSamples; sample++ {
+		values := map[string]float64{}
+		for _, variable := range variables {
+			// half of the points are small positive values, where roots and logarithms are defined
+			if sample%2 == 0 {
+				values[variable] = 0.1 + random.Float64()*2.9
+			} else {
+				values[variable] = -5 + random.Float64()*10
+			}
+		}
+
+		expected := keyExpression.evaluate(values)
+		actual := answerExpression.evaluate(values)
+
+		if math.IsNaN(expected) || math.IsInf(expected, 0) || math.IsNaN(actual) || math.IsInf(actual, 0) {
+			continue
+		}
+
+		scale := math.Max(1, math.Max(math.Abs(expected), math.Abs(actual)))
+		if math.Abs(expected-actual) > tolerance*scale {
+			return false, nil
+		}
+
+		compared++
+		if len(variables) == 0 {
+			return true, nil
+		}
+	}
+
+	return compared >= expressionMinimumSamples, nil
+}
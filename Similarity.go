@@ -0,0 +1,275 @@
+/*
+ * This file is part of VianuEdu.
+ *
+ *  VianuEdu is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ *  VianuEdu is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with VianuEdu.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * Developed by Matei Gardus <matei@gardus.eu>
+ */
+
+package vianueduserver
+
+import (
+	"github.com/buger/jsonparser"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// similarityShingleSize is the number of consecutive words that make up a shingle. Answers are compared by the
+// shingles they share, so answers shorter than this are never compared.
+const similarityShingleSize = 3
+
+// similarityThreshold is the similarity from which two answers are flagged when no other threshold is asked for. It is
+// read from the configuration files when the server boots.
+var similarityThreshold = 0.6
+
+// A SimilarityReport lists the pairs of students whose free-text answers to a test are suspiciously similar, from the
+// most similar pair to the least.
+type SimilarityReport struct {
+	TestID    string        `json:"testID"`
+	Threshold float64       `json:"threshold"`
+	Compared  int           `json:"compared"`
+	Pairs     []SimilarPair `json:"pairs"`
+}
+
+// A SimilarPair is a pair of students with at least one suspiciously similar answer. Similarity is the highest
+// similarity among their answers.
+type SimilarPair struct {
+	StudentA   string          `json:"studentA"`
+	StudentB   string          `json:"studentB"`
+	Similarity float64         `json:"similarity"`
+	Answers    []SimilarAnswer `json:"answers"`
+}
+
+// A SimilarAnswer holds two suspiciously similar answers to the same question. The similarity is the Jaccard index of
+// the word shingles of the answers, between 0 and 1. Overlaps lists the passages both answers share, which are also
+// highlighted between "[[" and "]]" in both answers.
+type SimilarAnswer struct {
+	QuestionNumber string   `json:"questionNumber"`
+	Similarity     float64  `json:"similarity"`
+	Overlaps       []string `json:"overlaps"`
+	HighlightedA   string   `json:"highlightedA"`
+	HighlightedB   string   `json:"highlightedB"`
+}
+
+// A similarityAnswerSheet holds the words of every free-text answer of a student on a test.
+type similarityAnswerSheet struct {
+	studentID string
+	answers   map[string][]string
+}
+
+// findSimilarAnswers compares the free-text answers of every pair of students who submitted an answer sheet for a
+// test, graded or not, and reports the pairs whose answers to at least one question are at least as similar as the
+// threshold. Answers to multiple-choice questions aren't compared, and neither are the attempts of a single student.
+func findSimilarAnswers(testID string, threshold float64) SimilarityReport {
+	answerSheets := collectSimilarityAnswerSheets(testID)
+
+	report := SimilarityReport{
+		TestID:    testID,
+		Threshold: threshold,
+		Compared:  len(answerSheets),
+		Pairs:     []SimilarPair{},
+	}
+
+	// students with several attempts are only compared with other students, and only their most similar answer sheets
+	// are reported
+	pairIndexes := map[[2]string]int{}
+
+	for i := 0; i < len(answerSheets); i++ {
+		for j := i + 1; j < len(answerSheets); j++ {
+			if answerSheets[i].studentID == answerSheets[j].studentID {
+				continue
+			}
+
+			pair, similar := compareAnswerSheets(answerSheets[i], answerSheets[j], threshold)
+			if !similar {
+				continue
+			}
+
+			students := [2]string{pair.StudentA, pair.StudentB}
+			if students[1] < students[0] {
+				students = [2]string{pair.StudentB, pair.StudentA}
+			}
+
+			if index, ok := pairIndexes[students]; !ok {
+				pairIndexes[students] = len(report.Pairs)
+				report.Pairs = append(report.Pairs, pair)
+			} else if pair.Similarity > report.Pairs[index].Similarity {
+				report.Pairs[index] = pair
+			}
+		}
+	}
+
+	sort.SliceStable(report.Pairs, func(i, j int) bool {
+		return report.Pairs[i].Similarity > report.Pairs[j].Similarity
+	})
+
+	return report
+}
+
+// collectSimilarityAnswerSheets gathers the free-text answers of every answer sheet of a test, be it graded or still
+// waiting to be graded.
+func collectSimilarityAnswerSheets(testID string) []similarityAnswerSheet {
+	var answerSheets []similarityAnswerSheet
+
+	addAnswerSheet := func(answerSheet []byte) {
+		studentUser, _ := jsonparser.GetString(answerSheet, "student", "account", "userName")
+		studentPass, _ := jsonparser.GetString(answerSheet, "student", "account", "password")
+
+		sheet := similarityAnswerSheet{studentID: FindStudentID(studentUser, studentPass), answers: map[string][]string{}}
+
+		jsonparser.ObjectEach(answerSheet, func(key []byte, value []byte, dataType jsonparser.ValueType, offset int) error {
+			answer, err := jsonparser.ParseString(value)
+			if err != nil || strings.HasPrefix(strings.TrimSpace(answer), multipleAnswerPrefix) {
+				return nil
+			}
+			sheet.answers[string(key)] = tokenizeAnswer(answer)
+			return nil
+		}, "answers")
+
+		answerSheets = append(answerSheets, sheet)
+	}
+
+	if grades := ListGradesForTest(testID); grades != "notFound" {
+		jsonparser.ArrayEach([]byte(grades), func(grade []byte, dataType jsonparser.ValueType, offset int, err error) {
+			answerSheet, _, _, _ := jsonparser.Get(grade, "studentAnswerSheet")
+			addAnswerSheet(answerSheet)
+		})
+	}
+
+	if ungraded := ListAnswerSheetsForTest(testID); ungraded != "notFound" {
+		jsonparser.ArrayEach([]byte(ungraded), func(answerSheet []byte, dataType jsonparser.ValueType, offset int, err error) {
+			addAnswerSheet(answerSheet)
+		})
+	}
+
+	return answerSheets
+}
+
+// compareAnswerSheets compares the answers two students gave to the same questions. The method returns false if none
+// of them are at least as similar as the threshold.
+func compareAnswerSheets(first, second similarityAnswerSheet, threshold float64) (SimilarPair, bool) {
+	pair := SimilarPair{StudentA: first.studentID, StudentB: second.studentID}
+
+	var questionNumbers []string
+	for questionNumber := range first.answers {
+		questionNumbers = append(questionNumbers, questionNumber)
+	}
+	sort.Strings(questionNumbers)
+
+	for _, questionNumber := range questionNumbers {
+		secondWords, ok := second.answers[questionNumber]
+		if !ok {
+			continue
+		}
+
+		answer, similar := compareAnswers(first.answers[questionNumber], secondWords, threshold)
+		if !similar {
+			continue
+		}
+
+		answer.QuestionNumber = questionNumber
+		pair.Answers = append(pair.Answers, answer)
+
+		if answer.Similarity > pair.Similarity {
+			pair.Similarity = answer.Similarity
+		}
+	}
+
+	return pair, len(pair.Answers) > 0
+}
+
+// compareAnswers computes the similarity of two answers and highlights the passages they share. The method returns
+// false if the answers are less similar than the threshold, or too short to be compared.
+func compareAnswers(first, second []string, threshold float64) (SimilarAnswer, bool) {
+	firstShingles := shingleAnswer(first)
+	secondShingles := shingleAnswer(second)
+
+	if len(firstShingles) == 0 || len(secondShingles) == 0 {
+		return SimilarAnswer{}, false
+	}
+
+	shared := map[string]bool{}
+	for shingle := range firstShingles {
+		if secondShingles[shingle] {
+			shared[shingle] = true
+		}
+	}
+
+	similarity := float64(len(shared)) / float64(len(firstShingles)+len(secondShingles)-len(shared))
+	if similarity < threshold || len(shared) == 0 {
+		return SimilarAnswer{}, false
+	}
+
+	answer := SimilarAnswer{Similarity: similarity}
+	answer.HighlightedA, answer.Overlaps = highlightOverlaps(first, shared)
+	answer.HighlightedB, _ = highlightOverlaps(second, shared)
+
+	return answer, true
+}
+
+// tokenizeAnswer splits an answer into lowercase words, leaving out punctuation.
+func tokenizeAnswer(answer string) []string {
+	return strings.FieldsFunc(strings.ToLower(answer), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// shingleAnswer returns the set of shingles of an answer, each shingle being similarityShingleSize consecutive words.
+func shingleAnswer(words []string) map[string]bool {
+	shingles := map[string]bool{}
+
+	for i := 0; i+similarityShingleSize <= len(words); i++ {
+		shingles[strings.Join(words[i:i+similarityShingleSize], " ")] = true
+	}
+
+	return shingles
+}
+
+// highlightOverlaps writes an answer back from its words, with the passages made of shared shingles between "[[" and
+// "]]", and returns it along with the passages themselves.
+func highlightOverlaps(words []string, shared map[string]bool) (string, []string) {
+	marked := make([]bool, len(words))
+
+	for i := 0; i+similarityShingleSize <= len(words); i++ {
+		if shared[strings.Join(words[i:i+similarityShingleSize], " ")] {
+			for j := i; j < i+similarityShingleSize; j++ {
+				marked[j] = true
+			}
+		}
+	}
+
+	var highlighted []string
+	var overlaps []string
+	var passage []string
+
+	for i, word := range words {
+		if marked[i] {
+			passage = append(passage, word)
+			continue
+		}
+		if len(passage) > 0 {
+			highlighted = append(highlighted, "[["+strings.Join(passage, " ")+"]]")
+			overlaps = append(overlaps, strings.Join(passage, " "))
+			passage = nil
+		}
+		highlighted = append(highlighted, word)
+	}
+	if len(passage) > 0 {
+		highlighted = append(highlighted, "[["+strings.Join(passage, " ")+"]]")
+		overlaps = append(overlaps, strings.Join(passage, " "))
+	}
+
+	return strings.Join(highlighted, " "), overlaps
+}
@@ -0,0 +1,301 @@
+/*
+ * This file is part of VianuEdu.
+ *
+ *  VianuEdu is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ *  VianuEdu is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with VianuEdu.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * Developed by Matei Gardus <matei@gardus.eu>
+ */
+
+package vianueduserver
+
+import (
+	"encoding/json"
+	"github.com/buger/jsonparser"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+// legacyTestTimeLayout is the layout in which the start and end times of a test used to be written, before they were
+// stored as dates. It is only used for migrating old tests.
+const legacyTestTimeLayout = "Jan 2, 2006 3:04:05 PM"
+
+// testTimeFields lists the fields of Test and TestOverride objects that hold a time.
+var testTimeFields = []string{"startTime", "endTime"}
+
+// schoolTimezone is the timezone of the school, in which all test times are presented. It is read from the
+// configuration files when the server boots.
+var schoolTimezone = time.UTC
+
+// submissionGracePeriod and lateSubmissionPolicy decide what happens to answer sheets submitted after the time for a
+// test has run out (see checkSubmissionTime). They are read from the configuration files when the server boots.
+var (
+	submissionGracePeriod time.Duration
+	lateSubmissionPolicy  = "reject"
+)
+
+// The possible outcomes of checkSubmissionTime.
+const (
+	submissionOnTime = iota
+	submissionLate
+	submissionTooLate
+	submissionTooEarly
+	submissionNotOpened
+	submissionInvalidTiming
+)
+
+// parseTestTime parses a start or end time of a test, as written in a Test object. Test times are RFC 3339 timestamps,
+// i.e. "2049-02-21T10:30:00+02:00".
+func parseTestTime(value string) (time.Time, error) {
+	parsedTime, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return parsedTime, err
+	}
+
+	return parsedTime.In(schoolTimezone), nil
+}
+
+// formatTestTime writes a test time as an RFC 3339 timestamp in the timezone of the school.
+func formatTestTime(value time.Time) string {
+	return value.In(schoolTimezone).Format(time.RFC3339)
+}
+
+// storeTestTimes converts the test times of a Test or TestOverride document into dates, so that they are stored as
+// BSON dates in the database.
+//
+// Times that aren't valid RFC 3339 timestamps are left untouched, so the document must be validated beforehand.
+func storeTestTimes(document map[string]interface{}) {
+	for _, field := range testTimeFields {
+		value, ok := document[field].(string)
+		if !ok {
+			continue
+		}
+
+		parsedTime, err := parseTestTime(value)
+		if err == nil {
+			document[field] = parsedTime
+		}
+	}
+}
+
+// readTestTimes converts the BSON dates of a Test or TestOverride JSON document, as marshalled by the mgo driver, back
+// into RFC 3339 timestamps in the timezone of the school.
+func readTestTimes(document []byte) []byte {
+	for _, field := range testTimeFields {
+		date, err := jsonparser.GetString(document, field, "$date")
+		if err != nil {
+			continue
+		}
+
+		parsedTime, err := time.Parse(time.RFC3339, date)
+		if err != nil {
+			continue
+		}
+
+		value, _ := json.Marshal(formatTestTime(parsedTime))
+		document, _ = jsonparser.Set(document, value, field)
+	}
+
+	return document
+}
+
+// applyTestOverride returns the test as a specific student sees it, with the student's override applied.
+//
+// A make-up window replaces the start and end times of the test, while extra time (in minutes) is added to both the
+// end time and the duration of the test. Students without an override get the test unchanged.
+func applyTestOverride(test []byte, testID, studentID string) []byte {
+	override := GetTestOverride(testID, studentID)
+	if override == "notFound" {
+		return test
+	}
+
+	overrideJSON := []byte(override)
+	result := test
+
+	if startTime, err := jsonparser.GetString(overrideJSON, "startTime"); err == nil {
+		endTime, _ := jsonparser.GetString(overrideJSON, "endTime")
+
+		start, _ := json.Marshal(startTime)
+		end, _ := json.Marshal(endTime)
+
+		result, _ = jsonparser.Set(result, start, "startTime")
+		result, _ = jsonparser.Set(result, end, "endTime")
+	}
+
+	extraTime, _ := jsonparser.GetInt(overrideJSON, "extraTime")
+	if extraTime > 0 {
+		endTime, _ := jsonparser.GetString(result, "endTime")
+		if end, err := parseTestTime(endTime); err == nil {
+			newEnd, _ := json.Marshal(formatTestTime(end.Add(time.Duration(extraTime) * time.Minute)))
+			result, _ = jsonparser.Set(result, newEnd, "endTime")
+		}
+
+		if duration, err := jsonparser.GetInt(result, "duration"); err == nil && duration > 0 {
+			newDuration, _ := json.Marshal(duration + extraTime)
+			result, _ = jsonparser.Set(result, newDuration, "duration")
+		}
+	}
+
+	return result
+}
+
+// getTestWindow returns the moment the first student can start a test and the moment the last student taking it runs
+// out of time, taking into account the overrides of every student on the test.
+func getTestWindow(test []byte, testID string) (time.Time, time.Time, error) {
+	startTime, _ := jsonparser.GetString(test, "startTime")
+	endTime, _ := jsonparser.GetString(test, "endTime")
+
+	firstStart, err := parseTestTime(startTime)
+	if err != nil {
+		return firstStart, firstStart, err
+	}
+	lastEnd, err := parseTestTime(endTime)
+	if err != nil {
+		return firstStart, lastEnd, err
+	}
+
+	for _, studentID := range GetTestOverrideStudentIDs(testID) {
+		studentTest := applyTestOverride(test, testID, studentID)
+
+		startTime, _ = jsonparser.GetString(studentTest, "startTime")
+		endTime, _ = jsonparser.GetString(studentTest, "endTime")
+
+		if start, err := parseTestTime(startTime); err == nil && start.Before(firstStart) {
+			firstStart = start
+		}
+		if end, err := parseTestTime(endTime); err == nil && end.After(lastEnd) {
+			lastEnd = end
+		}
+	}
+
+	return firstStart, lastEnd, nil
+}
+
+// getSubmissionDeadline returns the moment a student's time for a test runs out.
+//
+// This is the end time of the test, unless the test has a "duration" (in minutes) and the student's time ends sooner
+// than that, counted from the moment they opened the test.
+func getSubmissionDeadline(test []byte, openedAt time.Time) (time.Time, error) {
+	endTime, _ := jsonparser.GetString(test, "endTime")
+
+	deadline, err := parseTestTime(endTime)
+	if err != nil {
+		return deadline, err
+	}
+
+	duration, _ := jsonparser.GetInt(test, "duration")
+	if duration > 0 && !openedAt.IsZero() {
+		timeLimit := openedAt.Add(time.Duration(duration) * time.Minute)
+		if timeLimit.Before(deadline) {
+			deadline = timeLimit
+		}
+	}
+
+	return deadline, nil
+}
+
+// checkSubmissionTime checks whether an answer sheet submitted by a student at a specific moment respects the timing
+// of the test.
+//
+// Answer sheets submitted before the test starts are too early. Answer sheets for tests with a duration can only be
+// submitted by students who opened the test, since that is when their time starts running. Answer sheets submitted
+// after the deadline, once the grace period in TestSettings.json has run out, are either too late or late, depending
+// on the configured late submission policy. The student's override on the test, if any, is taken into account.
+//
+// Tests whose start or end time can't be read accept no answer sheets at all, just like getTest keeps them closed.
+func checkSubmissionTime(test []byte, testID, studentID string, submittedAt time.Time) int {
+	test = applyTestOverride(test, testID, studentID)
+
+	startTime, _ := jsonparser.GetString(test, "startTime")
+
+	start, err := parseTestTime(startTime)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error":  err,
+			"testID": testID,
+		}).Warn("Cannot parse start time of test! Rejecting submission!")
+		return submissionInvalidTiming
+	}
+
+	if submittedAt.Before(start) {
+		return submissionTooEarly
+	}
+
+	openedAt := GetTestSessionStart(testID, studentID)
+
+	duration, _ := jsonparser.GetInt(test, "duration")
+	if duration > 0 && openedAt.IsZero() {
+		return submissionNotOpened
+	}
+
+	deadline, err := getSubmissionDeadline(test, openedAt)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error":  err,
+			"testID": testID,
+		}).Warn("Cannot parse end time of test! Rejecting submission!")
+		return submissionInvalidTiming
+	}
+
+	if !submittedAt.After(deadline.Add(submissionGracePeriod)) {
+		return submissionOnTime
+	}
+
+	if lateSubmissionPolicy == "flag" {
+		return submissionLate
+	}
+
+	return submissionTooLate
+}
+
+// StartDraftAutoSubmitter starts checking, every minute, for draft answer sheets whose student has run out of time.
+// Those drafts are submitted on the student's behalf, as if they were finalized by the student.
+func StartDraftAutoSubmitter() {
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			autoSubmitExpiredDrafts()
+		}
+	}()
+}
+
+// autoSubmitExpiredDrafts submits every draft answer sheet whose student's time, grace period included, has run out.
+func autoSubmitExpiredDrafts() {
+	now := time.Now()
+
+	for _, draft := range ListDraftAnswerSheets() {
+		testID, _ := draft["testID"].(string)
+		studentID, _ := draft["studentID"].(string)
+
+		test := GetTest(testID)
+		if test == "notFound" {
+			continue
+		}
+
+		studentTest := applyTestOverride([]byte(test), testID, studentID)
+
+		deadline, err := getSubmissionDeadline(studentTest, GetTestSessionStart(testID, studentID))
+		if err != nil || !now.After(deadline.Add(submissionGracePeriod)) {
+			continue
+		}
+
+		submitDraftAnswerSheet(testID, studentID, false, true)
+
+		APILogger.WithFields(logrus.Fields{
+			"testID":    testID,
+			"studentID": studentID,
+		}).Info("Draft answer sheet auto-submitted")
+	}
+}
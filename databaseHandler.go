@@ -26,8 +26,11 @@ import (
 	"github.com/globalsign/mgo"
 	"github.com/globalsign/mgo/bson"
 	"github.com/sirupsen/logrus"
+	"math/rand"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -57,6 +60,10 @@ func ConnectToDatabase() {
 //
 // If no student is found by that ID, the method returns "notFound".
 func GetStudentObjectByID(id string) string {
+	if !bson.IsObjectIdHex(id) {
+		return "notFound"
+	}
+
 	var queryMap []bson.M
 
 	studentAccountsCollection := session.DB(dbName).C("Students.Accounts")
@@ -260,6 +267,88 @@ func RegisterTeacher(body string) {
 	}
 }
 
+// RegisterParent merely adds a JSON Parent document on the database in the right collection.
+//
+// This function validates nothing from the document, so any method that might call this one must be certain the
+// inserted document is valid JSON for a Parent object.
+func RegisterParent(body string) {
+	parentsAccountsCollection := session.DB(dbName).C("Parents.Accounts")
+
+	var document map[string]interface{}
+
+	err := json.Unmarshal([]byte(body), &document)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Warn("Could not unmarshal byte-slice into document!")
+	}
+
+	err = parentsAccountsCollection.Insert(document)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Warn("Could not register parent!")
+	}
+}
+
+// FindParentID searches the database for any parent with the username and password provided and returns their ID.
+//
+// If no parent is found by that username and password, then the method returns "notFound".
+func FindParentID(user string, password string) string {
+	var queryMap []bson.M
+
+	parentsAccountsCollection := session.DB(dbName).C("Parents.Accounts")
+
+	err := parentsAccountsCollection.Find(bson.M{"account.userName": user, "account.password": password}).All(&queryMap)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Warn("Could not find parent ID in database with username " + user)
+		return "notFound"
+	}
+
+	parent, err := bson.MarshalJSON(queryMap)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Warn("Could not marshal findParentID request in JSON!")
+	}
+
+	jsonString := string(parent)
+
+	if jsonString == "null\n" {
+		return "notFound"
+	}
+
+	jsonString = strings.Trim(jsonString, "[")
+	jsonString = jsonString[:len(jsonString)-2]
+
+	// this is guaranteed to work, no need for error-checking
+	result, _ := jsonparser.GetString([]byte(jsonString), "_id", "$oid")
+
+	return result
+}
+
+// IsParentOf checks whether the parent with the provided ID has the student with the provided ID among their children.
+func IsParentOf(parentID, studentID string) bool {
+	if !bson.IsObjectIdHex(parentID) {
+		return false
+	}
+
+	parentsAccountsCollection := session.DB(dbName).C("Parents.Accounts")
+
+	count, err := parentsAccountsCollection.Find(bson.M{"_id": bson.ObjectIdHex(parentID), "children": studentID}).Count()
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error":    err,
+			"parentID": parentID,
+		}).Warn("Could not check the children of parent!")
+		return false
+	}
+
+	return count > 0
+}
+
 // ChangeStudentPassword changes the document associated with studentID so that the entry "account.password" contains a
 // new string, newPassword.
 //
@@ -293,11 +382,14 @@ func ChangeTeacherPassword(teacherID, newPassword string) {
 // GetAnswerSheet searches the database for a JSON Answer Sheet associated with a specific student on a specific test ID
 // and returns it.
 //
+// Students may submit several answer sheets on tests that allow several attempts, so the method returns the answer
+// sheet of the provided attempt, or the latest one still waiting to be graded if the attempt is 0.
+//
 // The session initially finds the JSON document with the aforementioned conditions, removes the square brackets
 // inherent with the string representation of a []bson.M variable and returns it.
 //
 // If no such answer sheet is found, the method returns "notFound".
-func GetAnswerSheet(student string, testID string) string {
+func GetAnswerSheet(student string, testID string, attempt int) string {
 	var queryMap []bson.M
 
 	submittedAnswersCollection := session.DB(dbName).C("Students.SubmittedAnswers")
@@ -307,7 +399,12 @@ func GetAnswerSheet(student string, testID string) string {
 	username, _ := jsonparser.GetString(studentJSON, "account", "userName")
 	password, _ := jsonparser.GetString(studentJSON, "account", "password")
 
-	err := submittedAnswersCollection.Find(bson.M{"testID": testID, "student.account.userName": username, "student.account.password": password}).All(&queryMap)
+	query := bson.M{"testID": testID, "student.account.userName": username, "student.account.password": password}
+	if attempt > 0 {
+		query["attempt"] = attemptQuery(attempt)
+	}
+
+	err := submittedAnswersCollection.Find(query).Sort("-attempt").Limit(1).All(&queryMap)
 
 	studentID, _ := jsonparser.GetString([]byte(student), "_id", "$oid")
 
@@ -338,11 +435,18 @@ func GetAnswerSheet(student string, testID string) string {
 	return result
 }
 
-// AddAnswerSheet adds an Answer Sheet JSON document to the database in the right collection.
+// AddAnswerSheet adds an Answer Sheet JSON document to the database in the right collection, as the next attempt of its
+// student on its test, provided the student has attempts left out of the provided limit.
+//
+// The document is stamped with the moment it was submitted, with whether it was submitted late and with the number of
+// the attempt it was submitted as, which the method returns. A unique index on the test, the student and the attempt
+// makes answer sheets submitted at the same time collide, in which case the losing one is renumbered, so that no two
+// answer sheets get the same attempt and none gets past the limit. The method returns 0 if the student has no attempts
+// left, and false if the answer sheet couldn't be added.
 //
 // This function validates nothing from the document, so any method that might call this one must be certain the
 // inserted document is valid JSON for an AnswerSheet object.
-func AddAnswerSheet(answerSheet string) {
+func AddAnswerSheet(answerSheet string, late bool, attemptLimit int) (int, bool) {
 	submittedAnswersCollection := session.DB(dbName).C("Students.SubmittedAnswers")
 
 	var document map[string]interface{}
@@ -352,13 +456,43 @@ func AddAnswerSheet(answerSheet string) {
 		APILogger.WithFields(logrus.Fields{
 			"error": err,
 		}).Warn("Could not unmarshal byte-slice into document!")
+		return 0, false
 	}
 
-	err = submittedAnswersCollection.Insert(document)
+	err = submittedAnswersCollection.EnsureIndex(mgo.Index{Key: []string{"testID", "student.account.userName", "attempt"},
+		Unique: true})
 	if err != nil {
 		APILogger.WithFields(logrus.Fields{
 			"error": err,
-		}).Warn("Could not add answer sheet!")
+		}).Warn("Cannot index answer sheets by attempt!")
+		return 0, false
+	}
+
+	testID, _ := jsonparser.GetString([]byte(answerSheet), "testID")
+	user, _ := jsonparser.GetString([]byte(answerSheet), "student", "account", "userName")
+
+	document["submittedAt"] = time.Now()
+	document["late"] = late
+
+	for numberingAttempt := 1; ; numberingAttempt++ {
+		attempt := CountAttempts(testID, user) + 1
+		if attempt > attemptLimit {
+			return 0, true
+		}
+
+		document["attempt"] = attempt
+
+		err = submittedAnswersCollection.Insert(document)
+		if err == nil {
+			return attempt, true
+		}
+
+		if !mgo.IsDup(err) || numberingAttempt == maxNumberingAttempts {
+			APILogger.WithFields(logrus.Fields{
+				"error": err,
+			}).Warn("Could not add answer sheet!")
+			return 0, false
+		}
 	}
 }
 
@@ -371,7 +505,7 @@ func GetAnswerSheetsForTest(testID string) string {
 
 	var testQuery []bson.M
 
-	err := submittedAnswersCollection.Find(bson.M{"testID": testID}).All(&testQuery)
+	err := submittedAnswersCollection.Find(bson.M{"testID": testID, "cancelled": bson.M{"$ne": true}}).All(&testQuery)
 	if err != nil {
 		APILogger.WithFields(logrus.Fields{
 			"error": err,
@@ -409,11 +543,14 @@ func GetAnswerSheetsForTest(testID string) string {
 // GetGrade searches the database for a JSON Grade associated with a specific student on a specific test ID
 // and returns it.
 //
+// Students may be graded several times on tests that allow several attempts, so the method returns the grade of the
+// provided attempt, or the grade of the latest graded attempt if the attempt is 0.
+//
 // The session initially finds the JSON document with the aforementioned conditions, removes the square brackets
 // inherent with the string representation of a []bson.M variable and returns it.
 //
 // If no such grade is found, the method returns "notFound".
-func GetGrade(studentUser string, testID string) string {
+func GetGrade(studentUser string, testID string, attempt int) string {
 
 	testType := GetTestType(testID)
 
@@ -421,7 +558,12 @@ func GetGrade(studentUser string, testID string) string {
 
 	var gradeQuery []bson.M
 
-	err := gradesCollection.Find(bson.M{"studentAnswerSheet.testID": testID, "studentAnswerSheet.student.account.userName": studentUser}).All(&gradeQuery)
+	query := bson.M{"studentAnswerSheet.testID": testID, "studentAnswerSheet.student.account.userName": studentUser}
+	if attempt > 0 {
+		query["studentAnswerSheet.attempt"] = attemptQuery(attempt)
+	}
+
+	err := gradesCollection.Find(query).Sort("-studentAnswerSheet.attempt").Limit(1).All(&gradeQuery)
 	if err != nil {
 		APILogger.WithFields(logrus.Fields{
 			"error":  err,
@@ -452,7 +594,8 @@ func GetGrade(studentUser string, testID string) string {
 // AddGrade adds a Grade JSON document to the database in the right collection.
 //
 // The method checks which subject the grade is for by calling GetTestType(testID) and adds the grade. If it is
-// successful, the method deletes the answer sheet JSON document from which the grade was constructed from.
+// successful, the method deletes the answer sheet JSON document from which the grade was constructed from, which is
+// the one submitted as the same attempt.
 //
 // This function validates nothing from the document, so any method that might call this one must be certain the
 // inserted document is valid JSON for an Grade object.
@@ -481,7 +624,10 @@ func AddGrade(grade string, testID string) {
 		username, _ := jsonparser.GetString([]byte(grade), "studentAnswerSheet", "student", "account", "userName")
 		password, _ := jsonparser.GetString([]byte(grade), "studentAnswerSheet", "student", "account", "password")
 
-		err := submittedAnswersCollection.Remove(bson.M{"testID": testID, "student.account.userName": username, "student.account.password": password})
+		attempt := getAttemptNumber([]byte(grade), "studentAnswerSheet")
+
+		err := submittedAnswersCollection.Remove(bson.M{"testID": testID, "student.account.userName": username,
+			"student.account.password": password, "attempt": attemptQuery(attempt)})
 		if err != nil {
 			APILogger.WithFields(logrus.Fields{
 				"error": err,
@@ -517,7 +663,8 @@ func GetTestType(testID string) string {
 // GetTest searches the database for a JSON Test associated with a specific test ID and returns it.
 //
 // The session initially finds the JSON document with the aforementioned conditions, removes the square brackets
-// inherent with the string representation of a []bson.M variable and returns it.
+// inherent with the string representation of a []bson.M variable and returns it, with its start and end times written
+// as RFC 3339 timestamps.
 //
 // If no such test is found, the method returns "notFound".
 func GetTest(testID string) string {
@@ -551,23 +698,43 @@ func GetTest(testID string) string {
 	result = strings.Trim(result, "[")
 	result = result[:len(result)-2]
 
-	return result
+	return string(readTestTimes([]byte(result)))
 }
 
-// GetTestQueue searches the database for all tests a specific class might need to take and filters them by specific
+// GetTestQueue searches the database for all tests a specific student might need to take and filters them by specific
 // conditions.
 //
-// Essentially, this takes a JSON array for every single test a class might be able to take and filters them by seeing
+// Essentially, this takes a JSON array for every single test the student might be able to take, be it through their
+// class, one of their student groups or the student themselves being targeted by the test, and filters them by seeing
 // if the time has expired for the test.
 //
+// Tests on which the student has an override are checked against the student's own window, which also brings in
+// make-up tests the student's class doesn't take. Cancelled and archived tests are left out.
+//
 // If there is no test to be taken, the method returns an empty string.
-func GetTestQueue(subject string, grade int64, gradeLetter string) string {
+func GetTestQueue(subject string, grade int64, gradeLetter string, studentID string) string {
 
 	var testQuery []bson.M
 
 	testCollection := session.DB(dbName).C(subject + "Edu.Tests")
 
-	err := testCollection.Find(bson.M{"grade": grade, "gradeLetter": gradeLetter}).All(&testQuery)
+	overriddenTestIDs := GetOverriddenTestIDs(studentID)
+	if overriddenTestIDs == nil {
+		overriddenTestIDs = []string{}
+	}
+
+	groupIDs := GetStudentGroupIDs(studentID)
+	if groupIDs == nil {
+		groupIDs = []string{}
+	}
+
+	err := testCollection.Find(bson.M{"$or": []bson.M{
+		{"grade": grade, "gradeLetter": gradeLetter},
+		{"targets.classes": bson.M{"$elemMatch": bson.M{"grade": grade, "gradeLetter": gradeLetter}}},
+		{"targets.groups": bson.M{"$in": groupIDs}},
+		{"targets.students": studentID},
+		{"testID": bson.M{"$in": overriddenTestIDs}},
+	}}).All(&testQuery)
 	if err != nil {
 		APILogger.WithFields(logrus.Fields{
 			"err": err,
@@ -589,27 +756,38 @@ func GetTestQueue(subject string, grade int64, gradeLetter string) string {
 
 	result = ""
 	_, err = jsonparser.ArrayEach(testArray, func(value []byte, dataType jsonparser.ValueType, offset int, err1 error) {
-		startTime, err2 := jsonparser.GetString(value, "startTime")
+		testID, err2 := jsonparser.GetString(value, "testID")
 		if err2 != nil {
 			return
 		}
-		endTime, err2 := jsonparser.GetString(value, "endTime")
+
+		if GetTestStatus(testID) != testActive {
+			return
+		}
+
+		value = applyTestOverride(readTestTimes(value), testID, studentID)
+
+		startTime, _ := jsonparser.GetString(value, "startTime")
+		endTime, _ := jsonparser.GetString(value, "endTime")
+
+		start, err2 := parseTestTime(startTime)
 		if err2 != nil {
+			APILogger.WithFields(logrus.Fields{
+				"error":  err2,
+				"testID": testID,
+			}).Warn("Cannot parse start time of test! Test can't be taken!")
 			return
 		}
-		testID, err2 := jsonparser.GetString(value, "testID")
+		end, err2 := parseTestTime(endTime)
 		if err2 != nil {
+			APILogger.WithFields(logrus.Fields{
+				"error":  err2,
+				"testID": testID,
+			}).Warn("Cannot parse end time of test! Test can't be taken!")
 			return
 		}
 
-		zone, _ := time.LoadLocation("Europe/Bucharest")
-
-		const layout = "Jan 2, 2006 3:04:05 PM"
-
-		start, _ := time.ParseInLocation(layout, startTime, zone)
-		end, _ := time.ParseInLocation(layout, endTime, zone)
-
-		now := time.Now().In(zone)
+		now := time.Now()
 
 		if start.Before(now) && end.After(now) {
 			result = result + testID + "\n"
@@ -661,8 +839,8 @@ func GetNextTestID() string {
 
 // AddTest adds a Test JSON document to the database in the right collection.
 //
-// This function validates nothing from the document, so any method that might call this one must be certain the
-// inserted document is valid JSON for an Test object.
+// The start and end times of the test are stored as dates. This function validates nothing from the document, so any
+// method that might call this one must be certain the inserted document is valid JSON for an Test object.
 func AddTest(subject string, test string, testID string) {
 	testList := session.DB(dbName).C("VianuEdu.TestList")
 
@@ -694,6 +872,8 @@ func AddTest(subject string, test string, testID string) {
 		}).Warn("Cannot unmarshal test into document!")
 	}
 
+	storeTestTimes(document2)
+
 	testCollection := session.DB(dbName).C(subject + "Edu.Tests")
 	err = testCollection.Insert(document2)
 	if err != nil {
@@ -705,8 +885,8 @@ func AddTest(subject string, test string, testID string) {
 
 // EditTest updates a test in the database which has a specific test ID.
 //
-// This function validates nothing from the document, so any method that might call this one must be certain the
-// inserted document is valid JSON for an Test object.
+// The start and end times of the test are stored as dates. This function validates nothing from the document, so any
+// method that might call this one must be certain the inserted document is valid JSON for an Test object.
 func EditTest(subject string, test string, testID string) {
 	var document2 map[string]interface{}
 	err := json.Unmarshal([]byte(test), &document2)
@@ -716,6 +896,8 @@ func EditTest(subject string, test string, testID string) {
 		}).Warn("Cannot unmarshal test into document!")
 	}
 
+	storeTestTimes(document2)
+
 	testCollection := session.DB(dbName).C(subject + "Edu.Tests")
 	err = testCollection.Update(bson.M{"testID": testID}, document2)
 	if err != nil {
@@ -729,7 +911,8 @@ func EditTest(subject string, test string, testID string) {
 // conditions.
 //
 // Essentially, this takes a JSON array for every single test a course has and filters them by seeing
-// if the test hasn't started yet.
+// if the test hasn't started yet. Cancelled tests are left out. Each test is listed along with the classes, student
+// groups and students it targets.
 //
 // If there is no test to be taken, the method returns an empty string.
 func GetPlannedTests(subject string) string {
@@ -759,36 +942,32 @@ func GetPlannedTests(subject string) string {
 
 	result = ""
 	_, err = jsonparser.ArrayEach(testArray, func(value []byte, dataType jsonparser.ValueType, offset int, err1 error) {
-		startTime, err2 := jsonparser.GetString(value, "startTime")
+		startTime, _ := jsonparser.GetString(readTestTimes(value), "startTime")
+		testID, err2 := jsonparser.GetString(value, "testID")
 		if err2 != nil {
 			return
 		}
-		testID, err2 := jsonparser.GetString(value, "testID")
-		if err2 != nil {
+
+		targets := describeTestTargets(value)
+		if targets == "" {
 			return
 		}
 
-		class, err2 := jsonparser.GetInt(value, "grade")
-		if err2 != nil {
+		if GetTestStatus(testID) != testActive {
 			return
 		}
-		letter, err2 := jsonparser.GetString(value, "gradeLetter")
+
+		start, err2 := parseTestTime(startTime)
 		if err2 != nil {
+			APILogger.WithFields(logrus.Fields{
+				"error":  err2,
+				"testID": testID,
+			}).Warn("Cannot parse start time of test!")
 			return
 		}
-		grade := strconv.Itoa(int(class))
-		grade = grade + letter
-
-		zone, _ := time.LoadLocation("Europe/Bucharest")
-
-		const layout = "Jan 2, 2006 3:04:05 PM"
 
-		start, _ := time.ParseInLocation(layout, startTime, zone)
-
-		now := time.Now().In(zone)
-
-		if start.After(now) {
-			result = result + testID + " // " + grade + "\n"
+		if start.After(time.Now()) {
+			result = result + testID + " // " + targets + "\n"
 		}
 	})
 	if err != nil {
@@ -799,25 +978,23 @@ func GetPlannedTests(subject string) string {
 	return result
 }
 
-// GetGradesForTest queries the database for all the grades attached to the provided username and password for the past
-// 150 days.
+// GetGradesForTest queries the database for all the grades attached to the provided username and password in a term
+// of the academic calendar (see termQuery).
 //
-// This searches the database for all the grades added to a specific student and checks their IDs for the timestamp in
-// order to run the check for time elapsed on grade submission. Then it extracts the test IDs from each grade and returns
-// them in a string.
-func GetGradesForTest(studentUser, studentPass, subject string) string {
+// This searches the database for all the grades added to a specific student in the term. Then it extracts the test
+// IDs from each grade and returns them in a string. Grades on cancelled tests are left out.
+func GetGradesForTest(studentUser, studentPass, subject string, term Term) string {
 
 	var gradeQuery []bson.M
 
 	gradeCollection := session.DB(dbName).C(subject + "Edu.Grades")
 
-	zone, _ := time.LoadLocation("Europe/Bucharest")
-
-	checkTime := time.Now().Add(-150 * 24 * time.Hour).In(zone)
-
-	checkerID := bson.NewObjectIdWithTime(checkTime)
+	query := termQuery(term)
+	query["studentAnswerSheet.student.account.userName"] = studentUser
+	query["studentAnswerSheet.student.account.password"] = studentPass
+	query["cancelled"] = bson.M{"$ne": true}
 
-	err := gradeCollection.Find(bson.M{"_id": bson.M{"$gte": checkerID}, "studentAnswerSheet.student.account.userName": studentUser, "studentAnswerSheet.student.account.password": studentPass}).All(&gradeQuery)
+	err := gradeCollection.Find(query).All(&gradeQuery)
 	if err != nil {
 		APILogger.WithFields(logrus.Fields{
 			"err": err,
@@ -853,6 +1030,45 @@ func GetGradesForTest(studentUser, studentPass, subject string) string {
 	return result
 }
 
+// ListStudentGradesForTerm searches the database for all the grades a student got in a course in a term of the
+// academic calendar and returns them as a JSON array, oldest first. Grades on cancelled tests are left out.
+//
+// Grades belong to the term they were scoped to when given (see termQuery).
+//
+// If the student got no grades in the course in the term, the method returns "notFound".
+func ListStudentGradesForTerm(studentUser, course string, term Term) string {
+	var gradeQuery []bson.M
+
+	gradeCollection := session.DB(dbName).C(course + "Edu.Grades")
+
+	query := termQuery(term)
+	query["studentAnswerSheet.student.account.userName"] = studentUser
+	query["cancelled"] = bson.M{"$ne": true}
+
+	err := gradeCollection.Find(query).Sort("_id").All(&gradeQuery)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"err":    err,
+			"course": course,
+		}).Warn("Cannot find grades of student in database for this term!")
+	}
+
+	gradeArray, err := bson.MarshalJSON(gradeQuery)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"err": err,
+		}).Warn("Cannot marshal gradeArray variable!")
+	}
+
+	result := string(gradeArray)
+
+	if result == "null\n" {
+		return "notFound"
+	}
+
+	return result
+}
+
 // GetUncorrectedTests queries the database for all the tests that currently have an AnswerSheet attached to them in the
 // Students.SubmittedAnswers collection.
 //
@@ -863,7 +1079,7 @@ func GetUncorrectedTests(subject string) string {
 
 	submittedAnswersCollection := session.DB(dbName).C("Students.SubmittedAnswers")
 
-	err := submittedAnswersCollection.Find(bson.M{}).Distinct("testID", &testQuery)
+	err := submittedAnswersCollection.Find(bson.M{"cancelled": bson.M{"$ne": true}}).Distinct("testID", &testQuery)
 
 	if err != nil {
 		APILogger.WithFields(logrus.Fields{
@@ -934,12 +1150,16 @@ func ListClassbook(grade, gradeLetter string) string {
 	return result
 }
 
-func ListLessons(course string, grade int) string {
+func ListLessons(course string, grade int, term Term) string {
 	var queryMap []bson.M
 
 	lessonsCollection := session.DB(dbName).C(course + "Edu.Lessons")
 
-	err := lessonsCollection.Find(bson.M{"grade": grade, "course": course}).All(&queryMap)
+	query := termQuery(term)
+	query["grade"] = grade
+	query["course"] = course
+
+	err := lessonsCollection.Find(query).All(&queryMap)
 
 	if err != nil {
 		APILogger.WithFields(logrus.Fields{
@@ -1021,4 +1241,2115 @@ func GetLesson(course, id string) string {
 	result = result[:len(result)-2]
 
 	return result
-}
\ No newline at end of file
+}
+
+// AddBankQuestion adds a Question JSON document to the question bank of the provided course and returns the ID of the
+// brand-new question, or an empty string if the question couldn't be added.
+//
+// The method stamps the document with the ID of the teacher who added it, so that the question can be traced back to
+// its author. This function validates nothing from the document, so any method that might call this one must be
+// certain the inserted document is valid JSON for a Question object.
+func AddBankQuestion(course, question, teacherID string) string {
+	bankCollection := session.DB(dbName).C(course + "Edu.QuestionBank")
+
+	var document map[string]interface{}
+	err := json.Unmarshal([]byte(question), &document)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Warn("Cannot unmarshal question into document!")
+		return ""
+	}
+
+	questionID := bson.NewObjectId()
+
+	document["_id"] = questionID
+	document["author"] = teacherID
+
+	err = bankCollection.Insert(document)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Warn("Cannot insert question in question bank!")
+		return ""
+	}
+
+	return questionID.Hex()
+}
+
+// GetBankQuestion searches the question bank of the provided course for a question with a specific ID and returns it.
+//
+// If no such question is found, the method returns "notFound".
+func GetBankQuestion(course, questionID string) string {
+	if !bson.IsObjectIdHex(questionID) {
+		return "notFound"
+	}
+
+	var questionQuery []bson.M
+
+	bankCollection := session.DB(dbName).C(course + "Edu.QuestionBank")
+
+	err := bankCollection.FindId(bson.ObjectIdHex(questionID)).All(&questionQuery)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error":      err,
+			"questionID": questionID,
+		}).Warn("Could not find question in question bank!")
+	}
+
+	question, err := bson.MarshalJSON(questionQuery)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Warn("Could not marshal getBankQuestion request in JSON!")
+	}
+
+	result := string(question)
+
+	if result == "null\n" {
+		return "notFound"
+	}
+
+	result = strings.Trim(result, "[")
+	result = result[:len(result)-2]
+
+	return result
+}
+
+// ListBankQuestions lists the IDs of all the questions in the question bank of the provided course that match the
+// provided filters.
+//
+// Empty filters (and a grade of 0) are ignored. If no question matches, the method returns "notFound".
+func ListBankQuestions(course, tag, difficulty string, grade int) string {
+	var questionQuery []bson.M
+
+	bankCollection := session.DB(dbName).C(course + "Edu.QuestionBank")
+
+	query := bson.M{}
+	if tag != "" {
+		query["tags"] = tag
+	}
+	if difficulty != "" {
+		query["difficulty"] = difficulty
+	}
+	if grade != 0 {
+		query["grade"] = grade
+	}
+
+	err := bankCollection.Find(query).All(&questionQuery)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Warn("Could not query question bank!")
+	}
+
+	if len(questionQuery) == 0 {
+		return "notFound"
+	}
+
+	result := ""
+	for _, question := range questionQuery {
+		questionID, ok := question["_id"].(bson.ObjectId)
+		if ok {
+			result = result + questionID.Hex() + "\n"
+		}
+	}
+
+	return result
+}
+
+// GetTestDraw searches the database for the questions drawn from the question bank for a specific student on a
+// specific test ID and returns them.
+//
+// If the student hasn't drawn any questions for this test yet, the method returns "notFound".
+func GetTestDraw(testID, studentID string) string {
+	var drawQuery []bson.M
+
+	drawsCollection := session.DB(dbName).C("Students.TestDraws")
+
+	err := drawsCollection.Find(bson.M{"testID": testID, "studentID": studentID}).All(&drawQuery)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error":     err,
+			"testID":    testID,
+			"studentID": studentID,
+		}).Warn("Could not query test draw in database!")
+	}
+
+	draw, err := bson.MarshalJSON(drawQuery)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Warn("Could not marshal getTestDraw request in JSON!")
+	}
+
+	result := string(draw)
+
+	if result == "null\n" {
+		return "notFound"
+	}
+
+	result = strings.Trim(result, "[")
+	result = result[:len(result)-2]
+
+	return result
+}
+
+// DrawQuestions draws the questions a student gets on a test from the question bank, according to the "questionDraws"
+// rules of the test, and stores them in the Students.TestDraws collection.
+//
+// Every rule asks for a number of questions with a specific difficulty, grade and set of tags. Drawn questions are
+// numbered after the fixed contents of the test, and no bank question is drawn twice for the same student. Should a
+// draw already exist for this student, it is returned as-is, so that a student can't reroll their questions.
+func DrawQuestions(testID, studentID string) string {
+	existingDraw := GetTestDraw(testID, studentID)
+	if existingDraw != "notFound" {
+		return existingDraw
+	}
+
+	test := []byte(GetTest(testID))
+	course := GetTestType(testID)
+
+	bankCollection := session.DB(dbName).C(course + "Edu.QuestionBank")
+
+	nextQuestion := 1
+	jsonparser.ObjectEach(test, func(key []byte, value []byte, dataType jsonparser.ValueType, offset int) error {
+		questionNumber, err := strconv.Atoi(string(key))
+		if err == nil && questionNumber >= nextQuestion {
+			nextQuestion = questionNumber + 1
+		}
+		return nil
+	}, "contents")
+
+	contents := bson.M{}
+	drawnIDs := []bson.ObjectId{}
+
+	_, err := jsonparser.ArrayEach(test, func(value []byte, dataType jsonparser.ValueType, offset int, err1 error) {
+		count, _ := jsonparser.GetInt(value, "count")
+		if count < 0 {
+			count = 0
+		}
+
+		query := bson.M{"_id": bson.M{"$nin": drawnIDs}}
+
+		if difficulty, err2 := jsonparser.GetString(value, "difficulty"); err2 == nil {
+			query["difficulty"] = difficulty
+		}
+		if grade, err2 := jsonparser.GetInt(value, "grade"); err2 == nil {
+			query["grade"] = grade
+		}
+
+		var tags []string
+		jsonparser.ArrayEach(value, func(tag []byte, dataType jsonparser.ValueType, offset int, err2 error) {
+			tags = append(tags, string(tag))
+		}, "tags")
+		if len(tags) > 0 {
+			query["tags"] = bson.M{"$all": tags}
+		}
+
+		var candidates []bson.M
+		err2 := bankCollection.Find(query).All(&candidates)
+		if err2 != nil {
+			APILogger.WithFields(logrus.Fields{
+				"error":  err2,
+				"testID": testID,
+			}).Warn("Could not query question bank for draw!")
+		}
+
+		if int64(len(candidates)) < count {
+			APILogger.WithFields(logrus.Fields{
+				"testID":    testID,
+				"requested": count,
+				"available": len(candidates),
+			}).Warn("Not enough questions in question bank to satisfy draw rule!")
+			count = int64(len(candidates))
+		}
+
+		for _, index := range drawPermutation(len(candidates))[:count] {
+			question := candidates[index]
+			questionID := question["_id"].(bson.ObjectId)
+			drawnIDs = append(drawnIDs, questionID)
+
+			delete(question, "_id")
+			delete(question, "author")
+			delete(question, "course")
+			question["bankQuestionID"] = questionID.Hex()
+
+			contents[strconv.Itoa(nextQuestion)] = question
+			nextQuestion++
+		}
+	}, "questionDraws")
+	if err != nil && err != jsonparser.KeyPathNotFoundError {
+		APILogger.WithFields(logrus.Fields{
+			"error":  err,
+			"testID": testID,
+		}).Warn("Unable to iterate draw rules for test!")
+	}
+
+	drawsCollection := session.DB(dbName).C("Students.TestDraws")
+
+	// upserting only on insert guarantees that two simultaneous requests can't produce two different draws
+	_, err = drawsCollection.Upsert(bson.M{"testID": testID, "studentID": studentID}, bson.M{"$setOnInsert": bson.M{
+		"testID":    testID,
+		"studentID": studentID,
+		"contents":  contents,
+		"drawnAt":   time.Now(),
+	}})
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error":     err,
+			"testID":    testID,
+			"studentID": studentID,
+		}).Warn("Cannot insert test draw in database!")
+	}
+
+	return GetTestDraw(testID, studentID)
+}
+
+var drawRandom = rand.New(rand.NewSource(time.Now().UnixNano()))
+var drawRandomMutex sync.Mutex
+
+// drawPermutation returns a random permutation of [0, n). The random source is shared between requests, therefore it is
+// guarded by a mutex.
+func drawPermutation(n int) []int {
+	drawRandomMutex.Lock()
+	defer drawRandomMutex.Unlock()
+
+	return drawRandom.Perm(n)
+}
+
+// OpenTestSession records the moment a student opens a test in the Students.TestSessions collection, along with the
+// attempt the student opens it for, and returns it.
+//
+// Only the first opening of a test is recorded, so that reopening a test doesn't reset the student's time limit.
+func OpenTestSession(testID, studentID string, attempt int) time.Time {
+	sessionsCollection := session.DB(dbName).C("Students.TestSessions")
+
+	_, err := sessionsCollection.Upsert(bson.M{"testID": testID, "studentID": studentID}, bson.M{"$setOnInsert": bson.M{
+		"testID":    testID,
+		"studentID": studentID,
+		"openedAt":  time.Now(),
+		"attempt":   attempt,
+	}})
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error":     err,
+			"testID":    testID,
+			"studentID": studentID,
+		}).Warn("Cannot record test session in database!")
+	}
+
+	return GetTestSessionStart(testID, studentID)
+}
+
+// CloseTestSession forgets the moment a student opened a test, so that the next time the student opens it, for another
+// attempt, their time limit starts running again.
+func CloseTestSession(testID, studentID string) {
+	sessionsCollection := session.DB(dbName).C("Students.TestSessions")
+
+	err := sessionsCollection.Remove(bson.M{"testID": testID, "studentID": studentID})
+	if err != nil && err != mgo.ErrNotFound {
+		APILogger.WithFields(logrus.Fields{
+			"error":     err,
+			"testID":    testID,
+			"studentID": studentID,
+		}).Warn("Cannot remove test session from database!")
+	}
+}
+
+// GetTestSessionStart returns the moment a student first opened a test.
+//
+// If the student never opened the test, the method returns the zero time.
+func GetTestSessionStart(testID, studentID string) time.Time {
+	var testSession struct {
+		OpenedAt time.Time `bson:"openedAt"`
+	}
+
+	sessionsCollection := session.DB(dbName).C("Students.TestSessions")
+
+	err := sessionsCollection.Find(bson.M{"testID": testID, "studentID": studentID}).One(&testSession)
+	if err != nil && err != mgo.ErrNotFound {
+		APILogger.WithFields(logrus.Fields{
+			"error":     err,
+			"testID":    testID,
+			"studentID": studentID,
+		}).Warn("Could not query test session in database!")
+	}
+
+	return testSession.OpenedAt
+}
+
+// GetTestSessionAttempt returns the attempt a student opened a test for.
+//
+// If the student never opened the test, or opened it before sessions recorded their attempt, the method returns 0.
+func GetTestSessionAttempt(testID, studentID string) int {
+	var testSession struct {
+		Attempt int `bson:"attempt"`
+	}
+
+	sessionsCollection := session.DB(dbName).C("Students.TestSessions")
+
+	err := sessionsCollection.Find(bson.M{"testID": testID, "studentID": studentID}).One(&testSession)
+	if err != nil && err != mgo.ErrNotFound {
+		APILogger.WithFields(logrus.Fields{
+			"error":     err,
+			"testID":    testID,
+			"studentID": studentID,
+		}).Warn("Could not query test session in database!")
+	}
+
+	return testSession.Attempt
+}
+
+// SaveDraftAnswerSheet saves the in-progress answers of a student on a test in the Students.DraftAnswers collection.
+//
+// Only the latest draft is kept, every save replaces the previous one. This function validates nothing from the
+// document, so any method that might call this one must be certain the inserted document is valid JSON for an
+// AnswerSheet object.
+func SaveDraftAnswerSheet(studentID, answerSheet string) {
+	draftsCollection := session.DB(dbName).C("Students.DraftAnswers")
+
+	var document map[string]interface{}
+
+	err := json.Unmarshal([]byte(answerSheet), &document)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Warn("Could not unmarshal byte-slice into document!")
+		return
+	}
+
+	testID, _ := jsonparser.GetString([]byte(answerSheet), "testID")
+
+	document["studentID"] = studentID
+	document["updatedAt"] = time.Now()
+
+	_, err = draftsCollection.Upsert(bson.M{"testID": testID, "studentID": studentID}, document)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error":     err,
+			"testID":    testID,
+			"studentID": studentID,
+		}).Warn("Could not save draft answer sheet!")
+	}
+}
+
+// GetDraftAnswerSheet searches the database for the latest draft answer sheet of a student on a specific test ID and
+// returns it.
+//
+// If no such draft is found, the method returns "notFound".
+func GetDraftAnswerSheet(testID, studentID string) string {
+	var draftQuery []bson.M
+
+	draftsCollection := session.DB(dbName).C("Students.DraftAnswers")
+
+	err := draftsCollection.Find(bson.M{"testID": testID, "studentID": studentID, "cancelled": bson.M{"$ne": true}}).
+		All(&draftQuery)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error":     err,
+			"testID":    testID,
+			"studentID": studentID,
+		}).Warn("Could not find draft answer sheet in database!")
+	}
+
+	draft, err := bson.MarshalJSON(draftQuery)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Warn("Could not marshal getDraftAnswerSheet request in JSON!")
+	}
+
+	result := string(draft)
+
+	if result == "null\n" {
+		return "notFound"
+	}
+
+	result = strings.Trim(result, "[")
+	result = result[:len(result)-2]
+
+	return result
+}
+
+// RemoveDraftAnswerSheet removes the draft answer sheet of a student on a specific test ID, if there is one.
+func RemoveDraftAnswerSheet(testID, studentID string) {
+	draftsCollection := session.DB(dbName).C("Students.DraftAnswers")
+
+	err := draftsCollection.Remove(bson.M{"testID": testID, "studentID": studentID})
+	if err != nil && err != mgo.ErrNotFound {
+		APILogger.WithFields(logrus.Fields{
+			"error":     err,
+			"testID":    testID,
+			"studentID": studentID,
+		}).Warn("Cannot remove draft answer sheet from database!")
+	}
+}
+
+// ListDraftAnswerSheets returns the test ID and student ID of every draft answer sheet currently saved.
+func ListDraftAnswerSheets() []bson.M {
+	var draftQuery []bson.M
+
+	draftsCollection := session.DB(dbName).C("Students.DraftAnswers")
+
+	err := draftsCollection.Find(bson.M{"cancelled": bson.M{"$ne": true}}).Select(bson.M{"testID": 1, "studentID": 1}).
+		All(&draftQuery)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Warn("Could not query draft answer sheets!")
+	}
+
+	return draftQuery
+}
+
+// SetTestOverride sets the per-student override of a test for a specific student in the VianuEdu.TestOverrides
+// collection, replacing any previous override the student had on that test.
+//
+// This function validates nothing from the document, so any method that might call this one must be certain the
+// inserted document is valid JSON for a TestOverride object.
+func SetTestOverride(testID, studentID, override, teacherID string) {
+	overridesCollection := session.DB(dbName).C("VianuEdu.TestOverrides")
+
+	var document map[string]interface{}
+
+	err := json.Unmarshal([]byte(override), &document)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Warn("Could not unmarshal byte-slice into document!")
+		return
+	}
+
+	storeTestTimes(document)
+
+	document["testID"] = testID
+	document["studentID"] = studentID
+	document["teacherID"] = teacherID
+	document["updatedAt"] = time.Now()
+
+	_, err = overridesCollection.Upsert(bson.M{"testID": testID, "studentID": studentID}, document)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error":     err,
+			"testID":    testID,
+			"studentID": studentID,
+		}).Warn("Could not set test override!")
+	}
+}
+
+// GetTestOverride searches the database for the override a specific student has on a specific test ID and returns it.
+//
+// If the student has no override on the test, the method returns "notFound".
+func GetTestOverride(testID, studentID string) string {
+	var overrideQuery []bson.M
+
+	overridesCollection := session.DB(dbName).C("VianuEdu.TestOverrides")
+
+	err := overridesCollection.Find(bson.M{"testID": testID, "studentID": studentID}).All(&overrideQuery)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error":     err,
+			"testID":    testID,
+			"studentID": studentID,
+		}).Warn("Could not find test override in database!")
+	}
+
+	override, err := bson.MarshalJSON(overrideQuery)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Warn("Could not marshal getTestOverride request in JSON!")
+	}
+
+	result := string(override)
+
+	if result == "null\n" {
+		return "notFound"
+	}
+
+	result = strings.Trim(result, "[")
+	result = result[:len(result)-2]
+
+	return string(readTestTimes([]byte(result)))
+}
+
+// RemoveTestOverride removes the override a specific student has on a specific test ID.
+//
+// The method returns false if there was no such override.
+func RemoveTestOverride(testID, studentID string) bool {
+	overridesCollection := session.DB(dbName).C("VianuEdu.TestOverrides")
+
+	err := overridesCollection.Remove(bson.M{"testID": testID, "studentID": studentID})
+	if err == mgo.ErrNotFound {
+		return false
+	}
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error":     err,
+			"testID":    testID,
+			"studentID": studentID,
+		}).Warn("Cannot remove test override from database!")
+		return false
+	}
+
+	return true
+}
+
+// GetOverriddenTestIDs returns the IDs of all the tests on which a specific student has an override.
+func GetOverriddenTestIDs(studentID string) []string {
+	var testIDs []string
+
+	overridesCollection := session.DB(dbName).C("VianuEdu.TestOverrides")
+
+	err := overridesCollection.Find(bson.M{"studentID": studentID}).Distinct("testID", &testIDs)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error":     err,
+			"studentID": studentID,
+		}).Warn("Unable to query test overrides for student!")
+	}
+
+	return testIDs
+}
+
+// courses lists every course VianuEdu has. Each course has its own set of collections in the database.
+var courses = []string{"Geo", "Phi", "Info", "Math"}
+
+// MigrateTestTimes converts the start and end times of every test and test override still written in the legacy
+// layout ("Jan 2, 2006 3:04:05 PM", in the timezone of the school) into dates.
+//
+// The method returns a report, with one line for every collection migrated and one line for every document whose
+// times couldn't be parsed. Those documents are left untouched and must be fixed by hand.
+func MigrateTestTimes() string {
+	result := ""
+
+	for _, course := range courses {
+		result = result + migrateCollectionTimes(course+"Edu.Tests", "testID")
+	}
+	result = result + migrateCollectionTimes("VianuEdu.TestOverrides", "testID")
+
+	return result
+}
+
+// migrateCollectionTimes converts the legacy test times of every document in a collection into dates, and reports on
+// it. Documents are identified in the report by the provided field.
+func migrateCollectionTimes(collectionName, idField string) string {
+	collection := session.DB(dbName).C(collectionName)
+
+	var documents []bson.M
+
+	// BSON type 2 is string, which means the times weren't migrated yet
+	err := collection.Find(bson.M{"$or": []bson.M{
+		{"startTime": bson.M{"$type": 2}},
+		{"endTime": bson.M{"$type": 2}},
+	}}).All(&documents)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error":      err,
+			"collection": collectionName,
+		}).Warn("Cannot query documents to migrate!")
+		return collectionName + ": cannot query documents to migrate!\n"
+	}
+
+	migrated := 0
+	failures := ""
+	for _, document := range documents {
+		update := bson.M{}
+		failed := false
+
+		for _, field := range testTimeFields {
+			value, ok := document[field].(string)
+			if !ok {
+				continue
+			}
+
+			parsedTime, err := time.ParseInLocation(legacyTestTimeLayout, value, schoolTimezone)
+			if err != nil {
+				failed = true
+				break
+			}
+			update[field] = parsedTime
+		}
+
+		if failed {
+			failures = failures + fmt.Sprintf("%s: cannot parse times of %v!\n", collectionName, document[idField])
+			continue
+		}
+
+		err = collection.UpdateId(document["_id"], bson.M{"$set": update})
+		if err != nil {
+			failures = failures + fmt.Sprintf("%s: cannot update %v!\n", collectionName, document[idField])
+			continue
+		}
+		migrated++
+	}
+
+	return fmt.Sprintf("%s: %d documents migrated, %d failed\n", collectionName, migrated, len(documents)-migrated) +
+		failures
+}
+
+// maxNumberingAttempts is how many times insertNumbered tries to insert a document before giving up, every other
+// document inserted in the meantime taking the number it was about to get.
+const maxNumberingAttempts = 5
+
+// insertNumbered inserts the document built by newDocument in a collection, numbered after the highest number
+// ("numberField") among the documents of the same owner ("ownerField"), i.e. the revisions of a test, starting from 1.
+//
+// A unique index on the owner and the number makes concurrent inserts of the same number collide, in which case the
+// losing document is renumbered and inserted again. The method returns the number the document got.
+func insertNumbered(collection *mgo.Collection, ownerField, owner, numberField string,
+	newDocument func(number int) interface{}) (int, error) {
+	err := collection.EnsureIndex(mgo.Index{Key: []string{ownerField, numberField}, Unique: true})
+	if err != nil {
+		return 0, err
+	}
+
+	for attempt := 1; ; attempt++ {
+		number := 1
+
+		var latest bson.M
+		latestQuery := collection.Find(bson.M{ownerField: owner}).Sort("-" + numberField).Select(bson.M{numberField: 1})
+		err = latestQuery.One(&latest)
+		if err != nil && err != mgo.ErrNotFound {
+			return 0, err
+		}
+
+		switch latestNumber := latest[numberField].(type) {
+		case int:
+			number = latestNumber + 1
+		case int64:
+			number = int(latestNumber) + 1
+		}
+
+		err = collection.Insert(newDocument(number))
+		if !mgo.IsDup(err) || attempt == maxNumberingAttempts {
+			return number, err
+		}
+	}
+}
+
+// AddTestRevision stores a revision of a test in the VianuEdu.TestRevisions collection, along with who made it, when,
+// and why. Revisions are numbered from 1, in the order they were made.
+//
+// Corrections are revisions made after the test has started, which must always state their reason. This function
+// validates nothing from the document, so any method that might call this one must be certain the inserted document
+// is valid JSON for a Test object.
+func AddTestRevision(testID, test, teacherID, reason string, correction bool) {
+	revisionsCollection := session.DB(dbName).C("VianuEdu.TestRevisions")
+
+	var document map[string]interface{}
+
+	err := json.Unmarshal([]byte(test), &document)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Warn("Cannot unmarshal test into document!")
+		return
+	}
+
+	delete(document, "_id")
+	storeTestTimes(document)
+
+	timestamp := time.Now()
+
+	_, err = insertNumbered(revisionsCollection, "testID", testID, "revision", func(revision int) interface{} {
+		return bson.M{
+			"testID":     testID,
+			"revision":   revision,
+			"author":     teacherID,
+			"timestamp":  timestamp,
+			"reason":     reason,
+			"correction": correction,
+			"test":       document,
+		}
+	})
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error":  err,
+			"testID": testID,
+		}).Warn("Cannot insert test revision in database!")
+	}
+}
+
+// CountTestRevisions returns how many revisions of a test are stored in the database.
+func CountTestRevisions(testID string) int {
+	revisionsCollection := session.DB(dbName).C("VianuEdu.TestRevisions")
+
+	count, err := revisionsCollection.Find(bson.M{"testID": testID}).Count()
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error":  err,
+			"testID": testID,
+		}).Warn("Cannot count revisions of test!")
+	}
+
+	return count
+}
+
+// GetTestRevision searches the database for a specific revision of a test and returns it, with the start and end times
+// of the test written as RFC 3339 timestamps.
+//
+// If no such revision is found, the method returns "notFound".
+func GetTestRevision(testID string, revision int) string {
+	var revisionQuery []bson.M
+
+	revisionsCollection := session.DB(dbName).C("VianuEdu.TestRevisions")
+
+	err := revisionsCollection.Find(bson.M{"testID": testID, "revision": revision}).All(&revisionQuery)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error":    err,
+			"testID":   testID,
+			"revision": revision,
+		}).Warn("Could not find test revision in database!")
+	}
+
+	revisionJSON, err := bson.MarshalJSON(revisionQuery)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Warn("Could not marshal getTestRevision request in JSON!")
+	}
+
+	result := string(revisionJSON)
+
+	if result == "null\n" {
+		return "notFound"
+	}
+
+	result = strings.Trim(result, "[")
+	result = result[:len(result)-2]
+
+	test, _, _, err := jsonparser.Get([]byte(result), "test")
+	if err == nil {
+		revisionJSON, _ = jsonparser.Set([]byte(result), readTestTimes(test), "test")
+		result = string(revisionJSON)
+	}
+
+	return result
+}
+
+// ListTestRevisions lists every revision of a test, one per line, as follows:
+//
+//	[REVISION] // [TIMESTAMP] // [AUTHOR ID] // [edit OR correction] // [REASON]
+//
+// If the test has no revisions, the method returns "notFound".
+func ListTestRevisions(testID string) string {
+	var revisionQuery []struct {
+		Revision   int       `bson:"revision"`
+		Author     string    `bson:"author"`
+		Timestamp  time.Time `bson:"timestamp"`
+		Reason     string    `bson:"reason"`
+		Correction bool      `bson:"correction"`
+	}
+
+	revisionsCollection := session.DB(dbName).C("VianuEdu.TestRevisions")
+
+	err := revisionsCollection.Find(bson.M{"testID": testID}).Sort("revision").All(&revisionQuery)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error":  err,
+			"testID": testID,
+		}).Warn("Could not query test revisions in database!")
+	}
+
+	if len(revisionQuery) == 0 {
+		return "notFound"
+	}
+
+	result := ""
+	for _, revision := range revisionQuery {
+		kind := "edit"
+		if revision.Correction {
+			kind = "correction"
+		}
+
+		result = result + fmt.Sprintf("%d // %s // %s // %s // %s\n", revision.Revision,
+			formatTestTime(revision.Timestamp), revision.Author, kind, revision.Reason)
+	}
+
+	return result
+}
+
+// GetTestStatus checks the "VianuEdu.TestList" collection for the status of the test ID provided, which is either
+// "active", "cancelled" or "archived". Tests that never had their status changed are active.
+//
+// If no such test is found, the method returns "notFound".
+func GetTestStatus(testID string) string {
+	var testQuery []bson.M
+
+	testList := session.DB(dbName).C("VianuEdu.TestList")
+
+	err := testList.FindId(testID).All(&testQuery)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error":  err,
+			"testID": testID,
+		}).Warn("Cannot find test status in database!")
+	}
+
+	if len(testQuery) == 0 {
+		return "notFound"
+	}
+
+	status, _ := testQuery[0]["status"].(string)
+	if status == "" {
+		return testActive
+	}
+
+	return status
+}
+
+// SetTestStatus changes the status of a test in the "VianuEdu.TestList" collection, recording who changed it, when,
+// and why.
+func SetTestStatus(testID, status, teacherID, reason string) {
+	testList := session.DB(dbName).C("VianuEdu.TestList")
+
+	err := testList.UpdateId(testID, bson.M{"$set": bson.M{
+		"status":          status,
+		"statusChangedBy": teacherID,
+		"statusChangedAt": time.Now(),
+		"statusReason":    reason,
+	}})
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error":  err,
+			"testID": testID,
+			"status": status,
+		}).Warn("Cannot change status of test!")
+	}
+}
+
+// CountAnswerSheets returns how many answer sheets submitted for a test are still waiting to be graded.
+func CountAnswerSheets(testID string) int {
+	submittedAnswersCollection := session.DB(dbName).C("Students.SubmittedAnswers")
+
+	count, err := submittedAnswersCollection.Find(bson.M{"testID": testID, "cancelled": bson.M{"$ne": true}}).Count()
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error":  err,
+			"testID": testID,
+		}).Warn("Cannot count answer sheets of test!")
+	}
+
+	return count
+}
+
+// CountDraftAnswerSheets returns how many draft answer sheets are saved for a test.
+func CountDraftAnswerSheets(testID string) int {
+	draftsCollection := session.DB(dbName).C("Students.DraftAnswers")
+
+	count, err := draftsCollection.Find(bson.M{"testID": testID, "cancelled": bson.M{"$ne": true}}).Count()
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error":  err,
+			"testID": testID,
+		}).Warn("Cannot count draft answer sheets of test!")
+	}
+
+	return count
+}
+
+// CountGrades returns how many grades have been given on a test.
+func CountGrades(testID string) int {
+	gradesCollection := session.DB(dbName).C(GetTestType(testID) + "Edu.Grades")
+
+	count, err := gradesCollection.Find(bson.M{"studentAnswerSheet.testID": testID}).Count()
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error":  err,
+			"testID": testID,
+		}).Warn("Cannot count grades of test!")
+	}
+
+	return count
+}
+
+// GetTestOverrideStudentIDs returns the IDs of all the students who have an override on a specific test.
+func GetTestOverrideStudentIDs(testID string) []string {
+	var studentIDs []string
+
+	overridesCollection := session.DB(dbName).C("VianuEdu.TestOverrides")
+
+	err := overridesCollection.Find(bson.M{"testID": testID}).Distinct("studentID", &studentIDs)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error":  err,
+			"testID": testID,
+		}).Warn("Unable to query test overrides for test!")
+	}
+
+	return studentIDs
+}
+
+// CancelTest marks a test as cancelled, so that it can no longer be taken or graded.
+//
+// The answer sheets still waiting to be graded, the draft answer sheets and the grades of the test are all kept, but
+// flagged as cancelled, so that they are no longer waiting to be graded or submitted and grades no longer count towards
+// the current grades of students. The method returns how many answer sheets and how many grades were flagged.
+func CancelTest(testID, teacherID, reason string) (int, int) {
+	SetTestStatus(testID, testCancelled, teacherID, reason)
+
+	submittedAnswersCollection := session.DB(dbName).C("Students.SubmittedAnswers")
+
+	flaggedAnswerSheets, err := submittedAnswersCollection.UpdateAll(bson.M{"testID": testID},
+		bson.M{"$set": bson.M{"cancelled": true}})
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error":  err,
+			"testID": testID,
+		}).Warn("Cannot flag answer sheets of cancelled test!")
+		flaggedAnswerSheets = &mgo.ChangeInfo{}
+	}
+
+	draftsCollection := session.DB(dbName).C("Students.DraftAnswers")
+
+	_, err = draftsCollection.UpdateAll(bson.M{"testID": testID}, bson.M{"$set": bson.M{"cancelled": true}})
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error":  err,
+			"testID": testID,
+		}).Warn("Cannot flag draft answer sheets of cancelled test!")
+	}
+
+	gradesCollection := session.DB(dbName).C(GetTestType(testID) + "Edu.Grades")
+
+	flaggedGrades, err := gradesCollection.UpdateAll(bson.M{"studentAnswerSheet.testID": testID},
+		bson.M{"$set": bson.M{"cancelled": true}})
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error":  err,
+			"testID": testID,
+		}).Warn("Cannot flag grades of cancelled test!")
+		flaggedGrades = &mgo.ChangeInfo{}
+	}
+
+	return flaggedAnswerSheets.Updated, flaggedGrades.Updated
+}
+
+// DeleteTest removes a test from the database, along with everything attached to it: its entry in the
+// "VianuEdu.TestList" collection, its revisions, its overrides, and the question draws, sessions and draft answer
+// sheets of its students.
+//
+// This function checks nothing, so any method that might call this one must be certain that no student has taken the
+// test, since their answer sheets and grades would be left pointing to a test that doesn't exist anymore.
+func DeleteTest(testID string) {
+	testCollection := session.DB(dbName).C(GetTestType(testID) + "Edu.Tests")
+
+	err := testCollection.Remove(bson.M{"testID": testID})
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error":  err,
+			"testID": testID,
+		}).Warn("Cannot remove test from database!")
+	}
+
+	for _, collectionName := range []string{"VianuEdu.TestRevisions", "VianuEdu.TestOverrides", "Students.TestDraws",
+		"Students.TestSessions", "Students.DraftAnswers"} {
+		_, err = session.DB(dbName).C(collectionName).RemoveAll(bson.M{"testID": testID})
+		if err != nil {
+			APILogger.WithFields(logrus.Fields{
+				"error":      err,
+				"testID":     testID,
+				"collection": collectionName,
+			}).Warn("Cannot remove documents of deleted test!")
+		}
+	}
+
+	// the test list goes last, since the course of the test is read from it
+	testList := session.DB(dbName).C("VianuEdu.TestList")
+
+	err = testList.RemoveId(testID)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error":  err,
+			"testID": testID,
+		}).Warn("Cannot remove test properties from database!")
+	}
+}
+
+// AddStudentGroup adds a StudentGroup JSON document to the VianuEdu.StudentGroups collection and returns the ID of the
+// brand-new group, or an empty string if the group couldn't be added.
+//
+// The method stamps the document with the ID of the teacher who created it. This function validates nothing from the
+// document, so any method that might call this one must be certain the inserted document is valid JSON for a
+// StudentGroup object.
+func AddStudentGroup(group, teacherID string) string {
+	groupsCollection := session.DB(dbName).C("VianuEdu.StudentGroups")
+
+	var document map[string]interface{}
+	err := json.Unmarshal([]byte(group), &document)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Warn("Cannot unmarshal student group into document!")
+		return ""
+	}
+
+	groupID := bson.NewObjectId()
+
+	document["_id"] = groupID
+	document["author"] = teacherID
+
+	err = groupsCollection.Insert(document)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Warn("Cannot insert student group in database!")
+		return ""
+	}
+
+	return groupID.Hex()
+}
+
+// EditStudentGroup replaces the student group with a specific ID, keeping the ID of the teacher who created it. The
+// method returns false if the group couldn't be replaced.
+//
+// This function validates nothing from the document, so any method that might call this one must be certain the
+// inserted document is valid JSON for a StudentGroup object.
+func EditStudentGroup(groupID, group string) bool {
+	groupsCollection := session.DB(dbName).C("VianuEdu.StudentGroups")
+
+	var document map[string]interface{}
+	err := json.Unmarshal([]byte(group), &document)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Warn("Cannot unmarshal student group into document!")
+		return false
+	}
+
+	author, _ := jsonparser.GetString([]byte(GetStudentGroup(groupID)), "author")
+
+	document["author"] = author
+
+	err = groupsCollection.UpdateId(bson.ObjectIdHex(groupID), document)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error":   err,
+			"groupID": groupID,
+		}).Warn("Cannot update student group in database!")
+		return false
+	}
+
+	return true
+}
+
+// GetStudentGroup searches the VianuEdu.StudentGroups collection for a student group with a specific ID and returns it.
+//
+// If no such group is found, the method returns "notFound".
+func GetStudentGroup(groupID string) string {
+	if !bson.IsObjectIdHex(groupID) {
+		return "notFound"
+	}
+
+	var groupQuery []bson.M
+
+	groupsCollection := session.DB(dbName).C("VianuEdu.StudentGroups")
+
+	err := groupsCollection.FindId(bson.ObjectIdHex(groupID)).All(&groupQuery)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error":   err,
+			"groupID": groupID,
+		}).Warn("Could not find student group in database!")
+	}
+
+	group, err := bson.MarshalJSON(groupQuery)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Warn("Could not marshal getStudentGroup request in JSON!")
+	}
+
+	result := string(group)
+
+	if result == "null\n" {
+		return "notFound"
+	}
+
+	result = strings.Trim(result, "[")
+	result = result[:len(result)-2]
+
+	return result
+}
+
+// ListStudentGroups lists every student group, one per line, as follows:
+//
+//	[GROUP ID] // [NAME]
+//
+// If there are no student groups, the method returns "notFound".
+func ListStudentGroups() string {
+	var groupQuery []bson.M
+
+	groupsCollection := session.DB(dbName).C("VianuEdu.StudentGroups")
+
+	err := groupsCollection.Find(bson.M{}).Select(bson.M{"name": 1}).All(&groupQuery)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Warn("Could not query student groups!")
+	}
+
+	if len(groupQuery) == 0 {
+		return "notFound"
+	}
+
+	result := ""
+	for _, group := range groupQuery {
+		groupID, ok := group["_id"].(bson.ObjectId)
+		if ok {
+			name, _ := group["name"].(string)
+			result = result + groupID.Hex() + " // " + name + "\n"
+		}
+	}
+
+	return result
+}
+
+// GetStudentGroupIDs returns the IDs of all the student groups a specific student is part of.
+func GetStudentGroupIDs(studentID string) []string {
+	var groupQuery []bson.M
+
+	groupsCollection := session.DB(dbName).C("VianuEdu.StudentGroups")
+
+	err := groupsCollection.Find(bson.M{"students": studentID}).Select(bson.M{"_id": 1}).All(&groupQuery)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error":     err,
+			"studentID": studentID,
+		}).Warn("Unable to query student groups for student!")
+	}
+
+	var groupIDs []string
+	for _, group := range groupQuery {
+		groupID, ok := group["_id"].(bson.ObjectId)
+		if ok {
+			groupIDs = append(groupIDs, groupID.Hex())
+		}
+	}
+
+	return groupIDs
+}
+
+// GetTestResultsByClass sums up the grades given on a test for every class the graded students are part of, no matter
+// whether the test targeted the class, a student group or the students themselves. Classes are listed one per line, as
+// follows:
+//
+//	[CLASS] // [NUMBER OF GRADES] // [AVERAGE GRADE] // [AVERAGE MARK]
+//
+// Students who took the test several times are counted once, with the score and the mark that count under the scoring
+// policy of the test. Average marks are kept with two decimals, whatever the grade scale of the test.
+//
+// If no grades have been given on the test, the method returns "notFound".
+func GetTestResultsByClass(testID string) string {
+	grades := ListGradesForTest(testID)
+
+	if grades == "notFound" {
+		return "notFound"
+	}
+
+	test := GetTest(testID)
+	_, policy := getAttemptPolicy([]byte(test))
+	scale := getTestGradeScale(test)
+
+	type studentAttempt struct {
+		attempt int
+		score   float64
+		mark    float64
+	}
+
+	studentClasses := make(map[string]string)
+	studentAttempts := make(map[string][]studentAttempt)
+	var students []string
+
+	_, err := jsonparser.ArrayEach([]byte(grades), func(value []byte, dataType jsonparser.ValueType, offset int, err1 error) {
+		grade, _ := jsonparser.GetInt(value, "studentAnswerSheet", "student", "grade")
+		gradeLetter, _ := jsonparser.GetString(value, "studentAnswerSheet", "student", "gradeLetter")
+		studentUser, _ := jsonparser.GetString(value, "studentAnswerSheet", "student", "account", "userName")
+		currentGrade, _ := jsonparser.GetFloat(value, "currentGrade")
+
+		if _, ok := studentClasses[studentUser]; !ok {
+			students = append(students, studentUser)
+		}
+
+		studentClasses[studentUser] = strconv.Itoa(int(grade)) + gradeLetter
+		studentAttempts[studentUser] = append(studentAttempts[studentUser],
+			studentAttempt{getAttemptNumber(value, "studentAnswerSheet"), currentGrade, scale.gradeMark(value)})
+	})
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Warn("Unable to iterate JSON array!")
+	}
+
+	counts := make(map[string]int)
+	totals := make(map[string]float64)
+	markTotals := make(map[string]float64)
+	var classes []string
+
+	for _, studentUser := range students {
+		attempts := studentAttempts[studentUser]
+		sort.SliceStable(attempts, func(i, j int) bool {
+			return attempts[i].attempt < attempts[j].attempt
+		})
+
+		var scores, marks []float64
+		for _, attempt := range attempts {
+			scores = append(scores, attempt.score)
+			marks = append(marks, attempt.mark)
+		}
+
+		class := studentClasses[studentUser]
+		if counts[class] == 0 {
+			classes = append(classes, class)
+		}
+
+		counts[class]++
+		totals[class] += scoreAttempts(policy, scores)
+		markTotals[class] += scale.roundMark(scoreAttempts(policy, marks))
+	}
+
+	sort.Strings(classes)
+
+	result := ""
+	for _, class := range classes {
+		result = result + fmt.Sprintf("%s // %d // %.2f // %.2f\n", class, counts[class],
+			totals[class]/float64(counts[class]), markTotals[class]/float64(counts[class]))
+	}
+
+	return result
+}
+
+// ListGradesForTest searches the database for every grade given on a specific test and returns them as a JSON array.
+//
+// If no grades have been given on the test, the method returns "notFound".
+func ListGradesForTest(testID string) string {
+	var gradeQuery []bson.M
+
+	gradesCollection := session.DB(dbName).C(GetTestType(testID) + "Edu.Grades")
+
+	err := gradesCollection.Find(bson.M{"studentAnswerSheet.testID": testID}).All(&gradeQuery)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error":  err,
+			"testID": testID,
+		}).Warn("Cannot find grades in database for this test!")
+	}
+
+	gradeArray, err := bson.MarshalJSON(gradeQuery)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Warn("Cannot marshal gradeArray variable!")
+	}
+
+	result := string(gradeArray)
+
+	if result == "null\n" {
+		return "notFound"
+	}
+
+	return result
+}
+
+// ApplyRegrades updates the grades of a test with the result of a regrade and records the regrade in the
+// VianuEdu.RegradeLog collection, along with who made it, when, and why.
+//
+// Every grade gets its new score and mark and the corrected entries of its answer key, the version it replaces being
+// kept in its history (see replaceGrade). The regrade is logged as "pending" before any grade is changed, and once
+// every grade has been handled, as "applied", or as "partial" if some of them couldn't be changed. Every change of the
+// log states whether it was "applied". The method returns false unless every grade was changed.
+func ApplyRegrades(testID, teacherID, reason string, regrades []Regrade) bool {
+	gradesCollection := session.DB(dbName).C(GetTestType(testID) + "Edu.Grades")
+	regradeLogCollection := session.DB(dbName).C("VianuEdu.RegradeLog")
+
+	now := time.Now()
+	logID := bson.NewObjectId()
+
+	changes := []bson.M{}
+	for _, regrade := range regrades {
+		changes = append(changes, bson.M{
+			"gradeID":   regrade.GradeID,
+			"studentID": regrade.StudentID,
+			"before":    regrade.Before,
+			"after":     regrade.After,
+			"questions": regrade.Questions,
+			"applied":   false,
+		})
+	}
+
+	err := regradeLogCollection.Insert(bson.M{
+		"_id":       logID,
+		"testID":    testID,
+		"teacherID": teacherID,
+		"timestamp": now,
+		"reason":    reason,
+		"status":    regradePending,
+		"changes":   changes,
+	})
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error":  err,
+			"testID": testID,
+		}).Warn("Cannot record regrade in database!")
+		return false
+	}
+
+	applied := 0
+	for index, regrade := range regrades {
+		update := bson.M{"currentGrade": regrade.After, "mark": regrade.Mark, "regradedAt": now}
+		for questionNumber, answer := range regrade.AnswerKey {
+			update["answerKey.answers."+questionNumber] = answer
+		}
+
+		previous := GradeVersion{GradeID: regrade.GradeID, TestID: testID, StudentID: regrade.StudentID,
+			Kind: gradeRegraded, CurrentGrade: regrade.Before, Mark: regrade.BeforeMark, ReplacedAt: now,
+			ReplacedBy: teacherID, Reason: reason}
+
+		if replaceGrade(gradesCollection, previous, update) == gradeReplaced {
+			changes[index]["applied"] = true
+			applied++
+		}
+	}
+
+	status := regradeApplied
+	if applied < len(regrades) {
+		status = regradePartial
+	}
+
+	err = regradeLogCollection.UpdateId(logID, bson.M{"$set": bson.M{"status": status, "changes": changes}})
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error":  err,
+			"testID": testID,
+		}).Warn("Cannot record outcome of regrade in database!")
+	}
+
+	return applied == len(regrades)
+}
+
+// replaceGrade changes a grade with the provided update, after recording the version it replaces in the
+// VianuEdu.GradeHistory collection (see AddGradeVersion). The grade is only changed if it still has the score of the
+// version it replaces, so that two changes made at the same time can't both replace the same version.
+//
+// The method returns gradeConflict if the grade was changed in the meantime, and gradeNotReplaced if either the
+// previous version couldn't be recorded or the grade couldn't be changed. Either way, nothing is changed.
+func replaceGrade(gradesCollection *mgo.Collection, previous GradeVersion, update bson.M) int {
+	historyCollection := session.DB(dbName).C("VianuEdu.GradeHistory")
+
+	version, recorded := AddGradeVersion(previous)
+	if !recorded {
+		return gradeNotReplaced
+	}
+
+	selector := bson.M{"_id": bson.ObjectIdHex(previous.GradeID), "currentGrade": previous.CurrentGrade}
+
+	err := gradesCollection.Update(selector, bson.M{"$set": update})
+	if err != nil {
+		if err != mgo.ErrNotFound {
+			APILogger.WithFields(logrus.Fields{
+				"error":   err,
+				"gradeID": previous.GradeID,
+			}).Warn("Cannot change grade!")
+		}
+
+		// the grade wasn't changed, so the version recorded for it isn't a previous one
+		historyCollection.Remove(bson.M{"gradeID": previous.GradeID, "version": version})
+
+		if err == mgo.ErrNotFound {
+			return gradeConflict
+		}
+		return gradeNotReplaced
+	}
+
+	return gradeReplaced
+}
+
+// AddGradeVersion records a previous version of a grade in the VianuEdu.GradeHistory collection, numbered after the
+// versions already recorded for the grade (see insertNumbered), and returns the number it got. The method returns
+// false if the version couldn't be recorded.
+func AddGradeVersion(version GradeVersion) (int, bool) {
+	historyCollection := session.DB(dbName).C("VianuEdu.GradeHistory")
+
+	number, err := insertNumbered(historyCollection, "gradeID", version.GradeID, "version", func(number int) interface{} {
+		version.Version = number
+		return version
+	})
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error":   err,
+			"gradeID": version.GradeID,
+		}).Warn("Cannot record version of grade in database!")
+		return 0, false
+	}
+
+	return number, true
+}
+
+// AmendGrade changes the score and the mark of a grade, after recording the version it replaces in the
+// VianuEdu.GradeHistory collection (see replaceGrade). The grade remembers when it was last amended ("amendedAt").
+//
+// The method returns whether the grade was changed, as one of the outcomes of replaceGrade.
+func AmendGrade(testID string, previous GradeVersion, currentGrade, mark float64) int {
+	gradesCollection := session.DB(dbName).C(GetTestType(testID) + "Edu.Grades")
+
+	return replaceGrade(gradesCollection, previous, bson.M{
+		"currentGrade": currentGrade,
+		"mark":         mark,
+		"amendedAt":    previous.ReplacedAt,
+	})
+}
+
+// ListGradeVersions searches the database for every previous version of a grade and returns them, oldest first.
+func ListGradeVersions(gradeID string) []GradeVersion {
+	var versions []GradeVersion
+
+	historyCollection := session.DB(dbName).C("VianuEdu.GradeHistory")
+
+	err := historyCollection.Find(bson.M{"gradeID": gradeID}).Sort("version").All(&versions)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error":   err,
+			"gradeID": gradeID,
+		}).Warn("Cannot find versions of grade in database!")
+	}
+
+	return versions
+}
+
+// AddGradeAppeal records a new grade appeal in the VianuEdu.GradeAppeals collection under a brand-new ID, which the
+// method returns. If the appeal couldn't be recorded, the method returns an empty string.
+//
+// A unique index on the grade and the question of the pending appeals keeps a question from having two appeals open at
+// the same time, in which case the method returns an empty string and true.
+func AddGradeAppeal(appeal GradeAppeal) (string, bool) {
+	appealsCollection := session.DB(dbName).C("VianuEdu.GradeAppeals")
+
+	err := appealsCollection.EnsureIndex(mgo.Index{Key: []string{"gradeID", "question"}, Unique: true,
+		PartialFilter: bson.M{"pending": true}})
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Warn("Cannot index pending grade appeals!")
+		return "", false
+	}
+
+	appeal.ID = bson.NewObjectId().Hex()
+	appeal.Pending = true
+
+	err = appealsCollection.Insert(appeal)
+	if mgo.IsDup(err) {
+		return "", true
+	}
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error":   err,
+			"gradeID": appeal.GradeID,
+		}).Warn("Cannot insert grade appeal in database!")
+		return "", false
+	}
+
+	return appeal.ID, false
+}
+
+// GetGradeAppeal searches the VianuEdu.GradeAppeals collection for the grade appeal with a specific ID. The method
+// returns false if no such appeal is found.
+func GetGradeAppeal(appealID string) (GradeAppeal, bool) {
+	var appeal GradeAppeal
+
+	appealsCollection := session.DB(dbName).C("VianuEdu.GradeAppeals")
+
+	err := appealsCollection.Find(bson.M{"appealID": appealID}).One(&appeal)
+	if err != nil {
+		if err != mgo.ErrNotFound {
+			APILogger.WithFields(logrus.Fields{
+				"error":    err,
+				"appealID": appealID,
+			}).Warn("Could not find grade appeal in database!")
+		}
+		return GradeAppeal{}, false
+	}
+
+	return appeal, true
+}
+
+// CountOpenGradeAppeals counts the appeals still open, or being resolved, on a specific question of a grade.
+func CountOpenGradeAppeals(gradeID, question string) int {
+	appealsCollection := session.DB(dbName).C("VianuEdu.GradeAppeals")
+
+	count, err := appealsCollection.Find(bson.M{"gradeID": gradeID, "question": question,
+		"status": bson.M{"$in": []string{appealOpen, appealResolving}}}).Count()
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error":   err,
+			"gradeID": gradeID,
+		}).Warn("Cannot count open appeals of grade!")
+	}
+
+	return count
+}
+
+// ListStudentGradeAppeals searches the database for every appeal a student opened, optionally only on a specific test,
+// and returns them, oldest first.
+func ListStudentGradeAppeals(studentID, testID string) []GradeAppeal {
+	var appeals []GradeAppeal
+
+	appealsCollection := session.DB(dbName).C("VianuEdu.GradeAppeals")
+
+	query := bson.M{"studentID": studentID}
+	if testID != "" {
+		query["testID"] = testID
+	}
+
+	err := appealsCollection.Find(query).Sort("openedAt").All(&appeals)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error":     err,
+			"studentID": studentID,
+		}).Warn("Could not find grade appeals in database!")
+	}
+
+	return appeals
+}
+
+// ListOpenGradeAppeals searches the database for every appeal still open, or being resolved, on the grades a teacher
+// gave on the tests of a course and returns them, oldest first.
+func ListOpenGradeAppeals(course, teacherUser string) []GradeAppeal {
+	var appeals []GradeAppeal
+
+	appealsCollection := session.DB(dbName).C("VianuEdu.GradeAppeals")
+
+	err := appealsCollection.Find(bson.M{"course": course, "teacher": teacherUser,
+		"status": bson.M{"$in": []string{appealOpen, appealResolving}}}).Sort("openedAt").All(&appeals)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error":   err,
+			"course":  course,
+			"teacher": teacherUser,
+		}).Warn("Could not find open grade appeals in database!")
+	}
+
+	return appeals
+}
+
+// ClaimGradeAppeal marks an open grade appeal as being resolved, so that no one else can resolve it in the meantime.
+// The method returns false if the appeal wasn't open anymore or couldn't be updated.
+func ClaimGradeAppeal(appealID string) bool {
+	return setGradeAppealStatus(appealID, appealOpen, appealResolving)
+}
+
+// ReleaseGradeAppeal opens again a grade appeal that was being resolved, once its resolution couldn't be applied.
+func ReleaseGradeAppeal(appealID string) {
+	setGradeAppealStatus(appealID, appealResolving, appealOpen)
+}
+
+// setGradeAppealStatus changes the status of a grade appeal, provided it still has the expected status. The method
+// returns false if the appeal didn't have the expected status or couldn't be updated.
+func setGradeAppealStatus(appealID, expected, status string) bool {
+	appealsCollection := session.DB(dbName).C("VianuEdu.GradeAppeals")
+
+	err := appealsCollection.Update(bson.M{"appealID": appealID, "status": expected}, bson.M{"$set": bson.M{
+		"status": status,
+	}})
+	if err != nil {
+		if err != mgo.ErrNotFound {
+			APILogger.WithFields(logrus.Fields{
+				"error":    err,
+				"appealID": appealID,
+			}).Warn("Cannot change status of grade appeal!")
+		}
+		return false
+	}
+
+	return true
+}
+
+// ResolveGradeAppeal closes a grade appeal being resolved (see ClaimGradeAppeal) with the provided status and response
+// of the teacher, along with the new score of the grade if it was amended. The method returns false if the appeal
+// wasn't being resolved or couldn't be updated.
+func ResolveGradeAppeal(appealID, status, response string, currentGrade *float64, resolvedAt time.Time) bool {
+	appealsCollection := session.DB(dbName).C("VianuEdu.GradeAppeals")
+
+	resolution := bson.M{"status": status, "response": response, "resolvedAt": resolvedAt}
+	if currentGrade != nil {
+		resolution["currentGrade"] = *currentGrade
+	}
+
+	err := appealsCollection.Update(bson.M{"appealID": appealID, "status": appealResolving}, bson.M{"$set": resolution,
+		"$unset": bson.M{"pending": ""}})
+	if err != nil {
+		if err != mgo.ErrNotFound {
+			APILogger.WithFields(logrus.Fields{
+				"error":    err,
+				"appealID": appealID,
+			}).Warn("Cannot resolve grade appeal!")
+		}
+		return false
+	}
+
+	return true
+}
+
+// ListAnswerSheetsForTest searches the database for every answer sheet submitted for a specific test that is still
+// waiting to be graded and returns them as a JSON array.
+//
+// If there are no such answer sheets, the method returns "notFound".
+func ListAnswerSheetsForTest(testID string) string {
+	var answerSheetQuery []bson.M
+
+	submittedAnswersCollection := session.DB(dbName).C("Students.SubmittedAnswers")
+
+	err := submittedAnswersCollection.Find(bson.M{"testID": testID, "cancelled": bson.M{"$ne": true}}).
+		All(&answerSheetQuery)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error":  err,
+			"testID": testID,
+		}).Warn("Could not find any answer sheet in database!")
+	}
+
+	answerSheetArray, err := bson.MarshalJSON(answerSheetQuery)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Warn("Could not marshal query into variable!")
+	}
+
+	result := string(answerSheetArray)
+
+	if result == "null\n" {
+		return "notFound"
+	}
+
+	return result
+}
+
+// attemptQuery matches the attempt number of an answer sheet. Answer sheets submitted before tests allowed several
+// attempts have no attempt number, and count as the first attempt.
+func attemptQuery(attempt int) interface{} {
+	if attempt == 1 {
+		return bson.M{"$in": []interface{}{1, nil}}
+	}
+
+	return attempt
+}
+
+// CountAttempts returns how many answer sheets a student has submitted on a specific test, graded or not.
+func CountAttempts(testID, studentUser string) int {
+	submittedAnswersCollection := session.DB(dbName).C("Students.SubmittedAnswers")
+	gradesCollection := session.DB(dbName).C(GetTestType(testID) + "Edu.Grades")
+
+	answerSheetCount, err := submittedAnswersCollection.Find(bson.M{"testID": testID, "student.account.userName": studentUser}).Count()
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error":  err,
+			"testID": testID,
+		}).Warn("Cannot count answer sheets of student in database!")
+	}
+
+	gradeCount, err := gradesCollection.Find(bson.M{"studentAnswerSheet.testID": testID, "studentAnswerSheet.student.account.userName": studentUser}).Count()
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error":  err,
+			"testID": testID,
+		}).Warn("Cannot count grades of student in database!")
+	}
+
+	return answerSheetCount + gradeCount
+}
+
+// ListStudentAnswerSheetsForTest searches the database for every answer sheet a student submitted on a specific test
+// that is still waiting to be graded and returns them as a JSON array.
+//
+// If there are no such answer sheets, the method returns "notFound".
+func ListStudentAnswerSheetsForTest(testID, studentUser string) string {
+	var answerSheetQuery []bson.M
+
+	submittedAnswersCollection := session.DB(dbName).C("Students.SubmittedAnswers")
+
+	err := submittedAnswersCollection.Find(bson.M{"testID": testID, "student.account.userName": studentUser}).All(&answerSheetQuery)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error":  err,
+			"testID": testID,
+		}).Warn("Could not find any answer sheet of student in database!")
+	}
+
+	answerSheetArray, err := bson.MarshalJSON(answerSheetQuery)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Warn("Could not marshal query into variable!")
+	}
+
+	result := string(answerSheetArray)
+
+	if result == "null\n" {
+		return "notFound"
+	}
+
+	return result
+}
+
+// ListStudentGradesForTest searches the database for every grade a student was given on a specific test, one per graded
+// attempt, and returns them as a JSON array.
+//
+// If the student hasn't been graded on the test, the method returns "notFound".
+func ListStudentGradesForTest(testID, studentUser string) string {
+	var gradeQuery []bson.M
+
+	gradesCollection := session.DB(dbName).C(GetTestType(testID) + "Edu.Grades")
+
+	err := gradesCollection.Find(bson.M{"studentAnswerSheet.testID": testID, "studentAnswerSheet.student.account.userName": studentUser}).All(&gradeQuery)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error":  err,
+			"testID": testID,
+		}).Warn("Cannot find grades of student in database for this test!")
+	}
+
+	gradeArray, err := bson.MarshalJSON(gradeQuery)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Warn("Cannot marshal gradeArray variable!")
+	}
+
+	result := string(gradeArray)
+
+	if result == "null\n" {
+		return "notFound"
+	}
+
+	return result
+}
+
+// AddExamEvent records an event reported by the exam client of a student during an attempt on a test in the
+// Students.ExamEvents collection.
+//
+// This function validates nothing from the event, so any method that might call this one must be certain it is a valid
+// ExamEvent object.
+func AddExamEvent(testID, studentID string, attempt int, event ExamEvent) {
+	eventsCollection := session.DB(dbName).C("Students.ExamEvents")
+
+	err := eventsCollection.Insert(bson.M{
+		"testID":     testID,
+		"studentID":  studentID,
+		"attempt":    attempt,
+		"eventType":  event.EventType,
+		"details":    event.Details,
+		"occurredAt": event.OccurredAt,
+		"receivedAt": event.ReceivedAt,
+		"ip":         event.IP,
+		"userAgent":  event.UserAgent,
+	})
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error":     err,
+			"testID":    testID,
+			"studentID": studentID,
+		}).Warn("Could not add exam event!")
+	}
+}
+
+// ListExamEvents returns every event reported by the exam client of a student on a test, in the order they were
+// received.
+func ListExamEvents(testID, studentID string) []ExamEvent {
+	var events []ExamEvent
+
+	eventsCollection := session.DB(dbName).C("Students.ExamEvents")
+
+	err := eventsCollection.Find(bson.M{"testID": testID, "studentID": studentID}).Sort("receivedAt").All(&events)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error":     err,
+			"testID":    testID,
+			"studentID": studentID,
+		}).Warn("Could not find exam events in database!")
+	}
+
+	return events
+}
+
+// GetLastExamEventIP returns the IP address the latest event of a student's attempt on a test was reported from.
+//
+// If no event has been reported yet, the method returns an empty string.
+func GetLastExamEventIP(testID, studentID string, attempt int) string {
+	var event ExamEvent
+
+	eventsCollection := session.DB(dbName).C("Students.ExamEvents")
+
+	err := eventsCollection.Find(bson.M{"testID": testID, "studentID": studentID, "attempt": attempt}).Sort("-receivedAt").One(&event)
+	if err != nil && err != mgo.ErrNotFound {
+		APILogger.WithFields(logrus.Fields{
+			"error":     err,
+			"testID":    testID,
+			"studentID": studentID,
+		}).Warn("Could not query exam events in database!")
+	}
+
+	return event.IP
+}
+
+// ListFlaggedExamAttempts returns the attempts on a test during which events of the provided types were reported, by
+// student ID.
+func ListFlaggedExamAttempts(testID string, eventTypes []string) map[string]map[int]bool {
+	var eventQuery []struct {
+		StudentID string `bson:"studentID"`
+		Attempt   int    `bson:"attempt"`
+	}
+
+	eventsCollection := session.DB(dbName).C("Students.ExamEvents")
+
+	err := eventsCollection.Find(bson.M{"testID": testID, "eventType": bson.M{"$in": eventTypes}}).Select(bson.M{"studentID": 1, "attempt": 1}).All(&eventQuery)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error":  err,
+			"testID": testID,
+		}).Warn("Could not query flagged exam events in database!")
+	}
+
+	flagged := map[string]map[int]bool{}
+	for _, event := range eventQuery {
+		if flagged[event.StudentID] == nil {
+			flagged[event.StudentID] = map[int]bool{}
+		}
+		flagged[event.StudentID][event.Attempt] = true
+	}
+
+	return flagged
+}
+
+// SetGradeScale sets the grade scale of a course in the VianuEdu.GradeScales collection, replacing any previous grade
+// scale the course had. Marks already given are kept as they are.
+//
+// This function validates nothing from the document, so any method that might call this one must be certain the
+// inserted document is valid JSON for a GradeScale object.
+func SetGradeScale(course, scale string) {
+	gradeScalesCollection := session.DB(dbName).C("VianuEdu.GradeScales")
+
+	var document map[string]interface{}
+
+	err := json.Unmarshal([]byte(scale), &document)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Warn("Could not unmarshal byte-slice into document!")
+		return
+	}
+
+	document["course"] = course
+	document["updatedAt"] = time.Now()
+
+	_, err = gradeScalesCollection.Upsert(bson.M{"course": course}, document)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error":  err,
+			"course": course,
+		}).Warn("Could not set grade scale!")
+	}
+}
+
+// GetGradeScale searches the database for the grade scale of a course and returns it.
+//
+// If the course has no grade scale of its own, the method returns "notFound".
+func GetGradeScale(course string) string {
+	var scaleQuery []bson.M
+
+	gradeScalesCollection := session.DB(dbName).C("VianuEdu.GradeScales")
+
+	err := gradeScalesCollection.Find(bson.M{"course": course}).Select(bson.M{"_id": 0, "course": 0, "updatedAt": 0}).All(&scaleQuery)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error":  err,
+			"course": course,
+		}).Warn("Could not find grade scale in database!")
+	}
+
+	scale, err := bson.MarshalJSON(scaleQuery)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Warn("Could not marshal getGradeScale request in JSON!")
+	}
+
+	result := string(scale)
+
+	if result == "null\n" {
+		return "notFound"
+	}
+
+	result = strings.Trim(result, "[")
+	result = result[:len(result)-2]
+
+	return result
+}
+
+// termQuery returns the query matching the Test, Grade and Lesson documents of a term of the academic calendar, i.e.
+// those scoped to its academic year ("academicYear") and, unless it stands for the whole year, to its semester
+// ("semester"). Documents stored before the academic calendar are matched by the timestamp of their ID instead.
+//
+// A Term without a year matches every document.
+func termQuery(term Term) bson.M {
+	if term.Year == "" {
+		return bson.M{}
+	}
+
+	scoped := bson.M{"academicYear": term.Year}
+	if term.Number > 0 {
+		scoped["semester"] = term.Number
+	}
+
+	unscoped := bson.M{
+		"academicYear": bson.M{"$exists": false},
+		"_id": bson.M{
+			"$gte": bson.NewObjectIdWithTime(term.Start),
+			"$lt":  bson.NewObjectIdWithTime(term.End.AddDate(0, 0, 1)),
+		},
+	}
+
+	return bson.M{"$or": []bson.M{scoped, unscoped}}
+}
+
+// SetAcademicYear sets an academic year of the academic calendar in the VianuEdu.AcademicYears collection, replacing
+// any previous version of it. Documents already scoped to the academic year are kept as they are.
+//
+// This function validates nothing from the document, so any method that might call this one must be certain the
+// inserted document is valid JSON for an AcademicYear object.
+func SetAcademicYear(year, academicYear string) {
+	academicYearsCollection := session.DB(dbName).C("VianuEdu.AcademicYears")
+
+	var document map[string]interface{}
+
+	err := json.Unmarshal([]byte(academicYear), &document)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Warn("Could not unmarshal byte-slice into document!")
+		return
+	}
+
+	document["year"] = year
+	document["updatedAt"] = time.Now()
+
+	_, err = academicYearsCollection.Upsert(bson.M{"year": year}, document)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error": err,
+			"year":  year,
+		}).Warn("Could not set academic year!")
+	}
+}
+
+// ListAcademicYears searches the database for every academic year of the academic calendar and returns them as a
+// JSON array.
+//
+// If the academic calendar is empty, the method returns "notFound".
+func ListAcademicYears() string {
+	var yearQuery []bson.M
+
+	academicYearsCollection := session.DB(dbName).C("VianuEdu.AcademicYears")
+
+	err := academicYearsCollection.Find(bson.M{}).Select(bson.M{"_id": 0, "updatedAt": 0}).Sort("year").All(&yearQuery)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Warn("Could not find academic years in database!")
+	}
+
+	years, err := bson.MarshalJSON(yearQuery)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Warn("Could not marshal listAcademicYears request in JSON!")
+	}
+
+	result := string(years)
+
+	if result == "null\n" {
+		return "notFound"
+	}
+
+	return result
+}
+
+// ListClassStudents searches the database for every student of a class and returns them as a JSON array, sorted by
+// their names.
+//
+// If the class has no students, the method returns "notFound".
+func ListClassStudents(grade int, gradeLetter string) string {
+	var studentQuery []bson.M
+
+	studentsAccountsCollection := session.DB(dbName).C("Students.Accounts")
+
+	err := studentsAccountsCollection.Find(bson.M{"grade": grade, "gradeLetter": gradeLetter}).Sort("lastName", "firstName").All(&studentQuery)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error":       err,
+			"grade":       grade,
+			"gradeLetter": gradeLetter,
+		}).Warn("Could not find students of class in database!")
+	}
+
+	students, err := bson.MarshalJSON(studentQuery)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"error": err,
+		}).Warn("Could not marshal listClassStudents request in JSON!")
+	}
+
+	result := string(students)
+
+	if result == "null\n" {
+		return "notFound"
+	}
+
+	return result
+}
+
+// ListClassTests searches the database for every test of a course in a term of the academic calendar (see termQuery)
+// that a class takes, be it through the class itself, or through student groups or students of the class being
+// targeted by the test, and returns them as a JSON array.
+//
+// If the class takes no tests of the course in the term, the method returns "notFound".
+func ListClassTests(subject string, grade int, gradeLetter string, studentIDs, groupIDs []string, term Term) string {
+	var testQuery []bson.M
+
+	testCollection := session.DB(dbName).C(subject + "Edu.Tests")
+
+	if studentIDs == nil {
+		studentIDs = []string{}
+	}
+	if groupIDs == nil {
+		groupIDs = []string{}
+	}
+
+	err := testCollection.Find(bson.M{"$and": []bson.M{termQuery(term), {"$or": []bson.M{
+		{"grade": grade, "gradeLetter": gradeLetter},
+		{"targets.classes": bson.M{"$elemMatch": bson.M{"grade": grade, "gradeLetter": gradeLetter}}},
+		{"targets.groups": bson.M{"$in": groupIDs}},
+		{"targets.students": bson.M{"$in": studentIDs}},
+	}}}}).All(&testQuery)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"err": err,
+		}).Warn("Cannot find tests in database for this class!")
+	}
+
+	testArray, err := bson.MarshalJSON(testQuery)
+	if err != nil {
+		APILogger.WithFields(logrus.Fields{
+			"err": err,
+		}).Warn("Cannot marshal testArray variable!")
+	}
+
+	result := string(testArray)
+
+	if result == "null\n" {
+		return "notFound"
+	}
+
+	return result
+}